@@ -0,0 +1,169 @@
+package achievements
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+// Metrics rules are evaluated against.
+const (
+	MetricWorkouts       = "workouts"
+	MetricLifetimeVolume = "lifetime_volume"
+	MetricLongestStreak  = "longest_streak_weeks"
+)
+
+// Rule awards a badge once a metric reaches its threshold.
+type Rule struct {
+	Code        string  `json:"code"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Metric      string  `json:"metric"`
+	Threshold   float64 `json:"threshold"`
+}
+
+var DefaultRules = []Rule{
+	{Code: "first_workout", Name: "First Workout", Description: "Log your first workout", Metric: MetricWorkouts, Threshold: 1},
+	{Code: "workouts_100", Name: "Centurion", Description: "Log 100 workouts", Metric: MetricWorkouts, Threshold: 100},
+	{Code: "streak_10_weeks", Name: "Ten Week Streak", Description: "Train at least once a week for 10 weeks in a row", Metric: MetricLongestStreak, Threshold: 10},
+	{Code: "volume_10000kg", Name: "Ten Tonnes", Description: "Lift 10,000 kg of lifetime volume", Metric: MetricLifetimeVolume, Threshold: 10000},
+}
+
+// Triggers are the events after which a user's achievements are evaluated.
+var Triggers = []string{
+	store.EventWorkoutCreated,
+	store.EventWorkoutUpdated,
+	store.EventWorkoutSessionFinished,
+}
+
+type Streak struct {
+	CurrentWeeks int `json:"current_weeks"`
+	LongestWeeks int `json:"longest_weeks"`
+}
+
+type Achievement struct {
+	Rule
+	Current   float64    `json:"current"`
+	Progress  float64    `json:"progress"`
+	Earned    bool       `json:"earned"`
+	AwardedAt *time.Time `json:"awarded_at"`
+}
+
+type Summary struct {
+	Earned     []Achievement `json:"earned"`
+	InProgress []Achievement `json:"in_progress"`
+	Streak     Streak        `json:"streak"`
+}
+
+type Engine struct {
+	store  store.AchievementStore
+	logger *log.Logger
+	rules  []Rule
+	now    func() time.Time
+}
+
+func NewEngine(achievementStore store.AchievementStore, logger *log.Logger, rules ...Rule) *Engine {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	return &Engine{
+		store:  achievementStore,
+		logger: logger,
+		rules:  rules,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (e *Engine) HandleEvent(ctx context.Context, event store.Event) error {
+	if event.UserId == 0 {
+		return nil
+	}
+	_, err := e.Evaluate(event.UserId)
+	return err
+}
+
+// Evaluate awards every rule the user newly satisfies and returns the state of
+// all achievements. Awards are never revoked, e.g. when a workout is deleted.
+func (e *Engine) Evaluate(userId int) (*Summary, error) {
+	stats, err := e.store.GetTrainingStats(userId)
+	if err != nil {
+		return nil, err
+	}
+	awards, err := e.store.GetAwards(userId)
+	if err != nil {
+		return nil, err
+	}
+	awarded := map[string]time.Time{}
+	for _, award := range awards {
+		awarded[award.Code] = award.AwardedAt
+	}
+
+	now := e.now()
+	current, longest := WeeklyStreaks(stats.ActiveWeeks, now)
+	metrics := map[string]float64{
+		MetricWorkouts:       float64(stats.Workouts),
+		MetricLifetimeVolume: stats.LifetimeVolume,
+		MetricLongestStreak:  float64(longest),
+	}
+
+	summary := &Summary{
+		Earned:     []Achievement{},
+		InProgress: []Achievement{},
+		Streak:     Streak{CurrentWeeks: current, LongestWeeks: longest},
+	}
+	for _, rule := range e.rules {
+		a := Achievement{Rule: rule, Current: metrics[rule.Metric]}
+		a.Progress = math.Min(1, math.Round(a.Current/rule.Threshold*1000)/1000)
+
+		at, ok := awarded[rule.Code]
+		if !ok && a.Current >= rule.Threshold {
+			isNew, err := e.store.AwardAchievement(userId, rule.Code, now)
+			if err != nil {
+				return nil, err
+			}
+			if isNew {
+				e.logger.Printf("INFO: user %d earned %s", userId, rule.Code)
+			}
+			at, ok = now, true
+		}
+		if ok {
+			a.Earned, a.Progress, a.AwardedAt = true, 1, &at
+			summary.Earned = append(summary.Earned, a)
+		} else {
+			summary.InProgress = append(summary.InProgress, a)
+		}
+	}
+	return summary, nil
+}
+
+// WeeklyStreaks returns the current and longest run of consecutive weeks with
+// a workout. weeks are week starts in chronological order. The current week
+// does not break a streak before it is over.
+func WeeklyStreaks(weeks []time.Time, now time.Time) (current, longest int) {
+	run := 0
+	for i, week := range weeks {
+		if i > 0 && weekIndex(week)-weekIndex(weeks[i-1]) == 1 {
+			run++
+		} else {
+			run = 1
+		}
+		longest = max(longest, run)
+	}
+	if len(weeks) == 0 {
+		return 0, 0
+	}
+	if gap := weekIndex(now) - weekIndex(weeks[len(weeks)-1]); gap <= 1 {
+		current = run
+	}
+	return current, longest
+}
+
+// weekIndex numbers weeks starting on Monday, UTC.
+func weekIndex(t time.Time) int {
+	// the Unix epoch was a Thursday, shift so that weeks start on Monday
+	days := int(math.Floor(float64(t.UTC().Unix()) / 86400))
+	return int(math.Floor(float64(days+3) / 7))
+}
@@ -0,0 +1,125 @@
+package achievements
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryAchievementStore struct {
+	stats  store.TrainingStats
+	awards []store.Award
+}
+
+func (m *memoryAchievementStore) GetTrainingStats(userId int) (*store.TrainingStats, error) {
+	stats := m.stats
+	return &stats, nil
+}
+
+func (m *memoryAchievementStore) GetAwards(userId int) ([]store.Award, error) {
+	return m.awards, nil
+}
+
+func (m *memoryAchievementStore) AwardAchievement(userId int, code string, awardedAt time.Time) (bool, error) {
+	for _, a := range m.awards {
+		if a.UserId == userId && a.Code == code {
+			return false, nil
+		}
+	}
+	m.awards = append(m.awards, store.Award{UserId: userId, Code: code, AwardedAt: awardedAt})
+	return true, nil
+}
+
+// monday returns the start of the n-th week before the week of 2024-03-04.
+func monday(n int) time.Time {
+	return time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -7*n)
+}
+
+func TestWeeklyStreaks(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		weeks       []time.Time
+		wantCurrent int
+		wantLongest int
+	}{
+		{name: "no workouts"},
+		{name: "this week only", weeks: []time.Time{monday(0)}, wantCurrent: 1, wantLongest: 1},
+		{
+			name:        "streak alive until the current week ends",
+			weeks:       []time.Time{monday(3), monday(2), monday(1)},
+			wantCurrent: 3,
+			wantLongest: 3,
+		},
+		{
+			name:        "broken streak",
+			weeks:       []time.Time{monday(8), monday(7), monday(6), monday(5), monday(2)},
+			wantCurrent: 0,
+			wantLongest: 4,
+		},
+		{
+			name:        "gap then current",
+			weeks:       []time.Time{monday(6), monday(5), monday(1), monday(0)},
+			wantCurrent: 2,
+			wantLongest: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest := WeeklyStreaks(tt.weeks, now)
+			assert.Equal(t, tt.wantCurrent, current)
+			assert.Equal(t, tt.wantLongest, longest)
+		})
+	}
+}
+
+func TestEngineAwardsOnce(t *testing.T) {
+	ms := &memoryAchievementStore{}
+	engine := NewEngine(ms, log.New(io.Discard, "", 0))
+	engine.now = func() time.Time { return time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC) }
+
+	var weeks []time.Time
+	for i := 11; i >= 0; i-- {
+		weeks = append(weeks, monday(i))
+	}
+	ms.stats = store.TrainingStats{Workouts: 12, LifetimeVolume: 8000, ActiveWeeks: weeks}
+
+	err := engine.HandleEvent(context.Background(), store.Event{Type: store.EventWorkoutCreated, UserId: 7})
+	require.NoError(t, err)
+	codes := []string{}
+	for _, a := range ms.awards {
+		codes = append(codes, a.Code)
+	}
+	assert.ElementsMatch(t, []string{"first_workout", "streak_10_weeks"}, codes)
+
+	ms.stats.LifetimeVolume = 12500
+	summary, err := engine.Evaluate(7)
+	require.NoError(t, err)
+	assert.Len(t, ms.awards, 3)
+	assert.Len(t, summary.Earned, 3)
+	require.Len(t, summary.InProgress, 1)
+	assert.Equal(t, "workouts_100", summary.InProgress[0].Code)
+	assert.Equal(t, 0.12, summary.InProgress[0].Progress)
+	assert.Equal(t, Streak{CurrentWeeks: 12, LongestWeeks: 12}, summary.Streak)
+
+	// evaluating again awards nothing new
+	_, err = engine.Evaluate(7)
+	require.NoError(t, err)
+	assert.Len(t, ms.awards, 3)
+}
+
+func TestEngineIgnoresAnonymousEvents(t *testing.T) {
+	ms := &memoryAchievementStore{stats: store.TrainingStats{Workouts: 1}}
+	engine := NewEngine(ms, log.New(io.Discard, "", 0))
+
+	err := engine.HandleEvent(context.Background(), store.Event{Type: store.EventWorkoutCreated})
+	require.NoError(t, err)
+	assert.Empty(t, ms.awards)
+}
@@ -0,0 +1,205 @@
+package activity
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrEmptyTrack = errors.New("activity: track has no timed points")
+
+const (
+	SportRun      = "Run"
+	SportRide     = "Ride"
+	SportWalk     = "Walk"
+	SportHike     = "Hike"
+	SportSwim     = "Swim"
+	SportRow      = "Row"
+	SportOther    = "Activity"
+	SportStrength = "Strength Training"
+)
+
+type Point struct {
+	Time      time.Time
+	Lat       *float64
+	Lon       *float64
+	Elevation *float64
+	HeartRate *int
+	// Distance is the cumulative distance reported by the device, used when
+	// the track has no positions (e.g. treadmill recordings).
+	Distance *float64
+}
+
+type Track struct {
+	Name   string
+	Sport  string
+	Points []Point
+}
+
+type Split struct {
+	Number         int     `json:"number"`
+	DistanceMeters float64 `json:"distance_meters"`
+	Seconds        float64 `json:"seconds"`
+	PaceSecondsKm  float64 `json:"pace_seconds_per_km"`
+	AvgHeartRate   *int    `json:"avg_heart_rate"`
+}
+
+type Summary struct {
+	StartedAt           time.Time `json:"started_at"`
+	FinishedAt          time.Time `json:"finished_at"`
+	DistanceMeters      float64   `json:"distance_meters"`
+	ElapsedSeconds      int       `json:"elapsed_seconds"`
+	MovingSeconds       int       `json:"moving_seconds"`
+	ElevationGainMeters float64   `json:"elevation_gain_meters"`
+	AvgHeartRate        *int      `json:"avg_heart_rate"`
+	MaxHeartRate        *int      `json:"max_heart_rate"`
+	Splits              []Split   `json:"splits"`
+}
+
+const (
+	earthRadiusMeters = 6371008.8
+	// segments slower than this are considered stopped
+	movingSpeedThreshold = 0.5
+	// recording gaps longer than this (auto pause) never count as moving time
+	maxMovingGap = 5 * time.Minute
+	// elevation changes below this are treated as GPS noise
+	elevationHysteresis = 2.0
+	splitMeters         = 1000.0
+)
+
+// Haversine returns the great-circle distance in meters between two coordinates.
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Analyze computes distance, moving time, elevation gain, heart-rate
+// statistics and per-kilometer splits of a track. Points without a timestamp
+// are ignored.
+func Analyze(track *Track) (*Summary, error) {
+	points := make([]Point, 0, len(track.Points))
+	for _, p := range track.Points {
+		if !p.Time.IsZero() {
+			points = append(points, p)
+		}
+	}
+	if len(points) == 0 {
+		return nil, ErrEmptyTrack
+	}
+
+	s := &Summary{
+		StartedAt:  points[0].Time,
+		FinishedAt: points[len(points)-1].Time,
+		Splits:     []Split{},
+	}
+	s.ElapsedSeconds = int(s.FinishedAt.Sub(s.StartedAt).Seconds())
+
+	var moving float64
+	var hrSum, hrCount, hrMax int
+	var elevationRef *float64
+
+	split := Split{Number: 1}
+	var splitHrSum, splitHrCount int
+	splitStart := points[0].Time
+
+	for i := range points {
+		p := &points[i]
+		if p.HeartRate != nil {
+			hrSum += *p.HeartRate
+			hrCount++
+			splitHrSum += *p.HeartRate
+			splitHrCount++
+			if *p.HeartRate > hrMax {
+				hrMax = *p.HeartRate
+			}
+		}
+		if p.Elevation != nil {
+			if elevationRef == nil {
+				ref := *p.Elevation
+				elevationRef = &ref
+			} else if delta := *p.Elevation - *elevationRef; delta >= elevationHysteresis {
+				s.ElevationGainMeters += delta
+				*elevationRef = *p.Elevation
+			} else if delta <= -elevationHysteresis {
+				*elevationRef = *p.Elevation
+			}
+		}
+		if i == 0 {
+			continue
+		}
+
+		prev := &points[i-1]
+		step := segmentDistance(prev, p)
+		dt := p.Time.Sub(prev.Time)
+		if dt > 0 && dt <= maxMovingGap && step/dt.Seconds() >= movingSpeedThreshold {
+			moving += dt.Seconds()
+		}
+
+		// close every kilometer boundary crossed by this segment, interpolating the crossing time
+		for step > 0 && split.DistanceMeters+step >= splitMeters {
+			need := splitMeters - split.DistanceMeters
+			crossing := prev.Time.Add(time.Duration(float64(dt) * (1 - (step-need)/step)))
+			split.DistanceMeters = splitMeters
+			split.Seconds = crossing.Sub(splitStart).Seconds()
+			finishSplit(&split, splitHrSum, splitHrCount)
+			s.Splits = append(s.Splits, split)
+
+			split = Split{Number: split.Number + 1}
+			splitHrSum, splitHrCount = 0, 0
+			splitStart = crossing
+			step -= need
+			s.DistanceMeters += need
+		}
+		split.DistanceMeters += step
+		s.DistanceMeters += step
+	}
+
+	if split.DistanceMeters >= 1 {
+		split.Seconds = s.FinishedAt.Sub(splitStart).Seconds()
+		finishSplit(&split, splitHrSum, splitHrCount)
+		s.Splits = append(s.Splits, split)
+	}
+
+	s.DistanceMeters = math.Round(s.DistanceMeters*10) / 10
+	s.ElevationGainMeters = math.Round(s.ElevationGainMeters*10) / 10
+	s.MovingSeconds = int(math.Round(moving))
+	if hrCount > 0 {
+		avg := int(math.Round(float64(hrSum) / float64(hrCount)))
+		s.AvgHeartRate = &avg
+		s.MaxHeartRate = &hrMax
+	}
+	return s, nil
+}
+
+func segmentDistance(a, b *Point) float64 {
+	if a.Lat != nil && a.Lon != nil && b.Lat != nil && b.Lon != nil {
+		return Haversine(*a.Lat, *a.Lon, *b.Lat, *b.Lon)
+	}
+	if a.Distance != nil && b.Distance != nil && *b.Distance > *a.Distance {
+		return *b.Distance - *a.Distance
+	}
+	return 0
+}
+
+func finishSplit(split *Split, hrSum, hrCount int) {
+	split.DistanceMeters = math.Round(split.DistanceMeters*10) / 10
+	split.Seconds = math.Round(split.Seconds*10) / 10
+	if split.DistanceMeters > 0 {
+		split.PaceSecondsKm = math.Round(split.Seconds/(split.DistanceMeters/1000)*10) / 10
+	}
+	if hrCount > 0 {
+		avg := int(math.Round(float64(hrSum) / float64(hrCount)))
+		split.AvgHeartRate = &avg
+	}
+}
+
+// FormatPace renders seconds per kilometer as m:ss.
+func FormatPace(secondsPerKm float64) string {
+	total := int(math.Round(secondsPerKm))
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
@@ -0,0 +1,101 @@
+package activity
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHaversine(t *testing.T) {
+	// one degree of latitude is roughly 111.2 km
+	assert.InDelta(t, 111195, Haversine(0, 0, 1, 0), 1)
+	assert.InDelta(t, 0, Haversine(51.5, -0.12, 51.5, -0.12), 1e-9)
+}
+
+func TestParseGPX(t *testing.T) {
+	f, err := os.Open("testdata/run.gpx")
+	require.NoError(t, err)
+	defer f.Close()
+
+	track, err := ParseGPX(f)
+	require.NoError(t, err)
+	assert.Equal(t, "Morning Run", track.Name)
+	assert.Equal(t, SportRun, track.Sport)
+	require.Len(t, track.Points, 7)
+	require.NotNil(t, track.Points[0].HeartRate)
+	assert.Equal(t, 120, *track.Points[0].HeartRate)
+
+	summary, err := Analyze(track)
+	require.NoError(t, err)
+	assert.InDelta(t, 1111.9, summary.DistanceMeters, 0.5)
+	assert.Equal(t, 320, summary.ElapsedSeconds)
+	// the 20 second stop is not moving time
+	assert.Equal(t, 300, summary.MovingSeconds)
+	// 100 -> 104 -> 108, the 1m wiggles are noise
+	assert.Equal(t, 8.0, summary.ElevationGainMeters)
+	require.NotNil(t, summary.AvgHeartRate)
+	assert.Equal(t, 147, *summary.AvgHeartRate)
+	assert.Equal(t, 162, *summary.MaxHeartRate)
+
+	require.Len(t, summary.Splits, 2)
+	assert.Equal(t, 1000.0, summary.Splits[0].DistanceMeters)
+	assert.InDelta(t, 289.8, summary.Splits[0].Seconds, 0.5)
+	assert.InDelta(t, 111.9, summary.Splits[1].DistanceMeters, 0.5)
+}
+
+func TestParseTCX(t *testing.T) {
+	f, err := os.Open("testdata/treadmill.tcx")
+	require.NoError(t, err)
+	defer f.Close()
+
+	track, err := ParseTCX(f)
+	require.NoError(t, err)
+	assert.Equal(t, SportRun, track.Sport)
+	require.Len(t, track.Points, 4)
+	assert.Nil(t, track.Points[0].Lat)
+
+	summary, err := Analyze(track)
+	require.NoError(t, err)
+	// treadmill recordings fall back to the device distance
+	assert.Equal(t, 1500.0, summary.DistanceMeters)
+	assert.Equal(t, 360, summary.ElapsedSeconds)
+	require.Len(t, summary.Splits, 2)
+	assert.Equal(t, 240.0, summary.Splits[0].Seconds)
+	assert.Equal(t, 240.0, summary.Splits[0].PaceSecondsKm)
+	assert.Equal(t, 500.0, summary.Splits[1].DistanceMeters)
+	assert.Equal(t, 240.0, summary.Splits[1].PaceSecondsKm)
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{
+			name:    "no points",
+			input:   `<gpx><trk><trkseg></trkseg></trk></gpx>`,
+			wantErr: ErrEmptyTrack,
+		},
+		{
+			name:    "points without time",
+			input:   `<gpx><trk><trkseg><trkpt lat="1" lon="1"></trkpt></trkseg></trk></gpx>`,
+			wantErr: ErrEmptyTrack,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track, err := ParseGPX(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			_, err = Analyze(track)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := ParseGPX(strings.NewReader(`<gpx><trk><trkseg><trkpt lat="1" lon="1"><time>yesterday</time></trkpt></trkseg></trk></gpx>`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,305 @@
+package activity
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFit   = errors.New("activity: not a fit file")
+	ErrFitCRC   = errors.New("activity: fit crc mismatch")
+	errFitShort = errors.New("activity: truncated fit file")
+)
+
+const fitSignature = ".FIT"
+
+// fit base type numbers, without the endian ability bit
+const (
+	fitEnum    = 0x00
+	fitSint8   = 0x01
+	fitUint8   = 0x02
+	fitSint16  = 0x03
+	fitUint16  = 0x04
+	fitSint32  = 0x05
+	fitUint32  = 0x06
+	fitUint8z  = 0x0A
+	fitUint16z = 0x0B
+	fitUint32z = 0x0C
+	fitByte    = 0x0D
+	fitSint64  = 0x0E
+	fitUint64  = 0x0F
+	fitUint64z = 0x10
+)
+
+const fitFieldTimestamp = 253
+
+type fitFieldDef struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type fitDefinition struct {
+	global  uint16
+	order   binary.ByteOrder
+	fields  []fitFieldDef
+	devSize int
+}
+
+func (d *fitDefinition) size() int {
+	n := d.devSize
+	for _, f := range d.fields {
+		n += f.size
+	}
+	return n
+}
+
+type fitValue struct {
+	baseType byte
+	data     []byte
+}
+
+type fitMessage struct {
+	global    uint16
+	order     binary.ByteOrder
+	values    map[byte]fitValue
+	timestamp uint32
+}
+
+// decodeFIT decodes every data message of a FIT file. Chained files are
+// decoded one after another. Developer fields are skipped without being
+// interpreted.
+func decodeFIT(data []byte) ([]fitMessage, error) {
+	var messages []fitMessage
+	for len(data) > 0 {
+		n, msgs, err := decodeFITFile(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msgs...)
+		data = data[n:]
+	}
+	return messages, nil
+}
+
+func decodeFITFile(data []byte) (int, []fitMessage, error) {
+	if len(data) < 12 {
+		return 0, nil, ErrNotFit
+	}
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize || string(data[8:12]) != fitSignature {
+		return 0, nil, ErrNotFit
+	}
+	if headerSize >= 14 {
+		// a zero header crc means the writer did not compute one
+		crc := binary.LittleEndian.Uint16(data[12:14])
+		if crc != 0 && crc != fitCRC(data[:12]) {
+			return 0, nil, ErrFitCRC
+		}
+	}
+
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if end+2 > len(data) {
+		return 0, nil, errFitShort
+	}
+	if binary.LittleEndian.Uint16(data[end:end+2]) != fitCRC(data[:end]) {
+		return 0, nil, ErrFitCRC
+	}
+
+	messages, err := decodeFITRecords(data[headerSize:end])
+	if err != nil {
+		return 0, nil, err
+	}
+	return end + 2, messages, nil
+}
+
+func decodeFITRecords(data []byte) ([]fitMessage, error) {
+	definitions := map[byte]*fitDefinition{}
+	var messages []fitMessage
+	var lastTimestamp uint32
+
+	for pos := 0; pos < len(data); {
+		header := data[pos]
+		pos++
+
+		var local byte
+		compressed := header&0x80 != 0
+		switch {
+		case compressed:
+			// compressed timestamp header: the low five bits are an offset
+			// from the last full timestamp
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp := lastTimestamp&^0x1F | offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+		case header&0x40 != 0:
+			def, n, err := decodeFITDefinition(data[pos:], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			definitions[header&0x0F] = def
+			pos += n
+			continue
+		default:
+			local = header & 0x0F
+		}
+
+		def, ok := definitions[local]
+		if !ok {
+			return nil, fmt.Errorf("activity: fit data message for undefined local type %d", local)
+		}
+		if pos+def.size() > len(data) {
+			return nil, errFitShort
+		}
+
+		msg := fitMessage{global: def.global, order: def.order, values: make(map[byte]fitValue, len(def.fields))}
+		offset := pos
+		for _, f := range def.fields {
+			msg.values[f.num] = fitValue{baseType: f.baseType, data: data[offset : offset+f.size]}
+			offset += f.size
+		}
+		pos += def.size()
+
+		if ts, ok := msg.uint(fitFieldTimestamp); ok {
+			lastTimestamp = uint32(ts)
+			msg.timestamp = lastTimestamp
+		} else if compressed {
+			msg.timestamp = lastTimestamp
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func decodeFITDefinition(data []byte, developer bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, errFitShort
+	}
+	def := &fitDefinition{order: binary.LittleEndian}
+	if data[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(data[2:4])
+
+	count := int(data[4])
+	pos := 5
+	if pos+count*3 > len(data) {
+		return nil, 0, errFitShort
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitFieldDef{num: data[pos], size: int(data[pos+1]), baseType: data[pos+2] & 0x1F})
+		pos += 3
+	}
+
+	if developer {
+		if pos >= len(data) {
+			return nil, 0, errFitShort
+		}
+		count = int(data[pos])
+		pos++
+		if pos+count*3 > len(data) {
+			return nil, 0, errFitShort
+		}
+		for i := 0; i < count; i++ {
+			def.devSize += int(data[pos+1])
+			pos += 3
+		}
+	}
+	return def, pos, nil
+}
+
+// uint returns the first element of an unsigned field, reporting false when
+// the field is missing or holds the invalid value of its base type.
+func (m *fitMessage) uint(num byte) (uint64, bool) {
+	v, ok := m.values[num]
+	if !ok {
+		return 0, false
+	}
+	var x, invalid uint64
+	switch v.baseType {
+	case fitEnum, fitUint8, fitByte, fitUint8z:
+		if len(v.data) < 1 {
+			return 0, false
+		}
+		x, invalid = uint64(v.data[0]), 0xFF
+	case fitUint16, fitUint16z:
+		if len(v.data) < 2 {
+			return 0, false
+		}
+		x, invalid = uint64(m.order.Uint16(v.data)), 0xFFFF
+	case fitUint32, fitUint32z:
+		if len(v.data) < 4 {
+			return 0, false
+		}
+		x, invalid = uint64(m.order.Uint32(v.data)), 0xFFFFFFFF
+	case fitUint64, fitUint64z:
+		if len(v.data) < 8 {
+			return 0, false
+		}
+		x, invalid = m.order.Uint64(v.data), 0xFFFFFFFFFFFFFFFF
+	default:
+		return 0, false
+	}
+	switch v.baseType {
+	case fitUint8z, fitUint16z, fitUint32z, fitUint64z:
+		invalid = 0
+	}
+	return x, x != invalid
+}
+
+// sint is the signed counterpart of uint.
+func (m *fitMessage) sint(num byte) (int64, bool) {
+	v, ok := m.values[num]
+	if !ok {
+		return 0, false
+	}
+	switch v.baseType {
+	case fitSint8:
+		if len(v.data) >= 1 && v.data[0] != 0x7F {
+			return int64(int8(v.data[0])), true
+		}
+	case fitSint16:
+		if len(v.data) >= 2 {
+			if x := m.order.Uint16(v.data); x != 0x7FFF {
+				return int64(int16(x)), true
+			}
+		}
+	case fitSint32:
+		if len(v.data) >= 4 {
+			if x := m.order.Uint32(v.data); x != 0x7FFFFFFF {
+				return int64(int32(x)), true
+			}
+		}
+	case fitSint64:
+		if len(v.data) >= 8 {
+			if x := m.order.Uint64(v.data); x != 0x7FFFFFFFFFFFFFFF {
+				return int64(x), true
+			}
+		}
+	}
+	return 0, false
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC computes the CRC-16 defined by the FIT protocol.
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
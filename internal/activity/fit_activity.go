@@ -0,0 +1,294 @@
+package activity
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// global message numbers of the FIT profile
+const (
+	fitMesgSession = 18
+	fitMesgLap     = 19
+	fitMesgRecord  = 20
+	fitMesgSet     = 225
+)
+
+// fitEpoch is the zero point of FIT timestamps.
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// semicirclesToDegrees converts FIT positions (2^31 semicircles = 180°).
+const semicirclesToDegrees = 180.0 / (1 << 31)
+
+var fitSports = map[uint64]string{
+	1:  SportRun,
+	2:  SportRide,
+	5:  SportSwim,
+	10: SportStrength,
+	11: SportWalk,
+	15: SportRow,
+	17: SportHike,
+}
+
+// fitExerciseCategories names the exercise_category values of set messages.
+var fitExerciseCategories = []string{
+	"Bench Press", "Calf Raise", "Cardio", "Carry", "Chop", "Core", "Crunch", "Curl",
+	"Deadlift", "Flye", "Hip Raise", "Hip Stability", "Hip Swing", "Hyperextension",
+	"Lateral Raise", "Leg Curl", "Leg Raise", "Lunge", "Olympic Lift", "Plank", "Plyo",
+	"Pull Up", "Push Up", "Row", "Shoulder Press", "Shoulder Stability", "Shrug",
+	"Sit Up", "Squat", "Total Body", "Triceps Extension", "Warm Up", "Run",
+}
+
+const fitUnknownExercise = "Strength Exercise"
+
+// FitSummary holds the device totals of a session or lap message.
+type FitSummary struct {
+	Sport          string
+	StartTime      time.Time
+	EndTime        time.Time
+	ElapsedSeconds *float64
+	TimerSeconds   *float64
+	DistanceMeters *float64
+	Calories       *int
+	AvgHeartRate   *int
+	MaxHeartRate   *int
+	AscentMeters   *float64
+}
+
+// FitSet is a strength training set message. Rest periods are sets that
+// are not active.
+type FitSet struct {
+	StartTime       time.Time
+	Active          bool
+	Exercise        string
+	Reps            *int
+	WeightKg        *float64
+	DurationSeconds *float64
+}
+
+type FitActivity struct {
+	Track    Track
+	Sessions []FitSummary
+	Laps     []FitSummary
+	Sets     []FitSet
+}
+
+// ParseFIT decodes a FIT activity file and extracts its session, lap, record
+// and set messages. Records become the points of the track.
+func ParseFIT(r io.Reader) (*FitActivity, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := decodeFIT(data)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &FitActivity{Track: Track{Sport: SportOther}}
+	for i := range messages {
+		msg := &messages[i]
+		switch msg.global {
+		case fitMesgRecord:
+			a.Track.Points = append(a.Track.Points, fitRecord(msg))
+		case fitMesgSession:
+			a.Sessions = append(a.Sessions, fitSummary(msg, 7, 8, 9, 11, 16, 17, 22))
+		case fitMesgLap:
+			a.Laps = append(a.Laps, fitSummary(msg, 7, 8, 9, 11, 15, 16, 21))
+		case fitMesgSet:
+			a.Sets = append(a.Sets, fitSet(msg))
+		}
+	}
+	if len(a.Sessions) > 0 {
+		a.Track.Sport = a.Sessions[0].Sport
+	}
+	return a, nil
+}
+
+// Summary analyzes the recorded track and prefers the totals computed by the
+// device where the session message has them.
+func (a *FitActivity) Summary() (*Summary, error) {
+	summary, err := Analyze(&a.Track)
+	if err == ErrEmptyTrack && len(a.Sessions) > 0 {
+		summary = &Summary{Splits: []Split{}}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Sessions) == 0 {
+		return summary, nil
+	}
+
+	first, last := a.Sessions[0], a.Sessions[len(a.Sessions)-1]
+	if !first.StartTime.IsZero() {
+		summary.StartedAt = first.StartTime
+	}
+	if !last.EndTime.IsZero() {
+		summary.FinishedAt = last.EndTime
+	}
+	if summary.FinishedAt.Before(summary.StartedAt) {
+		summary.FinishedAt = summary.StartedAt
+	}
+
+	var elapsed, timer, distance, ascent float64
+	var hasElapsed, hasTimer, hasDistance, hasAscent bool
+	maxHR := 0
+	for _, s := range a.Sessions {
+		hasElapsed = addTotal(&elapsed, s.ElapsedSeconds) || hasElapsed
+		hasTimer = addTotal(&timer, s.TimerSeconds) || hasTimer
+		hasDistance = addTotal(&distance, s.DistanceMeters) || hasDistance
+		hasAscent = addTotal(&ascent, s.AscentMeters) || hasAscent
+		if s.MaxHeartRate != nil && *s.MaxHeartRate > maxHR {
+			maxHR = *s.MaxHeartRate
+		}
+	}
+	if hasElapsed {
+		summary.ElapsedSeconds = int(math.Round(elapsed))
+	} else {
+		summary.ElapsedSeconds = int(summary.FinishedAt.Sub(summary.StartedAt).Seconds())
+	}
+	if hasTimer {
+		summary.MovingSeconds = int(math.Round(timer))
+	}
+	if hasDistance {
+		summary.DistanceMeters = math.Round(distance*10) / 10
+	}
+	if hasAscent {
+		summary.ElevationGainMeters = ascent
+	}
+	if len(a.Sessions) == 1 && first.AvgHeartRate != nil {
+		summary.AvgHeartRate = first.AvgHeartRate
+	}
+	if maxHR > 0 {
+		summary.MaxHeartRate = &maxHR
+	}
+	return summary, nil
+}
+
+// Calories returns the energy expenditure reported by the device, or 0.
+func (a *FitActivity) Calories() int {
+	total := 0
+	for _, s := range a.Sessions {
+		if s.Calories != nil {
+			total += *s.Calories
+		}
+	}
+	return total
+}
+
+func addTotal(total *float64, v *float64) bool {
+	if v == nil {
+		return false
+	}
+	*total += *v
+	return true
+}
+
+func fitTime(seconds uint32) time.Time {
+	return fitEpoch.Add(time.Duration(seconds) * time.Second)
+}
+
+func fitRecord(msg *fitMessage) Point {
+	p := Point{}
+	if msg.timestamp != 0 {
+		p.Time = fitTime(msg.timestamp)
+	}
+	lat, okLat := msg.sint(0)
+	lon, okLon := msg.sint(1)
+	if okLat && okLon {
+		latDeg, lonDeg := float64(lat)*semicirclesToDegrees, float64(lon)*semicirclesToDegrees
+		p.Lat, p.Lon = &latDeg, &lonDeg
+	}
+	// enhanced_altitude supersedes altitude; both are scale 5, offset 500
+	if alt, ok := msg.uint(78); ok {
+		p.Elevation = scaled(alt, 5, 500)
+	} else if alt, ok := msg.uint(2); ok {
+		p.Elevation = scaled(alt, 5, 500)
+	}
+	if hr, ok := msg.uint(3); ok {
+		v := int(hr)
+		p.HeartRate = &v
+	}
+	if d, ok := msg.uint(5); ok {
+		p.Distance = scaled(d, 100, 0)
+	}
+	return p
+}
+
+// fitSummary reads the fields shared by session and lap messages, whose
+// field numbers differ between the two.
+func fitSummary(msg *fitMessage, elapsed, timer, distance, calories, avgHR, maxHR, ascent byte) FitSummary {
+	s := FitSummary{Sport: SportOther}
+	if sport, ok := msg.uint(5); ok && msg.global == fitMesgSession {
+		if name, ok := fitSports[sport]; ok {
+			s.Sport = name
+		}
+	}
+	if start, ok := msg.uint(2); ok {
+		s.StartTime = fitTime(uint32(start))
+	}
+	if msg.timestamp != 0 {
+		s.EndTime = fitTime(msg.timestamp)
+	}
+	if v, ok := msg.uint(elapsed); ok {
+		s.ElapsedSeconds = scaled(v, 1000, 0)
+	}
+	if v, ok := msg.uint(timer); ok {
+		s.TimerSeconds = scaled(v, 1000, 0)
+	}
+	if v, ok := msg.uint(distance); ok {
+		s.DistanceMeters = scaled(v, 100, 0)
+	}
+	if v, ok := msg.uint(ascent); ok {
+		s.AscentMeters = scaled(v, 1, 0)
+	}
+	s.Calories = intField(msg, calories)
+	s.AvgHeartRate = intField(msg, avgHR)
+	s.MaxHeartRate = intField(msg, maxHR)
+	return s
+}
+
+func fitSet(msg *fitMessage) FitSet {
+	set := FitSet{Exercise: fitUnknownExercise}
+	if start, ok := msg.uint(6); ok {
+		set.StartTime = fitTime(uint32(start))
+	} else if msg.timestamp != 0 {
+		set.StartTime = fitTime(msg.timestamp)
+	}
+	if t, ok := msg.uint(5); ok {
+		set.Active = t == 1
+	}
+	if c, ok := msg.uint(7); ok {
+		set.Exercise = fitExerciseName(c)
+	}
+	set.Reps = intField(msg, 3)
+	if w, ok := msg.uint(4); ok {
+		set.WeightKg = scaled(w, 16, 0)
+	}
+	if d, ok := msg.uint(0); ok {
+		set.DurationSeconds = scaled(d, 1000, 0)
+	}
+	return set
+}
+
+func fitExerciseName(category uint64) string {
+	if category < uint64(len(fitExerciseCategories)) {
+		return fitExerciseCategories[category]
+	}
+	return fitUnknownExercise
+}
+
+func intField(msg *fitMessage, num byte) *int {
+	v, ok := msg.uint(num)
+	if !ok {
+		return nil
+	}
+	i := int(v)
+	return &i
+}
+
+func scaled(v uint64, scale, offset float64) *float64 {
+	f := math.Round((float64(v)/scale-offset)*1000) / 1000
+	return &f
+}
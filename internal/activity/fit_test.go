@@ -0,0 +1,115 @@
+package activity
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+func TestFitCRC(t *testing.T) {
+	// check value of the FIT CRC-16 (CRC-16/ARC)
+	assert.Equal(t, uint16(0xBB3D), fitCRC([]byte("123456789")))
+}
+
+func TestParseFITRun(t *testing.T) {
+	a, err := ParseFIT(bytes.NewReader(readFixture(t, "run.fit")))
+	require.NoError(t, err)
+
+	assert.Equal(t, SportRun, a.Track.Sport)
+	require.Len(t, a.Track.Points, 31)
+	require.Len(t, a.Laps, 1)
+	require.Len(t, a.Sessions, 1)
+
+	// compressed timestamp headers advance from the last full timestamp
+	for i := 1; i < len(a.Track.Points); i++ {
+		assert.Equal(t, 10*time.Second, a.Track.Points[i].Time.Sub(a.Track.Points[i-1].Time))
+	}
+	first := a.Track.Points[0]
+	require.NotNil(t, first.Lat)
+	assert.InDelta(t, 45.0, *first.Lat, 1e-6)
+	assert.InDelta(t, 7.0, *first.Lon, 1e-6)
+	assert.InDelta(t, 200.0, *first.Elevation, 1e-9)
+	assert.Equal(t, 130, *first.HeartRate)
+
+	summary, err := a.Summary()
+	require.NoError(t, err)
+	assert.Equal(t, 1000.8, summary.DistanceMeters)
+	assert.Equal(t, 300, summary.ElapsedSeconds)
+	assert.Equal(t, 295, summary.MovingSeconds)
+	assert.Equal(t, 9.0, summary.ElevationGainMeters)
+	assert.Equal(t, 145, *summary.AvgHeartRate)
+	assert.Equal(t, 160, *summary.MaxHeartRate)
+	assert.NotEmpty(t, summary.Splits)
+	assert.Equal(t, 70, a.Calories())
+}
+
+func TestParseFITStrength(t *testing.T) {
+	a, err := ParseFIT(bytes.NewReader(readFixture(t, "strength.fit")))
+	require.NoError(t, err)
+
+	assert.Equal(t, SportStrength, a.Track.Sport)
+	assert.Empty(t, a.Track.Points)
+	require.Len(t, a.Sets, 7)
+
+	squat := a.Sets[0]
+	assert.True(t, squat.Active)
+	assert.Equal(t, "Squat", squat.Exercise)
+	assert.Equal(t, 5, *squat.Reps)
+	assert.Equal(t, 100.0, *squat.WeightKg)
+
+	rest := a.Sets[1]
+	assert.False(t, rest.Active)
+	assert.Nil(t, rest.Reps)
+	assert.Equal(t, 90.0, *rest.DurationSeconds)
+
+	assert.Equal(t, "Bench Press", a.Sets[4].Exercise)
+	assert.Equal(t, 60.0, *a.Sets[4].WeightKg)
+	plank := a.Sets[6]
+	assert.Equal(t, "Plank", plank.Exercise)
+	assert.Nil(t, plank.Reps)
+	assert.Equal(t, 60.0, *plank.DurationSeconds)
+
+	summary, err := a.Summary()
+	require.NoError(t, err)
+	assert.Equal(t, 1800, summary.ElapsedSeconds)
+	assert.Equal(t, 0.0, summary.DistanceMeters)
+	assert.Equal(t, 250, a.Calories())
+}
+
+func TestParseFITErrors(t *testing.T) {
+	run := readFixture(t, "run.fit")
+
+	corrupt := bytes.Clone(run)
+	corrupt[40] ^= 0xFF
+	badHeader := bytes.Clone(run)
+	badHeader[3] ^= 0xFF
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{name: "not a fit file", input: []byte("<gpx></gpx> not a fit file"), wantErr: ErrNotFit},
+		{name: "corrupted data", input: corrupt, wantErr: ErrFitCRC},
+		{name: "corrupted header", input: badHeader, wantErr: ErrFitCRC},
+		{name: "truncated", input: run[:len(run)-10], wantErr: errFitShort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFIT(bytes.NewReader(tt.input))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package activity
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat        float64  `xml:"lat,attr"`
+				Lon        float64  `xml:"lon,attr"`
+				Elevation  *float64 `xml:"ele"`
+				Time       string   `xml:"time"`
+				Extensions struct {
+					TrackPoint struct {
+						HeartRate *int `xml:"hr"`
+					} `xml:"TrackPointExtension"`
+				} `xml:"extensions"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX reads a GPX 1.1 document. All track segments are concatenated;
+// heart rate is read from the Garmin TrackPointExtension.
+func ParseGPX(r io.Reader) (*Track, error) {
+	var doc gpxFile
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("activity: invalid gpx: %w", err)
+	}
+
+	track := &Track{Name: doc.Metadata.Name, Sport: SportOther}
+	for _, trk := range doc.Tracks {
+		if trk.Name != "" {
+			track.Name = trk.Name
+		}
+		if trk.Type != "" {
+			track.Sport = normalizeSport(trk.Type)
+		}
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				lat, lon := pt.Lat, pt.Lon
+				point := Point{
+					Lat:       &lat,
+					Lon:       &lon,
+					Elevation: pt.Elevation,
+					HeartRate: pt.Extensions.TrackPoint.HeartRate,
+				}
+				if pt.Time != "" {
+					point.Time, err = time.Parse(time.RFC3339, strings.TrimSpace(pt.Time))
+					if err != nil {
+						return nil, fmt.Errorf("activity: invalid gpx time %q", pt.Time)
+					}
+				}
+				track.Points = append(track.Points, point)
+			}
+		}
+	}
+	return track, nil
+}
+
+func normalizeSport(sport string) string {
+	s := strings.ToLower(sport)
+	switch {
+	case strings.Contains(s, "run"):
+		return SportRun
+	case strings.Contains(s, "bik") || strings.Contains(s, "cycl") || strings.Contains(s, "ride"):
+		return SportRide
+	case strings.Contains(s, "hik"):
+		return SportHike
+	case strings.Contains(s, "walk"):
+		return SportWalk
+	case strings.Contains(s, "swim"):
+		return SportSwim
+	case strings.Contains(s, "row"):
+		return SportRow
+	}
+	return SportOther
+}
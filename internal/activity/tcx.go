@@ -0,0 +1,70 @@
+package activity
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Id    string `xml:"Id"`
+		Laps  []struct {
+			Tracks []struct {
+				Points []struct {
+					Time     string `xml:"Time"`
+					Position *struct {
+						Lat float64 `xml:"LatitudeDegrees"`
+						Lon float64 `xml:"LongitudeDegrees"`
+					} `xml:"Position"`
+					Altitude  *float64 `xml:"AltitudeMeters"`
+					Distance  *float64 `xml:"DistanceMeters"`
+					HeartRate *struct {
+						Value int `xml:"Value"`
+					} `xml:"HeartRateBpm"`
+				} `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// ParseTCX reads a Garmin Training Center document. The laps of every
+// activity are concatenated into a single track.
+func ParseTCX(r io.Reader) (*Track, error) {
+	var doc tcxFile
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("activity: invalid tcx: %w", err)
+	}
+
+	track := &Track{Sport: SportOther}
+	for _, act := range doc.Activities {
+		track.Sport = normalizeSport(act.Sport)
+		for _, lap := range act.Laps {
+			for _, trk := range lap.Tracks {
+				for _, tp := range trk.Points {
+					point := Point{Elevation: tp.Altitude, Distance: tp.Distance}
+					if tp.Position != nil {
+						lat, lon := tp.Position.Lat, tp.Position.Lon
+						point.Lat, point.Lon = &lat, &lon
+					}
+					if tp.HeartRate != nil {
+						hr := tp.HeartRate.Value
+						point.HeartRate = &hr
+					}
+					if tp.Time != "" {
+						point.Time, err = time.Parse(time.RFC3339, strings.TrimSpace(tp.Time))
+						if err != nil {
+							return nil, fmt.Errorf("activity: invalid tcx time %q", tp.Time)
+						}
+					}
+					track.Points = append(track.Points, point)
+				}
+			}
+		}
+	}
+	return track, nil
+}
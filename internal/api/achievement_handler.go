@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Naveenravi07/go-api/internal/achievements"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+type AchievementHandler struct {
+	engine *achievements.Engine
+	logger *log.Logger
+}
+
+func NewAchievementHandler(engine *achievements.Engine, logger *log.Logger) *AchievementHandler {
+	return &AchievementHandler{
+		engine: engine,
+		logger: logger,
+	}
+}
+
+// HandleListAchievements lists earned and in-progress achievements with the
+// weekly streak. Evaluating on read also awards anything earned by workouts
+// logged before the rule existed.
+func (ah *AchievementHandler) HandleListAchievements(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	summary, err := ah.engine.Evaluate(middleware.GetUser(r).Id)
+	if err != nil {
+		ah.logger.Printf("ERROR: evaluating achievements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for _, list := range [][]achievements.Achievement{summary.Earned, summary.InProgress} {
+		for i := range list {
+			if list[i].Metric == achievements.MetricLifetimeVolume {
+				list[i].Current = units.Convert(list[i].Current, units.Canonical, outUnit)
+				list[i].Threshold = units.Convert(list[i].Threshold, units.Canonical, outUnit)
+			}
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": summary, "weight_unit": outUnit})
+}
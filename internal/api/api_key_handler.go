@@ -0,0 +1,120 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/apikeys"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *log.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		logger:      logger,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name   string     `json:"name"`
+	Scopes []string   `json:"scopes"`
+	Expiry *time.Time `json:"expiry"`
+}
+
+func validateAPIKey(req *createAPIKeyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return errors.New("name is required and must be at most 100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !apikeys.Scope(scope).Valid() {
+			return errors.New("unknown scope " + scope)
+		}
+	}
+	if req.Expiry != nil && !req.Expiry.After(time.Now()) {
+		return errors.New("expiry must be in the future")
+	}
+	return nil
+}
+
+// HandleCreateAPIKey returns the full key. It is not stored and cannot be
+// shown again.
+func (ah *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ah.logger.Printf("ERROR: decoding create api key body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if err := validateAPIKey(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	generated, err := apikeys.Generate()
+	if err != nil {
+		ah.logger.Printf("ERROR: generating api key: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	key, err := ah.apiKeyStore.CreateAPIKey(&store.APIKey{
+		UserId: middleware.GetUser(r).Id,
+		Name:   req.Name,
+		Prefix: generated.Prefix,
+		Hash:   generated.Hash,
+		Scopes: req.Scopes,
+		Expiry: req.Expiry,
+	})
+	if err != nil {
+		ah.logger.Printf("ERROR: CreateAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": key, "api_key": generated.Plaintext})
+}
+
+func (ah *APIKeyHandler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := ah.apiKeyStore.GetAPIKeys(middleware.GetUser(r).Id)
+	if err != nil {
+		ah.logger.Printf("ERROR: GetAPIKeys: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": keys})
+}
+
+func (ah *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyId, err := utils.ReadIdParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid api key id"})
+		return
+	}
+
+	err = ah.apiKeyStore.DeleteAPIKey(keyId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "api key not found"})
+		return
+	}
+	if err != nil {
+		ah.logger.Printf("ERROR: DeleteAPIKey: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "api key deleted successfully"})
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Naveenravi07/go-api/internal/authz"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+type ChallengeHandler struct {
+	challengeStore    store.ChallengeStore
+	organizationStore store.OrganizationStore
+	logger            *log.Logger
+}
+
+func NewChallengeHandler(challengeStore store.ChallengeStore, organizationStore store.OrganizationStore, logger *log.Logger) *ChallengeHandler {
+	return &ChallengeHandler{
+		challengeStore:    challengeStore,
+		organizationStore: organizationStore,
+		logger:            logger,
+	}
+}
+
+// HandleCreateChallenge creates an open challenge, or one limited to the
+// members of organization_id when it is set. Only owners and coaches create
+// organization challenges.
+func (ch *ChallengeHandler) HandleCreateChallenge(w http.ResponseWriter, r *http.Request) {
+	var challenge store.Challenge
+	err := json.NewDecoder(r.Body).Decode(&challenge)
+	if err != nil {
+		ch.logger.Printf("ERROR: decoding create challenge body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	challenge.Title = strings.TrimSpace(challenge.Title)
+	if err := challenge.Validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if challenge.OrganizationId != nil {
+		role, err := ch.organizationStore.GetMemberRole(int64(*challenge.OrganizationId), user.Id)
+		if err == sql.ErrNoRows {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "organization did not exist"})
+			return
+		}
+		if err != nil {
+			ch.logger.Printf("ERROR: GetMemberRole: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if !authz.Permits(role, authz.ManageChallenges) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your role does not allow this action"})
+			return
+		}
+	}
+
+	challenge.CreatedBy = user.Id
+	created, err := ch.challengeStore.CreateChallenge(&challenge)
+	if err != nil {
+		ch.logger.Printf("ERROR: CreateChallenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create challenge"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": created})
+}
+
+func (ch *ChallengeHandler) HandleListChallenges(w http.ResponseWriter, r *http.Request) {
+	challenges, err := ch.challengeStore.GetChallengesForUser(middleware.GetUser(r).Id)
+	if err != nil {
+		ch.logger.Printf("ERROR: GetChallengesForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": challenges})
+}
+
+func (ch *ChallengeHandler) HandleGetChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := ch.readChallenge(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": challenge})
+}
+
+// HandleLeaderboard returns the ranked standings. Volume scores are returned
+// in the display unit.
+func (ch *ChallengeHandler) HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	challenge, ok := ch.readChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	standings, err := ch.challengeStore.GetStandings(int64(challenge.Id))
+	if err != nil {
+		ch.logger.Printf("ERROR: GetStandings: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if challenge.Weighted() {
+		for i := range standings {
+			standings[i].ConvertWeights(units.Canonical, outUnit)
+		}
+		challenge.WeightUnit = outUnit
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{"challenge": challenge, "standings": standings}})
+}
+
+func (ch *ChallengeHandler) HandleJoinChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := ch.readChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	err := ch.challengeStore.JoinChallenge(int64(challenge.Id), middleware.GetUser(r).Id)
+	if errors.Is(err, store.ErrChallengeEnded) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: JoinChallenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "you joined " + challenge.Title})
+}
+
+func (ch *ChallengeHandler) HandleLeaveChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, ok := ch.readChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	err := ch.challengeStore.LeaveChallenge(int64(challenge.Id), middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you are not taking part in this challenge"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: LeaveChallenge: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "you left " + challenge.Title})
+}
+
+// readChallenge reads the challenge of the id param. Organization challenges
+// are reported as missing to non members.
+func (ch *ChallengeHandler) readChallenge(w http.ResponseWriter, r *http.Request) (*store.Challenge, bool) {
+	challengeId, err := utils.ReadIdParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid challenge id"})
+		return nil, false
+	}
+
+	user := middleware.GetUser(r)
+	challenge, err := ch.challengeStore.GetChallengeById(challengeId, user.Id)
+	if err == nil && challenge.OrganizationId != nil {
+		_, err = ch.organizationStore.GetMemberRole(int64(*challenge.OrganizationId), user.Id)
+	}
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "challenge did not exist"})
+		return nil, false
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: reading challenge: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return challenge, true
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/moderation"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type CommentHandler struct {
+	commentStore store.CommentStore
+	workoutStore store.WorkoutStore
+	moderator    moderation.Hook
+	logger       *log.Logger
+}
+
+func NewCommentHandler(commentStore store.CommentStore, workoutStore store.WorkoutStore, moderator moderation.Hook, logger *log.Logger) *CommentHandler {
+	return &CommentHandler{
+		commentStore: commentStore,
+		workoutStore: workoutStore,
+		moderator:    moderator,
+		logger:       logger,
+	}
+}
+
+type commentRequest struct {
+	Body     string `json:"body"`
+	ParentId *int   `json:"parent_id"`
+}
+
+func (ch *CommentHandler) HandleListComments(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := ch.readVisibleWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	comments, err := ch.commentStore.GetComments(workoutId, middleware.GetUser(r).Id)
+	if err != nil {
+		ch.logger.Printf("ERROR: GetComments: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": comments})
+}
+
+func (ch *CommentHandler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+	workoutId, ok := ch.readVisibleWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	var req commentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Printf("ERROR: decoding create comment body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	comment := &store.Comment{
+		WorkoutId: int(workoutId),
+		UserId:    middleware.GetUser(r).Id,
+		ParentId:  req.ParentId,
+		Body:      req.Body,
+	}
+	if !ch.moderate(w, comment) {
+		return
+	}
+
+	created, err := ch.commentStore.CreateComment(comment)
+	if errors.Is(err, store.ErrInvalidParent) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: CreateComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create comment"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": created})
+}
+
+func (ch *CommentHandler) HandleUpdateComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := ch.readComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.UserId != middleware.GetUser(r).Id {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to edit this comment"})
+		return
+	}
+
+	var req commentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Printf("ERROR: decoding update comment body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	comment.Body = req.Body
+	if !ch.moderate(w, comment) {
+		return
+	}
+	err = ch.commentStore.UpdateComment(comment)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment did not exist"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: UpdateComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update comment"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": comment})
+}
+
+func (ch *CommentHandler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	commentId, err := utils.ReadIdParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid comment id"})
+		return
+	}
+
+	err = ch.commentStore.DeleteComment(commentId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment did not exist"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: DeleteComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "comment deleted successfully"})
+}
+
+// HandleApproveComment lets the workout owner publish a comment that was held
+// by moderation.
+func (ch *CommentHandler) HandleApproveComment(w http.ResponseWriter, r *http.Request) {
+	commentId, err := utils.ReadIdParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid comment id"})
+		return
+	}
+
+	err = ch.commentStore.ApproveComment(commentId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no held comment found on your workouts"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: ApproveComment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "comment approved"})
+}
+
+func (ch *CommentHandler) HandleAddReaction(w http.ResponseWriter, r *http.Request) {
+	workoutId, kind, ok := ch.readReaction(w, r)
+	if !ok {
+		return
+	}
+
+	err := ch.commentStore.AddReaction(workoutId, middleware.GetUser(r).Id, kind)
+	if err != nil {
+		ch.logger.Printf("ERROR: AddReaction: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "reaction added"})
+}
+
+func (ch *CommentHandler) HandleRemoveReaction(w http.ResponseWriter, r *http.Request) {
+	workoutId, kind, ok := ch.readReaction(w, r)
+	if !ok {
+		return
+	}
+
+	err := ch.commentStore.RemoveReaction(workoutId, middleware.GetUser(r).Id, kind)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "reaction did not exist"})
+		return
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: RemoveReaction: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "reaction removed"})
+}
+
+// moderate validates the comment and runs the moderation hooks on it,
+// marking it held when a hook asks for review.
+func (ch *CommentHandler) moderate(w http.ResponseWriter, comment *store.Comment) bool {
+	if err := comment.Validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return false
+	}
+
+	decision, err := ch.moderator.Review(comment.Body)
+	if err != nil {
+		ch.logger.Printf("ERROR: moderating comment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	switch decision.Verdict {
+	case moderation.Reject:
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "comment rejected: " + decision.Reason})
+		return false
+	case moderation.Hold:
+		comment.Status, comment.ModerationReason = store.CommentHeld, decision.Reason
+	default:
+		comment.Status, comment.ModerationReason = store.CommentVisible, ""
+	}
+	return true
+}
+
+// readVisibleWorkout reads the workout id and hides workouts the current
+// user may not see.
+func (ch *CommentHandler) readVisibleWorkout(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id "})
+		return 0, false
+	}
+
+	visible, err := ch.workoutStore.CanViewWorkout(workoutId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows || (err == nil && !visible) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout did not exist "})
+		return 0, false
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: CanViewWorkout: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, false
+	}
+	return workoutId, true
+}
+
+func (ch *CommentHandler) readComment(w http.ResponseWriter, r *http.Request) (*store.Comment, bool) {
+	commentId, err := utils.ReadIdParam(r)
+	if err != nil {
+		ch.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid comment id"})
+		return nil, false
+	}
+
+	comment, err := ch.commentStore.GetCommentById(commentId)
+	if err == sql.ErrNoRows || (err == nil && comment.Deleted) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "comment did not exist"})
+		return nil, false
+	}
+	if err != nil {
+		ch.logger.Printf("ERROR: GetCommentById: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return comment, true
+}
+
+func (ch *CommentHandler) readReaction(w http.ResponseWriter, r *http.Request) (int64, store.ReactionKind, bool) {
+	kind, err := store.ParseReactionKind(chi.URLParam(r, "kind"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return 0, "", false
+	}
+	workoutId, ok := ch.readVisibleWorkout(w, r)
+	if !ok {
+		return 0, "", false
+	}
+	return workoutId, kind, true
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+type GoalHandler struct {
+	goalStore store.GoalStore
+	logger    *log.Logger
+}
+
+func NewGoalHandler(goalStore store.GoalStore, logger *log.Logger) *GoalHandler {
+	return &GoalHandler{
+		goalStore: goalStore,
+		logger:    logger,
+	}
+}
+
+func (gh *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	var goal store.Goal
+	err := json.NewDecoder(r.Body).Decode(&goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: decoding create goal body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	unit, outUnit, ok := readUnits(w, r, goal.WeightUnit)
+	if !ok {
+		return
+	}
+	goal.ConvertWeights(unit, units.Canonical)
+	if err := goal.Validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	goal.UserId = middleware.GetUser(r).Id
+	created, err := gh.goalStore.CreateGoal(&goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: CreateGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create goal"})
+		return
+	}
+	if !gh.evaluate(w, created) {
+		return
+	}
+	created.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": created})
+}
+
+func (gh *GoalHandler) HandleListGoals(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	goals, err := gh.goalStore.GetGoalsForUser(middleware.GetUser(r).Id)
+	if err != nil {
+		gh.logger.Printf("ERROR: GetGoalsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for i := range goals {
+		if !gh.evaluate(w, &goals[i]) {
+			return
+		}
+		goals[i].ConvertWeights(units.Canonical, outUnit)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": goals})
+}
+
+func (gh *GoalHandler) HandleGetGoal(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	goal, ok := gh.readOwnGoal(w, r)
+	if !ok || !gh.evaluate(w, goal) {
+		return
+	}
+	goal.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": goal})
+}
+
+func (gh *GoalHandler) HandleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	existing, ok := gh.readOwnGoal(w, r)
+	if !ok {
+		return
+	}
+
+	var goal store.Goal
+	err := json.NewDecoder(r.Body).Decode(&goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: decoding update goal body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	unit, outUnit, ok := readUnits(w, r, goal.WeightUnit)
+	if !ok {
+		return
+	}
+	goal.ConvertWeights(unit, units.Canonical)
+
+	// the kind of goal is fixed once created
+	goal.Id, goal.UserId, goal.Type, goal.CreatedAt = existing.Id, existing.UserId, existing.Type, existing.CreatedAt
+	if goal.StartsAt.IsZero() {
+		goal.StartsAt = existing.StartsAt
+	}
+	if goal.StartValue == nil {
+		goal.StartValue = existing.StartValue
+	}
+	if err := goal.Validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	err = gh.goalStore.UpdateGoal(&goal)
+	if err != nil {
+		gh.logger.Printf("ERROR: UpdateGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update goal"})
+		return
+	}
+	if !gh.evaluate(w, &goal) {
+		return
+	}
+	goal.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": goal})
+}
+
+func (gh *GoalHandler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	goalId, err := utils.ReadIdParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid goal id "})
+		return
+	}
+
+	err = gh.goalStore.DeleteGoal(goalId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal did not exist "})
+		return
+	}
+	if err != nil {
+		gh.logger.Printf("ERROR: DeleteGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "goal deleted successfully"})
+}
+
+func (gh *GoalHandler) evaluate(w http.ResponseWriter, goal *store.Goal) bool {
+	err := gh.goalStore.EvaluateGoal(goal, time.Now().UTC())
+	if err != nil {
+		gh.logger.Printf("ERROR: EvaluateGoal: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	return true
+}
+
+func (gh *GoalHandler) readOwnGoal(w http.ResponseWriter, r *http.Request) (*store.Goal, bool) {
+	goalId, err := utils.ReadIdParam(r)
+	if err != nil {
+		gh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid goal id "})
+		return nil, false
+	}
+
+	goal, err := gh.goalStore.GetGoalById(goalId)
+	if err == sql.ErrNoRows || (err == nil && goal.UserId != middleware.GetUser(r).Id) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "goal did not exist "})
+		return nil, false
+	}
+	if err != nil {
+		gh.logger.Printf("ERROR: GetGoalById: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return goal, true
+}
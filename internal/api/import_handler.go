@@ -0,0 +1,260 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Naveenravi07/go-api/internal/activity"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+const maxActivityFileBytes = 25 << 20
+
+func (wh *WorkoutHandler) HandleImportGPX(w http.ResponseWriter, r *http.Request) {
+	wh.importActivity(w, r, "GPX", activity.ParseGPX)
+}
+
+func (wh *WorkoutHandler) HandleImportTCX(w http.ResponseWriter, r *http.Request) {
+	wh.importActivity(w, r, "TCX", activity.ParseTCX)
+}
+
+func (wh *WorkoutHandler) importActivity(w http.ResponseWriter, r *http.Request, format string, parse func(io.Reader) (*activity.Track, error)) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	body, err := activityFile(w, r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	track, err := parse(body)
+	if err != nil {
+		wh.logger.Printf("ERROR: parse %s: %v", format, err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	summary, err := activity.Analyze(track)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if summary.DistanceMeters <= 0 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "track has no distance"})
+		return
+	}
+
+	wh.createImportedWorkout(w, r, importedWorkout(track, summary, format), track, summary, outUnit)
+}
+
+// HandleImportFIT imports a FIT activity. Distance activities become a
+// distance entry like GPX and TCX imports, strength training set messages
+// become entries with one set detail per set.
+func (wh *WorkoutHandler) HandleImportFIT(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	body, err := activityFile(w, r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+
+	fit, err := activity.ParseFIT(body)
+	if err != nil {
+		wh.logger.Printf("ERROR: parse FIT: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	summary, err := fit.Summary()
+	if err != nil {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workout := importedWorkout(&fit.Track, summary, "FIT")
+	strength, err := strengthEntries(fit.Sets, len(workout.Entries))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	workout.Entries = append(workout.Entries, strength...)
+	if len(workout.Entries) == 0 {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "activity has no distance or strength sets"})
+		return
+	}
+	workout.CaloriesBurned = fit.Calories()
+
+	wh.createImportedWorkout(w, r, workout, &fit.Track, summary, outUnit)
+}
+
+func (wh *WorkoutHandler) createImportedWorkout(w http.ResponseWriter, r *http.Request, workout *store.Workout, track *activity.Track, summary *activity.Summary, outUnit units.WeightUnit) {
+	workout.UserId = middleware.GetUser(r).Id
+	createdWorkout, err := wh.workoutStore.CreateWorkoutWithTrack(workout, trackPoints(track))
+	if err != nil {
+		wh.logger.Printf("ERROR: failed to import workout %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	createdWorkout.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdWorkout, "summary": summary})
+}
+
+// activityFile returns the uploaded file of a multipart form ("file" field)
+// or the raw request body.
+func activityFile(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxActivityFileBytes)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.Body, nil
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("multipart upload must contain a file field")
+	}
+	return file, nil
+}
+
+func importedWorkout(track *activity.Track, summary *activity.Summary, format string) *store.Workout {
+	startedAt, finishedAt := summary.StartedAt, summary.FinishedAt
+	title := track.Name
+	if title == "" {
+		title = fmt.Sprintf("%s on %s", track.Sport, startedAt.Format("2006-01-02"))
+	}
+
+	var entries []store.WorkoutEntry
+	if summary.DistanceMeters > 0 {
+		distance := summary.DistanceMeters
+		entry := store.WorkoutEntry{
+			ExerciseName:   track.Sport,
+			DistanceMeters: &distance,
+			AvgHeartRate:   summary.AvgHeartRate,
+			MaxHeartRate:   summary.MaxHeartRate,
+			Notes:          splitNotes(summary.Splits),
+			OrderIndex:     1,
+		}
+		if summary.MovingSeconds > 0 {
+			moving := summary.MovingSeconds
+			entry.DurationSeconds = &moving
+		}
+		if summary.ElevationGainMeters > 0 {
+			gain := summary.ElevationGainMeters
+			entry.ElevationGainMeters = &gain
+		}
+		entries = append(entries, entry)
+	}
+
+	return &store.Workout{
+		Title:           title,
+		Description:     "Imported from " + format,
+		DurationMinutes: int(math.Ceil(float64(summary.ElapsedSeconds) / 60)),
+		StartedAt:       &startedAt,
+		FinishedAt:      &finishedAt,
+		Entries:         entries,
+	}
+}
+
+// splitNotes summarizes the per kilometer splits, e.g.
+// "Splits /km: 4:58, 5:02, 5:10 (0.4 km)".
+func splitNotes(splits []activity.Split) string {
+	if len(splits) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(splits))
+	for _, split := range splits {
+		part := activity.FormatPace(split.PaceSecondsKm)
+		if split.DistanceMeters < 1000 {
+			part += fmt.Sprintf(" (%.1f km)", split.DistanceMeters/1000)
+		}
+		parts = append(parts, part)
+	}
+	return "Splits /km: " + strings.Join(parts, ", ")
+}
+
+// strengthEntries collapses the active sets of a FIT file into entries, in
+// the order the exercises were performed. The rest period following a set is
+// recorded as its rest time.
+func strengthEntries(sets []activity.FitSet, orderOffset int) ([]store.WorkoutEntry, error) {
+	var sessionSets []store.SessionSet
+	for _, set := range sets {
+		if !set.Active {
+			if n := len(sessionSets); n > 0 && set.DurationSeconds != nil {
+				rest := int(math.Round(*set.DurationSeconds))
+				sessionSets[n-1].RestSeconds = &rest
+			}
+			continue
+		}
+
+		sessionSet := store.SessionSet{ExerciseName: set.Exercise, Reps: set.Reps, Weight: set.WeightKg}
+		if set.Reps == nil {
+			if set.DurationSeconds == nil {
+				continue
+			}
+			duration := int(math.Round(*set.DurationSeconds))
+			sessionSet.DurationSeconds = &duration
+		}
+		sessionSets = append(sessionSets, sessionSet)
+	}
+
+	entries, err := store.CollapseSets(sessionSets)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].OrderIndex += orderOffset
+	}
+	return entries, nil
+}
+
+func trackPoints(track *activity.Track) []store.TrackPoint {
+	points := make([]store.TrackPoint, 0, len(track.Points))
+	for _, p := range track.Points {
+		if p.Time.IsZero() {
+			continue
+		}
+		points = append(points, store.TrackPoint{
+			RecordedAt:     p.Time,
+			Latitude:       p.Lat,
+			Longitude:      p.Lon,
+			Elevation:      p.Elevation,
+			HeartRate:      p.HeartRate,
+			DistanceMeters: p.Distance,
+		})
+	}
+	return points
+}
+
+func (wh *WorkoutHandler) HandleWorkoutTrack(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id "})
+		return
+	}
+	if !wh.authorizeView(w, r, workoutId) {
+		return
+	}
+
+	points, err := wh.workoutStore.GetWorkoutTrack(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetWorkoutTrack: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": points})
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+const (
+	defaultTrendDays   = 90
+	defaultTrendWindow = 7
+)
+
+type MeasurementHandler struct {
+	measurementStore store.MeasurementStore
+	logger           *log.Logger
+}
+
+func NewMeasurementHandler(measurementStore store.MeasurementStore, logger *log.Logger) *MeasurementHandler {
+	return &MeasurementHandler{
+		measurementStore: measurementStore,
+		logger:           logger,
+	}
+}
+
+func (mh *MeasurementHandler) HandleCreateMeasurement(w http.ResponseWriter, r *http.Request) {
+	var measurement store.Measurement
+	err := json.NewDecoder(r.Body).Decode(&measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: decoding create measurement body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	unit, outUnit, ok := readUnits(w, r, measurement.WeightUnit)
+	if !ok {
+		return
+	}
+	measurement.ConvertWeights(unit, units.Canonical)
+	if err := measurement.Validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurement.UserId = middleware.GetUser(r).Id
+	created, err := mh.measurementStore.CreateMeasurement(&measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: CreateMeasurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create measurement"})
+		return
+	}
+	created.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": created})
+}
+
+func (mh *MeasurementHandler) HandleListMeasurements(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	from, err := readTimeParam(r, "from")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	to, err := readTimeParam(r, "to")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurements, err := mh.measurementStore.GetMeasurements(middleware.GetUser(r).Id, from, to)
+	if err != nil {
+		mh.logger.Printf("ERROR: GetMeasurements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for i := range measurements {
+		measurements[i].ConvertWeights(units.Canonical, outUnit)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": measurements})
+}
+
+func (mh *MeasurementHandler) HandleGetMeasurement(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	measurement, ok := mh.readOwnMeasurement(w, r)
+	if !ok {
+		return
+	}
+	measurement.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": measurement})
+}
+
+func (mh *MeasurementHandler) HandleUpdateMeasurement(w http.ResponseWriter, r *http.Request) {
+	existing, ok := mh.readOwnMeasurement(w, r)
+	if !ok {
+		return
+	}
+
+	var measurement store.Measurement
+	err := json.NewDecoder(r.Body).Decode(&measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: decoding update measurement body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	unit, outUnit, ok := readUnits(w, r, measurement.WeightUnit)
+	if !ok {
+		return
+	}
+	measurement.ConvertWeights(unit, units.Canonical)
+	if err := measurement.Validate(); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	measurement.Id = existing.Id
+	measurement.UserId = existing.UserId
+	measurement.CreatedAt = existing.CreatedAt
+	if measurement.MeasuredAt.IsZero() {
+		measurement.MeasuredAt = existing.MeasuredAt
+	}
+	err = mh.measurementStore.UpdateMeasurement(&measurement)
+	if err != nil {
+		mh.logger.Printf("ERROR: UpdateMeasurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update measurement"})
+		return
+	}
+	measurement.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": measurement})
+}
+
+func (mh *MeasurementHandler) HandleDeleteMeasurement(w http.ResponseWriter, r *http.Request) {
+	measurementId, err := utils.ReadIdParam(r)
+	if err != nil {
+		mh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid measurement id "})
+		return
+	}
+
+	err = mh.measurementStore.DeleteMeasurement(measurementId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement did not exist "})
+		return
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: DeleteMeasurement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "measurement deleted successfully"})
+}
+
+// HandleMovingAverage returns the series of one metric with its trailing
+// moving average, e.g. ?metric=bodyweight&window=7&days=90.
+func (mh *MeasurementHandler) HandleMovingAverage(w http.ResponseWriter, r *http.Request) {
+	metric, points, ok := mh.readSeries(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": points, "metric": metric})
+}
+
+// HandleTrend summarizes how one metric changed over the requested period.
+func (mh *MeasurementHandler) HandleTrend(w http.ResponseWriter, r *http.Request) {
+	metric, points, ok := mh.readSeries(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": store.ComputeTrend(metric, points)})
+}
+
+func (mh *MeasurementHandler) readSeries(w http.ResponseWriter, r *http.Request) (string, []store.TrendPoint, bool) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	if metric == "" {
+		metric = store.MetricBodyweight
+	}
+	if !store.IsMeasurementMetric(metric) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown metric " + metric})
+		return "", nil, false
+	}
+	days, err := readPositiveInt(query.Get("days"), defaultTrendDays)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "days " + err.Error()})
+		return "", nil, false
+	}
+	window, err := readPositiveInt(query.Get("window"), defaultTrendWindow)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "window " + err.Error()})
+		return "", nil, false
+	}
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return "", nil, false
+	}
+
+	// load one extra window so the first averages of the period are complete
+	windowSpan := time.Duration(window) * 24 * time.Hour
+	periodStart := time.Now().UTC().AddDate(0, 0, -days)
+	loadFrom := periodStart.Add(-windowSpan)
+	measurements, err := mh.measurementStore.GetMeasurements(middleware.GetUser(r).Id, &loadFrom, nil)
+	if err != nil {
+		mh.logger.Printf("ERROR: GetMeasurements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return "", nil, false
+	}
+	for i := range measurements {
+		measurements[i].ConvertWeights(units.Canonical, outUnit)
+	}
+
+	points := store.MovingAverages(measurements, metric, windowSpan)
+	inPeriod := []store.TrendPoint{}
+	for _, p := range points {
+		if !p.MeasuredAt.Before(periodStart) {
+			inPeriod = append(inPeriod, p)
+		}
+	}
+	return metric, inPeriod, true
+}
+
+func (mh *MeasurementHandler) readOwnMeasurement(w http.ResponseWriter, r *http.Request) (*store.Measurement, bool) {
+	measurementId, err := utils.ReadIdParam(r)
+	if err != nil {
+		mh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid measurement id "})
+		return nil, false
+	}
+
+	measurement, err := mh.measurementStore.GetMeasurementById(measurementId)
+	if err == sql.ErrNoRows || (err == nil && measurement.UserId != middleware.GetUser(r).Id) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "measurement did not exist "})
+		return nil, false
+	}
+	if err != nil {
+		mh.logger.Printf("ERROR: GetMeasurementById: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	return measurement, true
+}
+
+// readTimeParam reads an optional RFC 3339 timestamp or date (2006-01-02)
+// query parameter.
+func readTimeParam(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, errors.New(name + " must be an RFC 3339 timestamp or a date")
+}
+
+func readPositiveInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errors.New("must be a positive integer")
+	}
+	return n, nil
+}
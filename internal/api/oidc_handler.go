@@ -0,0 +1,236 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/jwt"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/oidc"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/tokens"
+	"github.com/Naveenravi07/go-api/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+)
+
+type OIDCHandler struct {
+	providers         map[string]*oidc.Provider
+	identityStore     store.IdentityStore
+	refreshTokenStore store.RefreshTokenStore
+	twoFactorStore    store.TwoFactorStore
+	accessTokens      *jwt.KeySet
+	logger            *log.Logger
+}
+
+func NewOIDCHandler(providers []*oidc.Provider, identityStore store.IdentityStore, refreshTokenStore store.RefreshTokenStore,
+	twoFactorStore store.TwoFactorStore, accessTokens *jwt.KeySet, logger *log.Logger) *OIDCHandler {
+	byName := map[string]*oidc.Provider{}
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &OIDCHandler{
+		providers:         byName,
+		identityStore:     identityStore,
+		refreshTokenStore: refreshTokenStore,
+		twoFactorStore:    twoFactorStore,
+		accessTokens:      accessTokens,
+		logger:            logger,
+	}
+}
+
+func (oh *OIDCHandler) readProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := oh.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "unknown identity provider"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// HandleLogin redirects to the provider's sign in page. Signed in users link
+// the identity to their account instead of signing in with it. The state is
+// also set as a cookie so the callback only completes in the browser that
+// started the sign in.
+func (oh *OIDCHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oh.readProvider(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		oh.logger.Printf("ERROR: creating oidc auth request: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), req)
+	if err != nil {
+		oh.logger.Printf("ERROR: oidc AuthCodeURL: %v", err)
+		utils.WriteJSON(w, http.StatusBadGateway, utils.Envelope{"error": "identity provider is unavailable"})
+		return
+	}
+
+	err = oh.identityStore.CreateLoginState(&store.LoginState{
+		Provider:     provider.Name(),
+		State:        req.State,
+		Nonce:        req.Nonce,
+		CodeVerifier: req.CodeVerifier,
+		UserId:       middleware.GetUser(r).Id,
+	}, oidcStateTTL)
+	if err != nil {
+		oh.logger.Printf("ERROR: CreateLoginState: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    req.State,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleCallback finishes the sign in. It signs in the user the identity is
+// linked to, links it to the user who started the flow, or creates a new
+// account on the first sign in.
+func (oh *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oh.readProvider(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "sign in was not completed: " + providerErr})
+		return
+	}
+	state, code := query.Get("state"), query.Get("code")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || code == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid sign in state"})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	login, err := oh.identityStore.ConsumeLoginState(provider.Name(), state)
+	if errors.Is(err, store.ErrTokenInvalid) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "sign in expired, please try again"})
+		return
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: ConsumeLoginState: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	idToken, err := provider.Exchange(r.Context(), code, &oidc.AuthRequest{State: state, Nonce: login.Nonce, CodeVerifier: login.CodeVerifier})
+	if err != nil {
+		oh.logger.Printf("ERROR: oidc exchange with %s: %v", provider.Name(), err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "sign in with " + provider.Name() + " failed"})
+		return
+	}
+	identity := &store.Identity{Provider: provider.Name(), Subject: idToken.Subject, Email: idToken.Email}
+
+	if login.UserId != 0 {
+		identity.UserId = login.UserId
+		err = oh.identityStore.LinkIdentity(identity)
+		if errors.Is(err, store.ErrIdentityLinked) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			oh.logger.Printf("ERROR: LinkIdentity: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": identity})
+		return
+	}
+
+	user, err := oh.identityStore.GetIdentityUser(provider.Name(), idToken.Subject)
+	if err != nil {
+		oh.logger.Printf("ERROR: GetIdentityUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	status := http.StatusOK
+	if user == nil {
+		user, ok = oh.createUser(w, idToken, identity)
+		if !ok {
+			return
+		}
+		status = http.StatusCreated
+	} else if requireSecondFactor(w, oh.logger, oh.twoFactorStore, user.Id, tokens.ScopeTwoFactorJWT) {
+		return
+	}
+
+	refresh, err := oh.refreshTokenStore.CreateRefreshToken(user.Id, refreshTokenTTL)
+	if err != nil {
+		oh.logger.Printf("ERROR: creating refresh token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	writeTokenPair(w, oh.logger, oh.accessTokens, status, user.Id, refresh, utils.Envelope{"data": user})
+}
+
+// createUser signs up the owner of a new identity. The account gets a random
+// password the user can replace with a password reset, which is needed before
+// deleting the account or turning two-factor authentication off.
+func (oh *OIDCHandler) createUser(w http.ResponseWriter, idToken *oidc.IDToken, identity *store.Identity) (*store.User, bool) {
+	if idToken.Email == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "the identity provider did not share an email address"})
+		return nil, false
+	}
+	username := idToken.PreferredUsername
+	if username == "" {
+		username = idToken.Email
+	}
+	user := &store.User{Username: username, Email: idToken.Email}
+
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err == nil {
+		err = user.PasswordHash.Set(base64.RawStdEncoding.EncodeToString(secret))
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: setting random password: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+
+	user, err = oh.identityStore.CreateUserWithIdentity(user, identity, idToken.EmailVerified)
+	if errors.Is(err, store.ErrEmailTaken) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error() + ", sign in and link " + identity.Provider + " to it"})
+		return nil, false
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: CreateUserWithIdentity: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create a new user"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (oh *OIDCHandler) HandleListIdentities(w http.ResponseWriter, r *http.Request) {
+	identities, err := oh.identityStore.GetIdentities(middleware.GetUser(r).Id)
+	if err != nil {
+		oh.logger.Printf("ERROR: GetIdentities: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": identities})
+}
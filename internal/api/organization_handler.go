@@ -0,0 +1,306 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/authz"
+	"github.com/Naveenravi07/go-api/internal/mailer"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+const (
+	invitationTTL           = 7 * 24 * time.Hour
+	athleteWorkoutsLimit    = 20
+	athleteWorkoutsMaxLimit = 100
+)
+
+type OrganizationHandler struct {
+	organizationStore store.OrganizationStore
+	mailer            mailer.Mailer
+	logger            *log.Logger
+}
+
+func NewOrganizationHandler(organizationStore store.OrganizationStore, mailer mailer.Mailer, logger *log.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizationStore: organizationStore,
+		mailer:            mailer,
+		logger:            logger,
+	}
+}
+
+type createOrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+type createInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+func (oh *OrganizationHandler) HandleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var req createOrganizationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		oh.logger.Printf("ERROR: decoding create organization body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	org, err := oh.organizationStore.CreateOrganization(&store.Organization{Name: req.Name}, middleware.GetUser(r).Id)
+	if err != nil {
+		oh.logger.Printf("ERROR: CreateOrganization: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create organization"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": org})
+}
+
+func (oh *OrganizationHandler) HandleListOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := oh.organizationStore.GetOrganizationsForUser(middleware.GetUser(r).Id)
+	if err != nil {
+		oh.logger.Printf("ERROR: GetOrganizationsForUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": orgs})
+}
+
+// HandleListMembers lists every member. Only staff see email addresses.
+func (oh *OrganizationHandler) HandleListMembers(w http.ResponseWriter, r *http.Request) {
+	orgId, role, ok := oh.authorize(w, r, authz.ViewMembers)
+	if !ok {
+		return
+	}
+
+	members, err := oh.organizationStore.GetMembers(orgId, "")
+	if err != nil {
+		oh.logger.Printf("ERROR: GetMembers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !authz.Permits(role, authz.ViewAthletes) {
+		for i := range members {
+			members[i].Email = ""
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": members})
+}
+
+// HandleRemoveMember removes a member. Owners may remove anybody, every
+// member may leave.
+func (oh *OrganizationHandler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadInt64Param(r, "userId")
+	if err != nil {
+		oh.logger.Printf("ERROR: readUserIdParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	action := authz.RemoveMembers
+	if int(userId) == middleware.GetUser(r).Id {
+		action = authz.ViewMembers
+	}
+	orgId, _, ok := oh.authorize(w, r, action)
+	if !ok {
+		return
+	}
+
+	err = oh.organizationStore.RemoveMember(orgId, int(userId))
+	if errors.Is(err, store.ErrLastOwner) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "member did not exist"})
+		return
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: RemoveMember: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "member removed successfully"})
+}
+
+// HandleCreateInvitation invites an email address to join with a role. Coaches
+// may invite athletes, only owners may invite coaches and owners. The token
+// the invitee accepts the invitation with is emailed to them and returned in
+// the response so it can be passed on if the email does not arrive.
+func (oh *OrganizationHandler) HandleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req createInvitationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		oh.logger.Printf("ERROR: decoding create invitation body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if !strings.Contains(req.Email, "@") {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a valid email is required"})
+		return
+	}
+	role, err := store.ParseRole(req.Role)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	action := authz.InviteStaff
+	if role == store.RoleAthlete {
+		action = authz.InviteAthletes
+	}
+	orgId, _, ok := oh.authorize(w, r, action)
+	if !ok {
+		return
+	}
+
+	invitation, err := oh.organizationStore.CreateInvitation(&store.Invitation{
+		OrganizationId: int(orgId),
+		Email:          req.Email,
+		Role:           role,
+		InvitedBy:      middleware.GetUser(r).Id,
+	}, invitationTTL)
+	if err != nil {
+		oh.logger.Printf("ERROR: CreateInvitation: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create invitation"})
+		return
+	}
+	err = oh.mailer.Send(r.Context(), mailer.InvitationEmail(invitation.Email, string(invitation.Role), invitation.Token, invitation.Expiry))
+	if err != nil {
+		oh.logger.Printf("ERROR: sending invitation email: %v", err)
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": invitation})
+}
+
+func (oh *OrganizationHandler) HandleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var req acceptInvitationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	org, err := oh.organizationStore.AcceptInvitation(req.Token, middleware.GetUser(r))
+	if errors.Is(err, store.ErrInvitationInvalid) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, store.ErrInvitationEmail) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: AcceptInvitation: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": org})
+}
+
+func (oh *OrganizationHandler) HandleListAthletes(w http.ResponseWriter, r *http.Request) {
+	orgId, _, ok := oh.authorize(w, r, authz.ViewAthletes)
+	if !ok {
+		return
+	}
+
+	athletes, err := oh.organizationStore.GetMembers(orgId, store.RoleAthlete)
+	if err != nil {
+		oh.logger.Printf("ERROR: GetMembers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": athletes})
+}
+
+// HandleAthleteWorkouts summarizes the recent workouts of an athlete,
+// including the ones the athlete did not share publicly.
+func (oh *OrganizationHandler) HandleAthleteWorkouts(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, err := readPositiveInt(r.URL.Query().Get("limit"), athleteWorkoutsLimit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit " + err.Error()})
+		return
+	}
+	limit = min(limit, athleteWorkoutsMaxLimit)
+	athleteId, err := utils.ReadInt64Param(r, "userId")
+	if err != nil {
+		oh.logger.Printf("ERROR: readUserIdParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	orgId, _, ok := oh.authorize(w, r, authz.ViewAthletes)
+	if !ok {
+		return
+	}
+	role, err := oh.organizationStore.GetMemberRole(orgId, int(athleteId))
+	if err == sql.ErrNoRows || (err == nil && role != store.RoleAthlete) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "athlete did not exist"})
+		return
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: GetMemberRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	workouts, err := oh.organizationStore.GetRecentWorkouts(int(athleteId), limit)
+	if err != nil {
+		oh.logger.Printf("ERROR: GetRecentWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for i := range workouts {
+		workouts[i].ConvertWeights(units.Canonical, outUnit)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workouts})
+}
+
+// authorize reads the organization id and checks that the current user is a
+// member whose role permits action. Non members get a 404 so organizations
+// can not be enumerated.
+func (oh *OrganizationHandler) authorize(w http.ResponseWriter, r *http.Request, action authz.Action) (int64, store.Role, bool) {
+	orgId, err := utils.ReadIdParam(r)
+	if err != nil {
+		oh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid organization id"})
+		return 0, "", false
+	}
+
+	role, err := oh.organizationStore.GetMemberRole(orgId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "organization did not exist"})
+		return 0, "", false
+	}
+	if err != nil {
+		oh.logger.Printf("ERROR: GetMemberRole: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, "", false
+	}
+	if !authz.Permits(role, action) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "your role does not allow this action"})
+		return 0, "", false
+	}
+	return orgId, role, true
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+type SessionHandler struct {
+	sessionStore store.SessionStore
+	logger       *log.Logger
+}
+
+func NewSessionHandler(sessionStore store.SessionStore, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionStore: sessionStore,
+		logger:       logger,
+	}
+}
+
+type startSessionRequest struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	StartedAt   *time.Time `json:"started_at"`
+}
+
+type logSetRequest struct {
+	ExerciseName    string           `json:"exercise_name"`
+	Reps            *int             `json:"reps"`
+	DurationSeconds *int             `json:"duration_seconds"`
+	Weight          *float64         `json:"weight"`
+	RPE             *float64         `json:"rpe"`
+	RestSeconds     *int             `json:"rest_seconds"`
+	Notes           string           `json:"notes"`
+	PerformedAt     *time.Time       `json:"performed_at"`
+	WeightUnit      units.WeightUnit `json:"weight_unit"`
+}
+
+type finishSessionRequest struct {
+	FinishedAt     *time.Time `json:"finished_at"`
+	CaloriesBurned int        `json:"calories_burned"`
+}
+
+func validateSet(req *logSetRequest) error {
+	if req.ExerciseName == "" {
+		return errors.New("exercise_name is required")
+	}
+	if (req.Reps == nil) == (req.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+	if req.Reps != nil && *req.Reps < 0 {
+		return errors.New("reps must not be negative")
+	}
+	if req.DurationSeconds != nil && *req.DurationSeconds <= 0 {
+		return errors.New("duration_seconds must be positive")
+	}
+	if req.RPE != nil && (*req.RPE < 1 || *req.RPE > 10) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+	if req.RestSeconds != nil && *req.RestSeconds < 0 {
+		return errors.New("rest_seconds must not be negative")
+	}
+	return nil
+}
+
+func (sh *SessionHandler) HandleStartSession(w http.ResponseWriter, r *http.Request) {
+	var req startSessionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("ERROR: decoding start session body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if req.Title == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "title is required"})
+		return
+	}
+
+	session := &store.WorkoutSession{
+		UserId:      middleware.GetUser(r).Id,
+		Title:       req.Title,
+		Description: req.Description,
+		StartedAt:   time.Now().UTC(),
+	}
+	if req.StartedAt != nil {
+		session.StartedAt = *req.StartedAt
+	}
+
+	session, err = sh.sessionStore.StartSession(session)
+	if err != nil {
+		sh.logger.Printf("ERROR: starting session %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to start session"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": session})
+}
+
+func (sh *SessionHandler) HandleGetSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := sh.readOwnSession(w, r)
+	if !ok {
+		return
+	}
+	unit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	session.ConvertWeights(units.Canonical, unit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": session})
+}
+
+func (sh *SessionHandler) HandleLogSet(w http.ResponseWriter, r *http.Request) {
+	session, ok := sh.readOwnSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req logSetRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("ERROR: decoding log set body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if err := validateSet(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	unit, err := inputUnit(r, req.WeightUnit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	set := &store.SessionSet{
+		WorkoutId:       session.WorkoutId,
+		ExerciseName:    req.ExerciseName,
+		Reps:            req.Reps,
+		DurationSeconds: req.DurationSeconds,
+		Weight:          units.ConvertPtr(req.Weight, unit, units.Canonical),
+		RPE:             req.RPE,
+		RestSeconds:     req.RestSeconds,
+		Notes:           req.Notes,
+		PerformedAt:     time.Now().UTC(),
+	}
+	if req.PerformedAt != nil {
+		set.PerformedAt = *req.PerformedAt
+	}
+
+	set, err = sh.sessionStore.AddSet(set)
+	if err != nil {
+		sh.writeSessionError(w, err)
+		return
+	}
+	set.ConvertWeights(units.Canonical, outUnit)
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": set})
+}
+
+func (sh *SessionHandler) HandleFinishSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := sh.readOwnSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req finishSessionRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			sh.logger.Printf("ERROR: decoding finish session body %v", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+			return
+		}
+	}
+	finishedAt := time.Now().UTC()
+	if req.FinishedAt != nil {
+		finishedAt = *req.FinishedAt
+	}
+
+	unit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workout, err := sh.sessionStore.FinishSession(int64(session.WorkoutId), finishedAt, req.CaloriesBurned)
+	if err != nil {
+		sh.writeSessionError(w, err)
+		return
+	}
+	workout.ConvertWeights(units.Canonical, unit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workout})
+}
+
+func (sh *SessionHandler) readOwnSession(w http.ResponseWriter, r *http.Request) (*store.WorkoutSession, bool) {
+	sessionId, err := utils.ReadIdParam(r)
+	if err != nil {
+		sh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid session id "})
+		return nil, false
+	}
+
+	session, err := sh.sessionStore.GetSession(sessionId)
+	if err != nil {
+		sh.writeSessionError(w, err)
+		return nil, false
+	}
+	if session.UserId != middleware.GetUser(r).Id {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to access this session"})
+		return nil, false
+	}
+	return session, true
+}
+
+func (sh *SessionHandler) writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, store.ErrSessionNotStarted):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "session did not exist "})
+	case errors.Is(err, store.ErrSessionFinished):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrSessionInvalidTime):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	default:
+		sh.logger.Printf("ERROR: session: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	feedDefaultLimit = 20
+	feedMaxLimit     = 100
+)
+
+type SocialHandler struct {
+	socialStore store.SocialStore
+	userStore   store.UserStore
+	logger      *log.Logger
+}
+
+func NewSocialHandler(socialStore store.SocialStore, userStore store.UserStore, logger *log.Logger) *SocialHandler {
+	return &SocialHandler{
+		socialStore: socialStore,
+		userStore:   userStore,
+		logger:      logger,
+	}
+}
+
+// HandleFollow follows a user. Users with a non-public profile approve their
+// followers, so until then the follow is only a request.
+func (sh *SocialHandler) HandleFollow(w http.ResponseWriter, r *http.Request) {
+	followee, ok := sh.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	approved, err := sh.socialStore.Follow(middleware.GetUser(r).Id, followee.Id)
+	if errors.Is(err, store.ErrSelfFollow) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: Follow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !approved {
+		utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "your follow request was sent to " + followee.Username})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "you are now following " + followee.Username})
+}
+
+func (sh *SocialHandler) HandleUnfollow(w http.ResponseWriter, r *http.Request) {
+	followee, ok := sh.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := sh.socialStore.Unfollow(middleware.GetUser(r).Id, followee.Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "you are not following " + followee.Username})
+		return
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: Unfollow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "you are no longer following " + followee.Username})
+}
+
+// HandleFollowRequests lists the pending follow requests of the current user.
+func (sh *SocialHandler) HandleFollowRequests(w http.ResponseWriter, r *http.Request) {
+	requests, err := sh.socialStore.GetFollowRequests(middleware.GetUser(r).Id)
+	if err != nil {
+		sh.logger.Printf("ERROR: GetFollowRequests: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": requests})
+}
+
+func (sh *SocialHandler) HandleApproveFollow(w http.ResponseWriter, r *http.Request) {
+	follower, ok := sh.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := sh.socialStore.ApproveFollow(follower.Id, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no follow request from " + follower.Username})
+		return
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: ApproveFollow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": follower.Username + " is now following you"})
+}
+
+func (sh *SocialHandler) HandleRejectFollow(w http.ResponseWriter, r *http.Request) {
+	follower, ok := sh.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := sh.socialStore.RejectFollow(follower.Id, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "no follow request from " + follower.Username})
+		return
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: RejectFollow: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "the follow request of " + follower.Username + " was rejected"})
+}
+
+func (sh *SocialHandler) HandleFollowers(w http.ResponseWriter, r *http.Request) {
+	sh.listFollows(w, r, sh.socialStore.GetFollowers)
+}
+
+func (sh *SocialHandler) HandleFollowing(w http.ResponseWriter, r *http.Request) {
+	sh.listFollows(w, r, sh.socialStore.GetFollowing)
+}
+
+// listFollows lists one side of the follow graph of a user whose profile is
+// visible to the current user.
+func (sh *SocialHandler) listFollows(w http.ResponseWriter, r *http.Request, list func(userId int) ([]store.Follow, error)) {
+	profile, err := sh.socialStore.GetProfile(chi.URLParam(r, "username"), middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user did not exist"})
+		return
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: GetProfile: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if profile.Restricted {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "this profile is not visible to you"})
+		return
+	}
+
+	follows, err := list(profile.Id)
+	if err != nil {
+		sh.logger.Printf("ERROR: listing follows: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": follows})
+}
+
+// HandleFeed returns a page of workouts of the users the current user
+// follows, newest first. The next_cursor of a page requests the one after it
+// and is null on the last page.
+func (sh *SocialHandler) HandleFeed(w http.ResponseWriter, r *http.Request) {
+	outUnit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, err := readPositiveInt(r.URL.Query().Get("limit"), feedDefaultLimit)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "limit " + err.Error()})
+		return
+	}
+	limit = min(limit, feedMaxLimit)
+
+	var cursor *store.FeedCursor
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		cursor, err = store.DecodeFeedCursor(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	items, next, err := sh.socialStore.GetFeed(middleware.GetUser(r).Id, cursor, limit)
+	if err != nil {
+		sh.logger.Printf("ERROR: GetFeed: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for i := range items {
+		items[i].ConvertWeights(units.Canonical, outUnit)
+	}
+
+	var nextCursor *string
+	if next != nil {
+		encoded := next.Encode()
+		nextCursor = &encoded
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": items, "next_cursor": nextCursor})
+}
+
+func (sh *SocialHandler) readUser(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	user, err := sh.userStore.GetUserByUsername(chi.URLParam(r, "username"))
+	if err != nil {
+		sh.logger.Printf("ERROR: GetUserByUsername: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if user == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user did not exist"})
+		return nil, false
+	}
+	return user, true
+}
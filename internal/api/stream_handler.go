@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/realtime"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	streamHeartbeat   = 15 * time.Second
+	streamReplayLimit = 500
+)
+
+type WorkoutStreamHandler struct {
+	hub          *realtime.Hub
+	workoutStore store.WorkoutStore
+	outboxStore  store.OutboxStore
+	logger       *log.Logger
+}
+
+func NewWorkoutStreamHandler(hub *realtime.Hub, workoutStore store.WorkoutStore, outboxStore store.OutboxStore, logger *log.Logger) *WorkoutStreamHandler {
+	return &WorkoutStreamHandler{
+		hub:          hub,
+		workoutStore: workoutStore,
+		outboxStore:  outboxStore,
+		logger:       logger,
+	}
+}
+
+// HandleWorkoutStream streams the changes of a workout as Server-Sent Events.
+// Clients resume after a reconnect by sending the Last-Event-ID header.
+// Weights are in the unit query parameter or the preferred unit of the user,
+// like in other responses, and every payload names its weight_unit.
+func (sh *WorkoutStreamHandler) HandleWorkoutStream(w http.ResponseWriter, r *http.Request) {
+	workoutId, unit, ok := sh.readWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	send := func(msg realtime.Message) error {
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.Id, msg.Type, msg.Data)
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	heartbeat := func() error {
+		_, err := fmt.Fprintf(w, ": ping\n\n")
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err := sh.stream(r, workoutId, unit, lastEventId(r), send, heartbeat)
+	if err != nil {
+		sh.logger.Printf("ERROR: workout %d event stream: %v", workoutId, err)
+	}
+}
+
+// HandleWorkoutSocket is the WebSocket variant of HandleWorkoutStream. Each
+// message is a JSON object with id, type and data; clients resume with the
+// last_event_id query parameter.
+func (sh *WorkoutStreamHandler) HandleWorkoutSocket(w http.ResponseWriter, r *http.Request) {
+	workoutId, unit, ok := sh.readWorkout(w, r)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	rc.SetReadDeadline(time.Time{})
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		sh.logger.Printf("ERROR: websocket accept: %v", err)
+		return
+	}
+	defer conn.CloseNow()
+
+	// we never expect messages from the client, CloseRead handles pings and close frames
+	ctx := conn.CloseRead(r.Context())
+	r = r.WithContext(ctx)
+
+	send := func(msg realtime.Message) error {
+		writeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return wsjson.Write(writeCtx, conn, msg)
+	}
+	heartbeat := func() error {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		return conn.Ping(pingCtx)
+	}
+
+	err = sh.stream(r, workoutId, unit, lastEventId(r), send, heartbeat)
+	if err != nil && websocket.CloseStatus(err) == -1 && ctx.Err() == nil {
+		sh.logger.Printf("ERROR: workout %d websocket: %v", workoutId, err)
+	}
+	conn.Close(websocket.StatusGoingAway, "stream closed")
+}
+
+func (sh *WorkoutStreamHandler) readWorkout(w http.ResponseWriter, r *http.Request) (int, units.WeightUnit, bool) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		sh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id "})
+		return 0, "", false
+	}
+	unit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return 0, "", false
+	}
+
+	visible, err := sh.workoutStore.CanViewWorkout(workoutId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows || (err == nil && !visible) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout did not exist "})
+		return 0, "", false
+	}
+	if err != nil {
+		sh.logger.Printf("ERROR: CanViewWorkout: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return 0, "", false
+	}
+	return int(workoutId), unit, true
+}
+
+// stream replays the events persisted after lastId and then forwards live
+// events until the client goes away or may no longer see the workout. The
+// live subscription is opened before the replay so nothing committed in
+// between is missed; duplicates are filtered by event id. Events hold
+// canonical weights and are converted to unit before they are sent.
+func (sh *WorkoutStreamHandler) stream(r *http.Request, workoutId int, unit units.WeightUnit, lastId int64, send func(realtime.Message) error, heartbeat func() error) error {
+	write := send
+	send = func(msg realtime.Message) error {
+		msg, err := convertMessage(msg, unit)
+		if err != nil {
+			return err
+		}
+		return write(msg)
+	}
+
+	latestId, err := sh.outboxStore.GetLatestAggregateEventId(store.AggregateWorkout, workoutId)
+	if err != nil {
+		return err
+	}
+	sub := sh.hub.Subscribe(workoutId, latestId)
+	defer sub.Close()
+
+	if lastId == 0 {
+		// a new client only wants what happens from now on
+		lastId = latestId
+	}
+	for {
+		events, err := sh.outboxStore.GetAggregateEvents(store.AggregateWorkout, workoutId, lastId, streamReplayLimit)
+		if err != nil {
+			return err
+		}
+		for i := range events {
+			msg, err := realtime.NewMessage(events[i].Event())
+			if err != nil {
+				return err
+			}
+			if err := send(msg); err != nil {
+				return err
+			}
+			lastId = msg.Id
+		}
+		if len(events) < streamReplayLimit {
+			break
+		}
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-ticker.C:
+			// the workout may have been made private or the viewer lost access
+			visible, err := sh.canView(r, workoutId)
+			if err != nil || !visible {
+				return err
+			}
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		case msg, open := <-sub.C:
+			if !open {
+				// dropped for falling behind, the client reconnects and resumes
+				return nil
+			}
+			if msg.Id <= lastId {
+				continue
+			}
+			if msg.Type == store.EventWorkoutUpdated {
+				visible, err := sh.canView(r, workoutId)
+				if err != nil || !visible {
+					return err
+				}
+			}
+			if err := send(msg); err != nil {
+				return err
+			}
+			lastId = msg.Id
+			if msg.Type == store.EventWorkoutDeleted {
+				// the client learns about the deletion, a reconnect gets a 404
+				return nil
+			}
+		}
+	}
+}
+
+type weightConverter interface {
+	ConvertWeights(from, to units.WeightUnit)
+}
+
+// convertMessage returns msg with the weights of its payload in unit. The
+// payload is copied, the message itself may be shared with other subscribers.
+func convertMessage(msg realtime.Message, unit units.WeightUnit) (realtime.Message, error) {
+	if unit == units.Canonical {
+		return msg, nil
+	}
+
+	var payload weightConverter
+	switch msg.Type {
+	case store.EventWorkoutCreated, store.EventWorkoutUpdated, store.EventWorkoutDeleted, store.EventWorkoutRestored,
+		store.EventWorkoutSessionFinished:
+		payload = &store.Workout{}
+	case store.EventWorkoutEntryCreated, store.EventWorkoutEntryUpdated, store.EventWorkoutEntryDeleted:
+		payload = &entryPayload{}
+	case store.EventWorkoutSessionStarted:
+		payload = &store.WorkoutSession{}
+	case store.EventWorkoutSetLogged:
+		payload = &store.SessionSet{}
+	default:
+		return msg, nil
+	}
+
+	err := json.Unmarshal(msg.Data, payload)
+	if err != nil {
+		return msg, err
+	}
+	payload.ConvertWeights(units.Canonical, unit)
+	msg.Data, err = json.Marshal(payload)
+	return msg, err
+}
+
+// entryPayload is the payload of entry events, which also records its unit.
+type entryPayload struct {
+	store.WorkoutEntry
+}
+
+func (e *entryPayload) ConvertWeights(from, to units.WeightUnit) {
+	e.WorkoutEntry.ConvertWeights(from, to)
+	e.WeightUnit = to
+}
+
+func (sh *WorkoutStreamHandler) canView(r *http.Request, workoutId int) (bool, error) {
+	visible, err := sh.workoutStore.CanViewWorkout(int64(workoutId), middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return visible, err
+}
+
+func lastEventId(r *http.Request) int64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,483 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/jwt"
+	"github.com/Naveenravi07/go-api/internal/mailer"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/ratelimit"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/tokens"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+const (
+	verificationTTL  = 3 * 24 * time.Hour
+	passwordResetTTL = time.Hour
+	// passwordResetTimeout bounds the work done after a reset was requested
+	passwordResetTimeout = time.Minute
+	accessTokenTTL       = 15 * time.Minute
+	refreshTokenTTL      = 30 * 24 * time.Hour
+)
+
+type TokenHandler struct {
+	tokenStore        store.TokenStore
+	refreshTokenStore store.RefreshTokenStore
+	userStore         store.UserStore
+	twoFactorStore    store.TwoFactorStore
+	accessTokens      *jwt.KeySet
+	lockout           *ratelimit.Lockout
+	mailer            mailer.Mailer
+	logger            *log.Logger
+}
+
+type createTokenRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// restoreAccountRequest carries a code as well when two-factor
+// authentication is on, there is no pending sign in to complete afterwards.
+type restoreAccountRequest struct {
+	createTokenRequest
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type createPasswordResetTokenRequest struct {
+	Email string `json:"email"`
+}
+
+type completeTwoFactorRequest struct {
+	PendingToken string `json:"pending_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type accessToken struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+func NewTokenHandler(tokenStore store.TokenStore, refreshTokenStore store.RefreshTokenStore, userStore store.UserStore,
+	twoFactorStore store.TwoFactorStore, accessTokens *jwt.KeySet, lockout *ratelimit.Lockout, mailer mailer.Mailer,
+	logger *log.Logger) *TokenHandler {
+	return &TokenHandler{
+		tokenStore:        tokenStore,
+		refreshTokenStore: refreshTokenStore,
+		userStore:         userStore,
+		twoFactorStore:    twoFactorStore,
+		accessTokens:      accessTokens,
+		lockout:           lockout,
+		mailer:            mailer,
+		logger:            logger,
+	}
+}
+
+// authenticate checks the username and password of the request body.
+// Repeated failures lock the username for longer and longer.
+func (th *TokenHandler) authenticate(w http.ResponseWriter, r *http.Request) (*store.User, bool) {
+	var req createTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("ERROR: decoding create token body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return nil, false
+	}
+	return th.checkCredentials(w, req, th.userStore.GetUserByUsername)
+}
+
+// checkCredentials is authenticate for the accounts getUser finds.
+func (th *TokenHandler) checkCredentials(w http.ResponseWriter, req createTokenRequest, getUser func(username string) (*store.User, error)) (*store.User, bool) {
+	lockKey := loginLockKey(req.Username)
+	locked, err := th.lockout.Check(lockKey)
+	if err != nil {
+		th.logger.Printf("ERROR: checking login lockout: %v", err)
+	}
+	if locked > 0 {
+		writeLocked(w, locked)
+		return nil, false
+	}
+
+	user, err := getUser(req.Username)
+	if err != nil || user == nil {
+		th.logger.Printf("ERROR: GetUserByUsername: %v", err)
+		th.loginFailed(lockKey)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return nil, false
+	}
+
+	matches, err := user.PasswordHash.Matches(req.Password)
+	if errors.Is(err, store.ErrUnknownPasswordHash) {
+		// the account can only be recovered with a password reset
+		th.logger.Printf("ERROR: password hash of user %d: %v", user.Id, err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return nil, false
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: password matches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return nil, false
+	}
+	if !matches {
+		th.loginFailed(lockKey)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return nil, false
+	}
+	if user.PasswordHash.NeedsRehash() {
+		th.rehashPassword(user, req.Password)
+	}
+	return user, true
+}
+
+func loginLockKey(username string) string {
+	return "login:" + strings.ToLower(username)
+}
+
+func writeLocked(w http.ResponseWriter, locked time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(locked.Seconds())))
+	utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "too many failed logins, try again later"})
+}
+
+func (th *TokenHandler) loginFailed(lockKey string) {
+	recordLoginFailure(th.lockout, th.logger, lockKey)
+}
+
+// loginSucceeded forgets the failures once the login is complete, including
+// the second factor.
+func (th *TokenHandler) loginSucceeded(username string) {
+	resetLoginFailures(th.lockout, th.logger, username)
+}
+
+func recordLoginFailure(lockout *ratelimit.Lockout, logger *log.Logger, lockKey string) {
+	_, err := lockout.Fail(lockKey)
+	if err != nil {
+		logger.Printf("ERROR: recording failed login: %v", err)
+	}
+}
+
+func resetLoginFailures(lockout *ratelimit.Lockout, logger *log.Logger, username string) {
+	err := lockout.Succeed(loginLockKey(username))
+	if err != nil {
+		logger.Printf("ERROR: resetting login lockout: %v", err)
+	}
+}
+
+// HandleCreateToken signs in with username and password. Users with
+// two-factor authentication get a pending token to finish the login with at
+// POST /tokens/two-factor instead.
+func (th *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := th.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if requireSecondFactor(w, th.logger, th.twoFactorStore, user.Id, tokens.ScopeTwoFactor) {
+		return
+	}
+	th.loginSucceeded(user.Username)
+	th.issueAuthToken(w, user.Id)
+}
+
+func (th *TokenHandler) issueAuthToken(w http.ResponseWriter, userId int) {
+	token, err := th.tokenStore.CreateNewToken(userId, 24*time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		th.logger.Printf("ERROR: creating token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"auth_token": token})
+}
+
+// HandleCreateJWT signs in with username and password like HandleCreateToken
+// but returns a short lived signed access token and a refresh token to get
+// the next one with.
+func (th *TokenHandler) HandleCreateJWT(w http.ResponseWriter, r *http.Request) {
+	user, ok := th.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if requireSecondFactor(w, th.logger, th.twoFactorStore, user.Id, tokens.ScopeTwoFactorJWT) {
+		return
+	}
+	th.loginSucceeded(user.Username)
+	th.issueJWT(w, user.Id)
+}
+
+func (th *TokenHandler) issueJWT(w http.ResponseWriter, userId int) {
+	refresh, err := th.refreshTokenStore.CreateRefreshToken(userId, refreshTokenTTL)
+	if err != nil {
+		th.logger.Printf("ERROR: creating refresh token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	writeTokenPair(w, th.logger, th.accessTokens, http.StatusCreated, userId, refresh, nil)
+}
+
+// HandleCompleteTwoFactor finishes a login with the pending token and a TOTP
+// or recovery code. It returns the kind of token the login was started for.
+func (th *TokenHandler) HandleCompleteTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req completeTwoFactorRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.PendingToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "pending_token is required"})
+		return
+	}
+
+	userId, scope, err := th.twoFactorStore.ConsumePendingLogin(req.PendingToken)
+	if errors.Is(err, store.ErrTokenInvalid) {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: ConsumePendingLogin: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	user, err := th.userStore.GetUserById(userId)
+	if err != nil || user == nil {
+		th.logger.Printf("ERROR: GetUserById: %v", err)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code, please sign in again"})
+		return
+	}
+	valid, err := verifySecondFactor(th.twoFactorStore, userId, req.Code, req.RecoveryCode)
+	if err != nil {
+		th.logger.Printf("ERROR: verifying second factor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !valid {
+		// wrong codes count towards the lockout like wrong passwords
+		th.loginFailed(loginLockKey(user.Username))
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code, please sign in again"})
+		return
+	}
+	th.loginSucceeded(user.Username)
+
+	if scope == tokens.ScopeTwoFactorJWT {
+		th.issueJWT(w, userId)
+		return
+	}
+	th.issueAuthToken(w, userId)
+}
+
+// HandleRefreshJWT exchanges a refresh token for a new access and refresh
+// token. Every refresh token works once; presenting one again signs out the
+// session it belongs to.
+func (th *TokenHandler) HandleRefreshJWT(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "refresh_token is required"})
+		return
+	}
+
+	refresh, err := th.refreshTokenStore.RotateRefreshToken(req.RefreshToken, refreshTokenTTL)
+	if errors.Is(err, store.ErrRefreshTokenReused) {
+		th.logger.Printf("WARN: refresh token reused, session revoked")
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, store.ErrTokenInvalid) {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: RotateRefreshToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	writeTokenPair(w, th.logger, th.accessTokens, http.StatusOK, refresh.UserId, refresh, nil)
+}
+
+// HandleRevokeJWT signs out the session of a refresh token. Access tokens
+// already issued stay valid until they expire.
+func (th *TokenHandler) HandleRevokeJWT(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.RefreshToken == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "refresh_token is required"})
+		return
+	}
+
+	err = th.refreshTokenStore.RevokeRefreshToken(req.RefreshToken)
+	if errors.Is(err, store.ErrTokenInvalid) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: RevokeRefreshToken: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "session revoked"})
+}
+
+// writeTokenPair responds with a new access token for userId and the
+// refresh token to get the next one with. extra is merged into the response.
+func writeTokenPair(w http.ResponseWriter, logger *log.Logger, accessTokens *jwt.KeySet, status int, userId int,
+	refresh *tokens.Token, extra utils.Envelope) {
+	token, claims, err := accessTokens.Issue(strconv.Itoa(userId), accessTokenTTL)
+	if err != nil {
+		logger.Printf("ERROR: issuing access token: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	response := utils.Envelope{
+		"access_token":  accessToken{Token: token, TokenType: "Bearer", Expiry: time.Unix(claims.ExpiresAt, 0).UTC()},
+		"refresh_token": refresh,
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	utils.WriteJSON(w, status, response)
+}
+
+// rehashPassword upgrades the stored hash to the current algorithm and cost.
+// Failures are only logged, the old hash keeps working.
+func (th *TokenHandler) rehashPassword(user *store.User, plaintext string) {
+	err := user.PasswordHash.Set(plaintext)
+	if err == nil {
+		err = th.userStore.UpdatePasswordHash(user)
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: rehashing password of user %d: %v", user.Id, err)
+	}
+}
+
+// sendVerification mails user a new email verification token. Tokens sent
+// earlier stop working so that only the latest email is valid.
+func sendVerification(ctx context.Context, tokenStore store.TokenStore, m mailer.Mailer, user *store.User) error {
+	err := tokenStore.DeleteAllTokensForUser(user.Id, tokens.ScopeEmailVerification)
+	if err != nil {
+		return err
+	}
+	token, err := tokenStore.CreateNewToken(user.Id, verificationTTL, tokens.ScopeEmailVerification)
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, mailer.VerificationEmail(user.Email, user.Username, token.Plaintext, token.Expiry))
+}
+
+// HandleCreateVerificationToken mails the current user a new verification
+// token, e.g. when the one sent on sign up expired.
+func (th *TokenHandler) HandleCreateVerificationToken(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.EmailVerified() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "email is already verified"})
+		return
+	}
+
+	err := sendVerification(r.Context(), th.tokenStore, th.mailer, user)
+	if err != nil {
+		th.logger.Printf("ERROR: sending verification email: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "a verification email has been sent to " + user.Email})
+}
+
+// HandleCreatePasswordResetToken mails a password reset token to the account
+// of the email. The account is looked up and mailed after responding, so
+// neither the status nor the response time tells whether it exists.
+func (th *TokenHandler) HandleCreatePasswordResetToken(w http.ResponseWriter, r *http.Request) {
+	var req createPasswordResetTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Email == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "email is required"})
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), passwordResetTimeout)
+		defer cancel()
+		err := th.sendPasswordReset(ctx, req.Email)
+		if err != nil {
+			th.logger.Printf("ERROR: sending password reset email: %v", err)
+		}
+	}()
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "if an account uses this email a reset token has been sent to it"})
+}
+
+func (th *TokenHandler) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := th.userStore.GetUserByEmail(email)
+	if err != nil || user == nil {
+		return err
+	}
+	err = th.tokenStore.DeleteAllTokensForUser(user.Id, tokens.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+	token, err := th.tokenStore.CreateNewToken(user.Id, passwordResetTTL, tokens.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+	return th.mailer.Send(ctx, mailer.PasswordResetEmail(user.Email, user.Username, token.Plaintext, token.Expiry))
+}
+
+// HandleRestoreAccount cancels the deletion of an account during its grace
+// period. It takes the username and password like a sign in, plus a code when
+// two-factor authentication is on; the user signs in as usual afterwards.
+func (th *TokenHandler) HandleRestoreAccount(w http.ResponseWriter, r *http.Request) {
+	var req restoreAccountRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("ERROR: decoding restore account body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	user, ok := th.checkCredentials(w, req.createTokenRequest, th.userStore.GetDeletedUser)
+	if !ok {
+		return
+	}
+
+	enabled, err := th.twoFactorStore.IsEnabled(user.Id)
+	if err != nil {
+		th.logger.Printf("ERROR: IsEnabled: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if enabled {
+		valid, err := verifySecondFactor(th.twoFactorStore, user.Id, req.Code, req.RecoveryCode)
+		if err != nil {
+			th.logger.Printf("ERROR: verifying second factor: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if !valid {
+			// wrong codes count towards the lockout like wrong passwords
+			th.loginFailed(loginLockKey(user.Username))
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+			return
+		}
+	}
+
+	err = th.userStore.RestoreUser(user.Id)
+	if err == sql.ErrNoRows {
+		// purged or restored in the meantime
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: RestoreUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	th.loginSucceeded(user.Username)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": user})
+}
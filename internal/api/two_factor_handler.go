@@ -0,0 +1,284 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/ratelimit"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/totp"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+const (
+	totpIssuer        = "go-api"
+	pendingLoginTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type TwoFactorHandler struct {
+	twoFactorStore store.TwoFactorStore
+	lockout        *ratelimit.Lockout
+	logger         *log.Logger
+}
+
+func NewTwoFactorHandler(twoFactorStore store.TwoFactorStore, lockout *ratelimit.Lockout, logger *log.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorStore: twoFactorStore,
+		lockout:        lockout,
+		logger:         logger,
+	}
+}
+
+type twoFactorCodeRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// requireSecondFactor stops a login that passed the password check when the
+// user has two-factor authentication enabled and answers with a pending token
+// instead. It returns true when it wrote the response.
+func requireSecondFactor(w http.ResponseWriter, logger *log.Logger, twoFactorStore store.TwoFactorStore, userId int, scope string) bool {
+	enabled, err := twoFactorStore.IsEnabled(userId)
+	if err != nil {
+		logger.Printf("ERROR: IsEnabled: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return true
+	}
+	if !enabled {
+		return false
+	}
+
+	token, err := twoFactorStore.CreatePendingLogin(userId, scope, pendingLoginTTL)
+	if err != nil {
+		logger.Printf("ERROR: CreatePendingLogin: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return true
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"two_factor_required": true, "pending_token": token})
+	return true
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when no TOTP code
+// is given. Both can only be used once.
+func verifySecondFactor(twoFactorStore store.TwoFactorStore, userId int, code, recoveryCode string) (bool, error) {
+	if code == "" {
+		if recoveryCode == "" {
+			return false, nil
+		}
+		return twoFactorStore.UseRecoveryCode(userId, totp.NormalizeRecoveryCode(recoveryCode))
+	}
+
+	tf, err := twoFactorStore.GetTwoFactor(userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(tf.Secret, code, time.Now())
+	if !ok || !tf.Enabled() {
+		return false, nil
+	}
+	return twoFactorStore.UseStep(userId, step)
+}
+
+// reauthenticate confirms a signed in user before a sensitive change with the
+// password, and a code when requireCode is set. It shares the login lockout
+// so a stolen session cannot be used to guess the password. Accounts created
+// with an identity provider have a random password and have to set one with
+// a password reset first. It returns false when it wrote the response.
+func reauthenticate(w http.ResponseWriter, logger *log.Logger, lockout *ratelimit.Lockout, twoFactorStore store.TwoFactorStore,
+	user *store.User, req twoFactorCodeRequest, requireCode bool) bool {
+	if req.Password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
+			"error": "password is required, accounts created with an identity provider set one with a password reset first",
+		})
+		return false
+	}
+
+	lockKey := loginLockKey(user.Username)
+	locked, err := lockout.Check(lockKey)
+	if err != nil {
+		logger.Printf("ERROR: checking login lockout: %v", err)
+	}
+	if locked > 0 {
+		writeLocked(w, locked)
+		return false
+	}
+
+	matches, err := user.PasswordHash.Matches(req.Password)
+	if err != nil && !errors.Is(err, store.ErrUnknownPasswordHash) {
+		logger.Printf("ERROR: PasswordHash.Matches: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	if !matches {
+		recordLoginFailure(lockout, logger, lockKey)
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		return false
+	}
+
+	if requireCode {
+		valid, err := verifySecondFactor(twoFactorStore, user.Id, req.Code, req.RecoveryCode)
+		if err != nil {
+			logger.Printf("ERROR: verifying second factor: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return false
+		}
+		if !valid {
+			recordLoginFailure(lockout, logger, lockKey)
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+			return false
+		}
+	}
+	resetLoginFailures(lockout, logger, user.Username)
+	return true
+}
+
+// HandleEnroll starts the enrollment with a new secret. It only protects
+// logins after HandleConfirm saw a first code of it.
+func (th *TwoFactorHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		th.logger.Printf("ERROR: generating totp secret: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = th.twoFactorStore.BeginEnrollment(user.Id, secret)
+	if errors.Is(err, store.ErrTwoFactorEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: BeginEnrollment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": utils.Envelope{
+		"secret": secret,
+		"uri":    totp.URI(totpIssuer, user.Email, secret),
+	}})
+}
+
+// HandleConfirm enables two-factor authentication with a first code and
+// returns the recovery codes. They are only shown this once.
+func (th *TwoFactorHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return
+	}
+
+	tf, err := th.twoFactorStore.GetTwoFactor(user.Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "two-factor enrollment not started"})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: GetTwoFactor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if tf.Enabled() {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": store.ErrTwoFactorEnabled.Error()})
+		return
+	}
+	step, ok := totp.Validate(tf.Secret, req.Code, time.Now())
+	if !ok {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		th.logger.Printf("ERROR: generating recovery codes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = th.twoFactorStore.ConfirmEnrollment(user.Id, step, codes)
+	if errors.Is(err, store.ErrTwoFactorEnabled) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: ConfirmEnrollment: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{"recovery_codes": codes}})
+}
+
+// HandleRegenerateRecoveryCodes replaces all recovery codes, used or not.
+func (th *TwoFactorHandler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "code is required"})
+		return
+	}
+
+	valid, err := verifySecondFactor(th.twoFactorStore, user.Id, req.Code, "")
+	if err != nil {
+		th.logger.Printf("ERROR: verifying second factor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !valid {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid code"})
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		th.logger.Printf("ERROR: generating recovery codes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	err = th.twoFactorStore.ReplaceRecoveryCodes(user.Id, codes)
+	if err != nil {
+		th.logger.Printf("ERROR: ReplaceRecoveryCodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": utils.Envelope{"recovery_codes": codes}})
+}
+
+// HandleDisable turns two-factor authentication off. It asks for the password
+// and a code so that a stolen session alone cannot remove it.
+func (th *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if !reauthenticate(w, th.logger, th.lockout, th.twoFactorStore, user, req, true) {
+		return
+	}
+
+	err = th.twoFactorStore.Disable(user.Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		th.logger.Printf("ERROR: Disable two-factor: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "two-factor authentication disabled"})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/units"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+// displayUnit returns the unit weights are reported in: the ?unit= query
+// parameter when present, otherwise the requester's preferred unit.
+func displayUnit(r *http.Request) (units.WeightUnit, error) {
+	if unit := r.URL.Query().Get("unit"); unit != "" {
+		return units.ParseWeightUnit(unit)
+	}
+	return preferredUnit(r), nil
+}
+
+// inputUnit returns the unit the weights of a request body are expressed in:
+// the unit declared in the body, otherwise the requester's preferred unit.
+func inputUnit(r *http.Request, declared units.WeightUnit) (units.WeightUnit, error) {
+	if declared != "" {
+		return units.ParseWeightUnit(string(declared))
+	}
+	return preferredUnit(r), nil
+}
+
+func preferredUnit(r *http.Request) units.WeightUnit {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() || user.PreferredUnit == "" {
+		return units.Canonical
+	}
+	return user.PreferredUnit
+}
+
+// readUnits resolves the unit of the request body and the unit of the
+// response, writing a 400 response if either is invalid.
+func readUnits(w http.ResponseWriter, r *http.Request, declared units.WeightUnit) (units.WeightUnit, units.WeightUnit, bool) {
+	in, err := inputUnit(r, declared)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return "", "", false
+	}
+	out, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return "", "", false
+	}
+	return in, out, true
+}
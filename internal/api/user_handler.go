@@ -1,32 +1,59 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/Naveenravi07/go-api/internal/authz"
+	"github.com/Naveenravi07/go-api/internal/mailer"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/ratelimit"
 	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
 	"github.com/Naveenravi07/go-api/internal/utils"
 	"github.com/go-chi/chi/v5"
 )
 
 type UserHandler struct {
-	UserStore store.UserStore
-	logger    *log.Logger
+	UserStore      store.UserStore
+	tokenStore     store.TokenStore
+	socialStore    store.SocialStore
+	twoFactorStore store.TwoFactorStore
+	lockout        *ratelimit.Lockout
+	authorizer     *authz.Authorizer
+	mailer         mailer.Mailer
+	logger         *log.Logger
+	// deletionGrace is how long a deleted account can still be restored
+	deletionGrace time.Duration
 }
 
-func NewUserHandler(us store.UserStore, logger *log.Logger) *UserHandler {
-	return &UserHandler{UserStore: us, logger: logger}
+func NewUserHandler(us store.UserStore, tokenStore store.TokenStore, socialStore store.SocialStore, twoFactorStore store.TwoFactorStore, lockout *ratelimit.Lockout, authorizer *authz.Authorizer, mailer mailer.Mailer, deletionGrace time.Duration, logger *log.Logger) *UserHandler {
+	return &UserHandler{UserStore: us, tokenStore: tokenStore, socialStore: socialStore, twoFactorStore: twoFactorStore, lockout: lockout, authorizer: authorizer, mailer: mailer, deletionGrace: deletionGrace, logger: logger}
 }
 
-type reqisterUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Bio      string `json:"bio"`
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
 	Password string `json:"password"`
 }
 
+type reqisterUserRequest struct {
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Bio           string `json:"bio"`
+	Password      string `json:"password"`
+	PreferredUnit string `json:"preferred_unit"`
+	// ProfileVisibility defaults to public
+	ProfileVisibility string `json:"profile_visibility"`
+}
+
 func validateUser(user *reqisterUserRequest) error {
 	if user.Username == "" {
 		return errors.New(" username is required")
@@ -37,6 +64,14 @@ func validateUser(user *reqisterUserRequest) error {
 	if user.Password == "" {
 		return errors.New("Passowrd is required")
 	}
+	if user.PreferredUnit != "" {
+		if _, err := units.ParseWeightUnit(user.PreferredUnit); err != nil {
+			return err
+		}
+	}
+	if _, err := store.ParseVisibility(user.ProfileVisibility); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -61,6 +96,10 @@ func (uh *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 	if req.Bio != "" {
 		user.Bio = req.Bio
 	}
+	if req.PreferredUnit != "" {
+		user.PreferredUnit, _ = units.ParseWeightUnit(req.PreferredUnit)
+	}
+	user.ProfileVisibility, _ = store.ParseVisibility(req.ProfileVisibility)
 	err = user.PasswordHash.Set(req.Password)
 	if err != nil {
 		uh.logger.Printf("ERROR: hashing password failed %v", err)
@@ -73,6 +112,12 @@ func (uh *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create a new user"})
 		return
 	}
+	// the account works without a verified email, users can ask for a new
+	// verification email if this one does not arrive
+	err = sendVerification(r.Context(), uh.tokenStore, uh.mailer, CreatedUser)
+	if err != nil {
+		uh.logger.Printf("ERROR: sending verification email: %v", err)
+	}
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": CreatedUser})
 }
 
@@ -84,13 +129,42 @@ func (uh *UserHandler) GetUserByUsernameHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	user, err := uh.UserStore.GetUserByUsername(username)
-	if err != nil {
-		uh.logger.Printf("ERROR: GetUserByUsername: %v ", err)
+	// users see their own account and coaches the accounts of their
+	// athletes, everybody else the public profile
+	viewer := middleware.GetUser(r)
+	if !viewer.IsAnonymous() && viewer.Username == username {
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": viewer})
+		return
+	}
+
+	profile, err := uh.socialStore.GetProfile(username, viewer.Id)
+	if err == sql.ErrNoRows {
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user did not exist"})
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": user})
+	if err != nil {
+		uh.logger.Printf("ERROR: GetProfile: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	coaching, err := uh.authorizer.CanActFor(viewer.Id, profile.Id, authz.ViewAccount)
+	if err != nil {
+		uh.logger.Printf("ERROR: authorizing account access: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if coaching {
+		user, err := uh.UserStore.GetUserByUsername(username)
+		if err != nil || user == nil {
+			uh.logger.Printf("ERROR: GetUserByUsername: %v ", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": user})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": profile})
 }
 
 func (uh *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -102,6 +176,21 @@ func (uh *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if user.PreferredUnit != "" {
+		user.PreferredUnit, err = units.ParseWeightUnit(string(user.PreferredUnit))
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+	user.ProfileVisibility, err = store.ParseVisibility(string(user.ProfileVisibility))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	// users may only update their own account
+	user.Id = middleware.GetUser(r).Id
 	err = uh.UserStore.UpdateUser(&user)
 	if err != nil {
 		uh.logger.Printf("ERROR: failed to update user %v", err)
@@ -110,3 +199,97 @@ func (uh *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "user updated successfully"})
 }
+
+func (uh *UserHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+
+	user, err := uh.UserStore.VerifyEmail(req.Token)
+	if errors.Is(err, store.ErrTokenInvalid) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		uh.logger.Printf("ERROR: VerifyEmail: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": user})
+}
+
+// HandleResetPassword sets a new password with a token from
+// POST /tokens/password-reset. Existing authentication tokens stop working.
+func (uh *UserHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.logger.Printf("ERROR: decoding reset password body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if req.Token == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "token is required"})
+		return
+	}
+	if req.Password == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "password is required"})
+		return
+	}
+
+	_, err = uh.UserStore.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, store.ErrTokenInvalid) {
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		uh.logger.Printf("ERROR: ResetPassword: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": "your password was reset, please sign in again"})
+}
+
+// HandleDeleteAccount deletes the current user. The account stops working at
+// once and is purged for good after the grace period; until then it can be
+// restored with POST /user/restore. It asks for the password, and a code when
+// two-factor authentication is on, so that a stolen session alone cannot
+// delete it. Accounts created with an identity provider set a password with a
+// password reset first.
+func (uh *UserHandler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	var req twoFactorCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+
+	enabled, err := uh.twoFactorStore.IsEnabled(user.Id)
+	if err != nil {
+		uh.logger.Printf("ERROR: IsEnabled: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if !reauthenticate(w, uh.logger, uh.lockout, uh.twoFactorStore, user, req, enabled) {
+		return
+	}
+
+	deletedAt, err := uh.UserStore.DeleteUser(user.Id)
+	if err != nil {
+		uh.logger.Printf("ERROR: DeleteUser: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	purgeAt := deletedAt.Add(uh.deletionGrace)
+	err = uh.mailer.Send(r.Context(), mailer.AccountDeletionEmail(user.Email, user.Username, purgeAt))
+	if err != nil {
+		// the account is deleted either way
+		uh.logger.Printf("ERROR: sending account deletion email: %v", err)
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": utils.Envelope{"purge_at": purgeAt}})
+}
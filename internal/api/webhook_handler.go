@@ -0,0 +1,176 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/utils"
+	"github.com/Naveenravi07/go-api/internal/webhooks"
+)
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+	// allowPrivateNetworks accepts endpoints on loopback and private
+	// addresses, matching the dispatcher's setting
+	allowPrivateNetworks bool
+	logger               *log.Logger
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore, allowPrivateNetworks bool, logger *log.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore:         webhookStore,
+		allowPrivateNetworks: allowPrivateNetworks,
+		logger:               logger,
+	}
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+var webhookEventTypes = map[string]bool{
+	"*":                        true,
+	store.EventWorkoutCreated:  true,
+	store.EventWorkoutUpdated:  true,
+	store.EventWorkoutDeleted:  true,
+	store.EventWorkoutRestored: true,
+
+	store.EventWorkoutEntryCreated: true,
+	store.EventWorkoutEntryUpdated: true,
+	store.EventWorkoutEntryDeleted: true,
+
+	store.EventWorkoutSessionStarted:  true,
+	store.EventWorkoutSetLogged:       true,
+	store.EventWorkoutSessionFinished: true,
+
+	store.EventAchievementAwarded: true,
+	store.EventUserFollowed:       true,
+
+	store.EventCommentCreated: true,
+	store.EventReactionAdded:  true,
+}
+
+func validateWebhook(req *createWebhookRequest, allowPrivateNetworks bool) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) url")
+	}
+	if !allowPrivateNetworks && webhooks.ForbiddenHost(u.Hostname()) {
+		return errors.New("url must point to a public address")
+	}
+	for _, event := range req.Events {
+		if !webhookEventTypes[event] {
+			return errors.New("unknown event type " + event)
+		}
+	}
+	return nil
+}
+
+func (wh *WebhookHandler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("ERROR: decoding create webhook body %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid req body"})
+		return
+	}
+	if err := validateWebhook(&req, wh.allowPrivateNetworks); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if len(req.Events) == 0 {
+		req.Events = []string{"*"}
+	}
+	if req.Secret == "" {
+		req.Secret, err = webhooks.NewSecret()
+		if err != nil {
+			wh.logger.Printf("ERROR: generating webhook secret %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+	}
+
+	user := middleware.GetUser(r)
+	endpoint, err := wh.webhookStore.CreateEndpoint(&store.WebhookEndpoint{
+		UserId: user.Id,
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+		Active: true,
+	})
+	if err != nil {
+		wh.logger.Printf("ERROR: creating webhook endpoint %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to create webhook"})
+		return
+	}
+	// the secret is only ever shown on creation
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": endpoint})
+}
+
+func (wh *WebhookHandler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	endpoints, err := wh.webhookStore.GetEndpointsForUser(user.Id)
+	if err != nil {
+		wh.logger.Printf("ERROR: listing webhook endpoints %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": endpoints})
+}
+
+func (wh *WebhookHandler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookId, err := utils.ReadIdParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid webhook id "})
+		return
+	}
+
+	user := middleware.GetUser(r)
+	err = wh.webhookStore.DeleteEndpoint(webhookId, user.Id)
+	if err != nil {
+		wh.logger.Printf("ERROR: deleting webhook endpoint %v", err)
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook did not exist "})
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "webhook deleted successfully"})
+}
+
+func (wh *WebhookHandler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookId, err := utils.ReadIdParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid webhook id "})
+		return
+	}
+
+	endpoint, err := wh.webhookStore.GetEndpointById(webhookId)
+	if err == sql.ErrNoRows || (err == nil && endpoint.UserId != middleware.GetUser(r).Id) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "webhook did not exist "})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: GetEndpointById: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	deliveries, err := wh.webhookStore.GetDeliveries(webhookId, 100)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetDeliveries: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": deliveries})
+}
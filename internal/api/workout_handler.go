@@ -1,26 +1,43 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/Naveenravi07/go-api/internal/authz"
+	"github.com/Naveenravi07/go-api/internal/middleware"
 	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/units"
 	"github.com/Naveenravi07/go-api/internal/utils"
 )
 
 type WorkoutHandler struct {
 	workoutStore store.WorkoutStore
+	authorizer   *authz.Authorizer
 	logger       *log.Logger
+	// trashRetention is how long deleted workouts stay in the trash
+	trashRetention time.Duration
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, authorizer *authz.Authorizer, trashRetention time.Duration, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
-		workoutStore: workoutStore,
-		logger:       logger,
+		workoutStore:   workoutStore,
+		authorizer:     authorizer,
+		logger:         logger,
+		trashRetention: trashRetention,
 	}
 }
 
+// trashedWorkout is a workout in the trash with the time it is purged.
+type trashedWorkout struct {
+	*store.Workout
+	PurgeAt time.Time `json:"purge_at"`
+}
+
 func (wh *WorkoutHandler) HandleWorkoutById(w http.ResponseWriter, r *http.Request) {
 	workoutId, err := utils.ReadIdParam(r)
 	if err != nil {
@@ -29,12 +46,23 @@ func (wh *WorkoutHandler) HandleWorkoutById(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	unit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if !wh.authorizeView(w, r, workoutId) {
+		return
+	}
+
 	workout, err := wh.workoutStore.GetWorkoutById(workoutId)
 	if err != nil {
 		wh.logger.Printf("ERROR: GetWorkoutById: %v ", err)
 		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout did not exist "})
 		return
 	}
+	workout.ConvertWeights(units.Canonical, unit)
 	w.Header().Set("Content-Type", "application/json")
 	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": workout})
 }
@@ -48,13 +76,25 @@ func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Req
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err})
 		return
 	}
+	if _, err := store.ParseVisibility(string(workout.Visibility)); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
+	unit, outUnit, ok := readUnits(w, r, workout.WeightUnit)
+	if !ok {
+		return
+	}
+	workout.ConvertWeights(unit, units.Canonical)
+
+	workout.UserId = middleware.GetUser(r).Id
 	createdWorkout, err := wh.workoutStore.CreateWorkout(&workout)
 	if err != nil {
 		wh.logger.Printf("ERROR: failed to create workout %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err})
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
+	createdWorkout.ConvertWeights(units.Canonical, outUnit)
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdWorkout})
 }
 
@@ -67,9 +107,29 @@ func (wh *WorkoutHandler) HandleUpdateWorkout(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if !wh.authorize(w, r, int64(workout.Id), authz.EditWorkout) {
+		return
+	}
+	if _, err := store.ParseVisibility(string(workout.Visibility)); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	unit, _, ok := readUnits(w, r, workout.WeightUnit)
+	if !ok {
+		return
+	}
+	workout.ConvertWeights(unit, units.Canonical)
+
 	err = wh.workoutStore.UpdateWorkout(&workout)
+	if errors.Is(err, store.ErrUnknownEntry) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("ERROR: failed to update workout %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to update workout"})
+		return
 	}
 	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "workout updated successfully"})
 }
@@ -82,10 +142,114 @@ func (wh *WorkoutHandler) DeleteWorkoutHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	if !wh.authorize(w, r, workoutId, authz.DeleteWorkout) {
+		return
+	}
+
 	err = wh.workoutStore.DeleteWorkout(workoutId)
 	if err != nil {
-		wh.logger.Printf("ERROR: failed to update workout %v", err)
+		wh.logger.Printf("ERROR: failed to delete workout %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "failed to delete workout"})
+		return
 	}
 
 	utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"data": "workout deleted successfully"})
 }
+
+// HandleListTrash lists the deleted workouts of the current user that can
+// still be restored.
+func (wh *WorkoutHandler) HandleListTrash(w http.ResponseWriter, r *http.Request) {
+	workouts, err := wh.workoutStore.GetDeletedWorkouts(middleware.GetUser(r).Id)
+	if err != nil {
+		wh.logger.Printf("ERROR: GetDeletedWorkouts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	trash := make([]trashedWorkout, 0, len(workouts))
+	for _, workout := range workouts {
+		trash = append(trash, trashedWorkout{Workout: workout, PurgeAt: workout.DeletedAt.Add(wh.trashRetention)})
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": trash})
+}
+
+// HandleRestoreWorkout takes a workout of the current user out of the trash.
+func (wh *WorkoutHandler) HandleRestoreWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: readIDParam: %v ", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id "})
+		return
+	}
+
+	unit, err := displayUnit(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workout, err := wh.workoutStore.RestoreWorkout(workoutId, middleware.GetUser(r).Id)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout is not in the trash"})
+		return
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: RestoreWorkout: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	workout.ConvertWeights(units.Canonical, unit)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workout})
+}
+
+// authorize writes an error response and returns false unless the current
+// user may take action on the workout: its owner always may, coaches of the
+// owner may view and edit it.
+func (wh *WorkoutHandler) authorize(w http.ResponseWriter, r *http.Request, workoutId int64, action authz.Action) bool {
+	allowed, err := wh.permits(r, workoutId, action)
+	if err == sql.ErrNoRows {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout did not exist "})
+		return false
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: authorizing workout access: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	if !allowed && action == authz.ViewWorkout {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to view this workout"})
+		return false
+	}
+	if !allowed {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not allowed to modify this workout"})
+		return false
+	}
+	return true
+}
+
+// authorizeView reports hidden workouts as missing so their existence is not
+// leaked; coaches see the workouts of their athletes regardless of visibility.
+func (wh *WorkoutHandler) authorizeView(w http.ResponseWriter, r *http.Request, workoutId int64) bool {
+	visible, err := wh.workoutStore.CanViewWorkout(workoutId, middleware.GetUser(r).Id)
+	if err == nil && !visible {
+		visible, err = wh.permits(r, workoutId, authz.ViewWorkout)
+	}
+	if err == sql.ErrNoRows || (err == nil && !visible) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout did not exist "})
+		return false
+	}
+	if err != nil {
+		wh.logger.Printf("ERROR: CanViewWorkout: %v ", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	return true
+}
+
+func (wh *WorkoutHandler) permits(r *http.Request, workoutId int64, action authz.Action) (bool, error) {
+	ownerId, err := wh.workoutStore.GetWorkoutOwner(workoutId)
+	if err != nil {
+		return false, err
+	}
+	return wh.authorizer.CanActFor(middleware.GetUser(r).Id, ownerId, action)
+}
@@ -0,0 +1,76 @@
+// Package apikeys generates the personal API keys scripts and integrations
+// authenticate with. A key reads gapi_<prefix>_<secret>: the prefix is stored
+// in plaintext so users can tell their keys apart, the secret only hashed.
+package apikeys
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+)
+
+const marker = "gapi_"
+
+const (
+	prefixLength = 8
+	secretBytes  = 32
+)
+
+// Scope limits what a key may be used for.
+type Scope string
+
+const (
+	WorkoutsRead  Scope = "workouts:read"
+	WorkoutsWrite Scope = "workouts:write"
+	ProfileRead   Scope = "profile:read"
+)
+
+var scopes = map[Scope]bool{
+	WorkoutsRead:  true,
+	WorkoutsWrite: true,
+	ProfileRead:   true,
+}
+
+func (s Scope) Valid() bool {
+	return scopes[s]
+}
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Key is a newly generated key. Plaintext is shown to the user once.
+type Key struct {
+	Plaintext string
+	Prefix    string
+	Hash      []byte
+}
+
+func Generate() (*Key, error) {
+	random := make([]byte, 5+secretBytes)
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.ToLower(encoding.EncodeToString(random[:5]))[:prefixLength]
+	secret := strings.ToLower(encoding.EncodeToString(random[5:]))
+	plaintext := marker + prefix + "_" + secret
+	return &Key{Plaintext: plaintext, Prefix: prefix, Hash: tokens.Hash(plaintext)}, nil
+}
+
+// IsAPIKey tells API keys apart from the other bearer tokens.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, marker)
+}
+
+// Parse returns the prefix of a well formed key.
+func Parse(plaintext string) (string, bool) {
+	if !IsAPIKey(plaintext) {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(plaintext, marker), "_")
+	if !ok || len(prefix) != prefixLength || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
@@ -0,0 +1,53 @@
+package apikeys
+
+import (
+	"testing"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	key, err := Generate()
+	require.NoError(t, err)
+	assert.Regexp(t, `^gapi_[a-z2-7]{8}_[a-z2-7]{52}$`, key.Plaintext)
+	assert.Equal(t, tokens.Hash(key.Plaintext), key.Hash)
+
+	prefix, ok := Parse(key.Plaintext)
+	require.True(t, ok)
+	assert.Equal(t, key.Prefix, prefix)
+
+	other, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, key.Plaintext, other.Plaintext)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", "gapi_abcdefgh_secret", true},
+		{"opaque token", "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567", false},
+		{"no secret", "gapi_abcdefgh_", false},
+		{"short prefix", "gapi_abc_secret", false},
+		{"no separator", "gapi_abcdefghsecret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := Parse(tt.token)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestScopeValid(t *testing.T) {
+	assert.True(t, WorkoutsRead.Valid())
+	assert.True(t, WorkoutsWrite.Valid())
+	assert.True(t, ProfileRead.Valid())
+	assert.False(t, Scope("workouts:delete").Valid())
+	assert.False(t, Scope("*").Valid())
+}
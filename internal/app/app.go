@@ -6,17 +6,73 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Naveenravi07/go-api/internal/achievements"
 	"github.com/Naveenravi07/go-api/internal/api"
+	"github.com/Naveenravi07/go-api/internal/authz"
+	"github.com/Naveenravi07/go-api/internal/challenges"
+	"github.com/Naveenravi07/go-api/internal/jwt"
+	"github.com/Naveenravi07/go-api/internal/mailer"
+	"github.com/Naveenravi07/go-api/internal/middleware"
+	"github.com/Naveenravi07/go-api/internal/moderation"
+	"github.com/Naveenravi07/go-api/internal/oidc"
+	"github.com/Naveenravi07/go-api/internal/outbox"
+	"github.com/Naveenravi07/go-api/internal/ratelimit"
+	"github.com/Naveenravi07/go-api/internal/realtime"
+	"github.com/Naveenravi07/go-api/internal/retention"
 	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/webhooks"
 	"github.com/Naveenravi07/go-api/migrations"
 )
 
+const jwtIssuer = "go-api"
+
+const (
+	defaultAccountDeletionGrace  = 30 * 24 * time.Hour
+	defaultWorkoutTrashRetention = 30 * 24 * time.Hour
+)
+
+// defaultRateLimits are the rate limits by name, each can be overridden with
+// RATE_LIMIT_<NAME>, e.g. RATE_LIMIT_SIGNUP=10/1h.
+var defaultRateLimits = map[string]string{
+	// requests of signed in users and API keys
+	"api": "300/1m",
+	// per client address
+	"signup":  "5/1h",
+	"login":   "20/10m",
+	"refresh": "60/1m",
+	"email":   "5/1h",
+}
+
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	DB             *sql.DB
+	Logger              *log.Logger
+	WorkoutHandler      *api.WorkoutHandler
+	UserHandler         *api.UserHandler
+	TokenHandler        *api.TokenHandler
+	OIDCHandler         *api.OIDCHandler
+	TwoFactorHandler    *api.TwoFactorHandler
+	APIKeyHandler       *api.APIKeyHandler
+	WebhookHandler      *api.WebhookHandler
+	StreamHandler       *api.WorkoutStreamHandler
+	SessionHandler      *api.SessionHandler
+	MeasurementHandler  *api.MeasurementHandler
+	GoalHandler         *api.GoalHandler
+	AchievementHandler  *api.AchievementHandler
+	SocialHandler       *api.SocialHandler
+	CommentHandler      *api.CommentHandler
+	OrganizationHandler *api.OrganizationHandler
+	ChallengeHandler    *api.ChallengeHandler
+	Middleware          middleware.UserMiddleware
+	RateLimiter         *middleware.RateLimiter
+	RealtimeTailer      *realtime.Tailer
+	OutboxRelay         *outbox.Relay
+	WebhookDispatcher   *webhooks.Dispatcher
+	AccountPurger       *retention.Purger
+	WorkoutPurger       *retention.Purger
+	DB                  *sql.DB
 }
 
 func NewApplication() (*Application, error) {
@@ -32,22 +88,263 @@ func NewApplication() (*Application, error) {
 		panic(err)
 	}
 
+	err = configurePasswords()
+	if err != nil {
+		return nil, err
+	}
+
+	mail, err := newMailer()
+	if err != nil {
+		return nil, err
+	}
+
+	webhookStore := store.NewPostgresWebhookStore(pgDB)
+	// WEBHOOKS_ALLOW_PRIVATE_NETWORKS=true lets webhooks reach local
+	// receivers during development
+	allowPrivateWebhooks := os.Getenv("WEBHOOKS_ALLOW_PRIVATE_NETWORKS") == "true"
+	webhookHandler := api.NewWebhookHandler(webhookStore, allowPrivateWebhooks, logger)
+	dispatcher := webhooks.NewDispatcher(webhookStore, logger)
+	dispatcher.AllowPrivateNetworks = allowPrivateWebhooks
+
+	organizationStore := store.NewPostgresOrganizationStore(pgDB)
+	organizationHandler := api.NewOrganizationHandler(organizationStore, mail, logger)
+	authorizer := authz.NewAuthorizer(organizationStore)
+
 	workoutStore := store.NewPostgresWorkoutStore(pgDB)
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	trashRetention, err := retentionPeriod("WORKOUT_TRASH_RETENTION", defaultWorkoutTrashRetention)
+	if err != nil {
+		return nil, err
+	}
+	workoutHandler := api.NewWorkoutHandler(workoutStore, authorizer, trashRetention, logger)
+	workoutPurger := retention.NewPurger("workouts", workoutStore.PurgeDeletedWorkouts, trashRetention, logger)
+
+	commentStore := store.NewPostgresCommentStore(pgDB)
+	commentHandler := api.NewCommentHandler(commentStore, workoutStore, moderation.Chain{moderation.LinkLimit(3)}, logger)
+
+	sessionStore := store.NewPostgresSessionStore(pgDB)
+	sessionHandler := api.NewSessionHandler(sessionStore, logger)
+
+	measurementStore := store.NewPostgresMeasurementStore(pgDB)
+	measurementHandler := api.NewMeasurementHandler(measurementStore, logger)
+
+	goalStore := store.NewPostgresGoalStore(pgDB)
+	goalHandler := api.NewGoalHandler(goalStore, logger)
 
 	userStore := store.NewPostgresUserStore(pgDB)
-	userHander := api.NewUserHandler(userStore, logger)
+	tokenStore := store.NewPostgresTokenStore(pgDB)
+	socialStore := store.NewPostgresSocialStore(pgDB)
+	socialHandler := api.NewSocialHandler(socialStore, userStore, logger)
+	refreshTokenStore := store.NewPostgresRefreshTokenStore(pgDB)
+	twoFactorStore := store.NewPostgresTwoFactorStore(pgDB)
+	deletionGrace, err := retentionPeriod("ACCOUNT_DELETION_GRACE", defaultAccountDeletionGrace)
+	if err != nil {
+		return nil, err
+	}
+	accountPurger := retention.NewPurger("accounts", userStore.PurgeDeletedUsers, deletionGrace, logger)
+	apiKeyStore := store.NewPostgresAPIKeyStore(pgDB)
+	accessTokens, err := newAccessTokenKeys(logger)
+	if err != nil {
+		return nil, err
+	}
+	rateLimiter, err := newRateLimiter(pgDB, logger)
+	if err != nil {
+		return nil, err
+	}
+	lockout := ratelimit.NewLockout(rateLimiter.Store)
+	userHander := api.NewUserHandler(userStore, tokenStore, socialStore, twoFactorStore, lockout, authorizer, mail, deletionGrace, logger)
+	tokenHandler := api.NewTokenHandler(tokenStore, refreshTokenStore, userStore, twoFactorStore, accessTokens, lockout, mail, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(twoFactorStore, lockout, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	oidcHandler := api.NewOIDCHandler(oidcProviders(), store.NewPostgresIdentityStore(pgDB), refreshTokenStore, twoFactorStore, accessTokens, logger)
+
+	// each consumer is its own sink so that a failure of one does not run
+	// the others again
+	achievementEvents := outbox.NewSubscribers("achievements")
+	standingsEvents := outbox.NewSubscribers("standings")
+	outboxStore := store.NewPostgresOutboxStore(pgDB)
+	relay := outbox.NewRelay(outboxStore, logger, achievementEvents, standingsEvents, dispatcher)
+
+	achievementEngine := achievements.NewEngine(store.NewPostgresAchievementStore(pgDB), logger)
+	for _, eventType := range achievements.Triggers {
+		achievementEvents.Subscribe(eventType, achievementEngine.HandleEvent)
+	}
+	achievementHandler := api.NewAchievementHandler(achievementEngine, logger)
+
+	challengeStore := store.NewPostgresChallengeStore(pgDB)
+	challengeHandler := api.NewChallengeHandler(challengeStore, organizationStore, logger)
+	standingsRefresher := challenges.NewRefresher(challengeStore)
+	for _, eventType := range challenges.Triggers {
+		standingsEvents.Subscribe(eventType, standingsRefresher.HandleEvent)
+	}
+
+	hub := realtime.NewHub(64)
+	realtimeTailer := realtime.NewTailer(hub, outboxStore, logger)
+	streamHandler := api.NewWorkoutStreamHandler(hub, workoutStore, outboxStore, logger)
 
 	app := &Application{
-		Logger:         logger,
-		DB:             pgDB,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHander,
+		Logger:              logger,
+		DB:                  pgDB,
+		WorkoutHandler:      workoutHandler,
+		UserHandler:         userHander,
+		TokenHandler:        tokenHandler,
+		OIDCHandler:         oidcHandler,
+		TwoFactorHandler:    twoFactorHandler,
+		APIKeyHandler:       apiKeyHandler,
+		WebhookHandler:      webhookHandler,
+		StreamHandler:       streamHandler,
+		SessionHandler:      sessionHandler,
+		MeasurementHandler:  measurementHandler,
+		GoalHandler:         goalHandler,
+		AchievementHandler:  achievementHandler,
+		SocialHandler:       socialHandler,
+		CommentHandler:      commentHandler,
+		OrganizationHandler: organizationHandler,
+		ChallengeHandler:    challengeHandler,
+		Middleware:          middleware.UserMiddleware{UserStore: userStore, AccessTokens: accessTokens, APIKeys: apiKeyStore},
+		RateLimiter:         rateLimiter,
+		RealtimeTailer:      realtimeTailer,
+		OutboxRelay:         relay,
+		WebhookDispatcher:   dispatcher,
+		AccountPurger:       accountPurger,
+		WorkoutPurger:       workoutPurger,
 	}
 
 	return app, nil
 }
 
+// configurePasswords selects how new passwords are hashed from
+// PASSWORD_ALGORITHM (bcrypt or argon2id) and BCRYPT_COST. Existing hashes
+// are upgraded when their users next sign in.
+func configurePasswords() error {
+	params := store.DefaultPasswordParams
+	if value := os.Getenv("PASSWORD_ALGORITHM"); value != "" {
+		algorithm, err := store.ParsePasswordAlgorithm(value)
+		if err != nil {
+			return err
+		}
+		params.Algorithm = algorithm
+	}
+	if value := os.Getenv("BCRYPT_COST"); value != "" {
+		cost, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid BCRYPT_COST: %w", err)
+		}
+		params.BcryptCost = cost
+	}
+	return store.SetPasswordParams(params)
+}
+
+// newAccessTokenKeys reads the JWT signing keys from JWT_KEYS, a comma
+// separated list of kid:alg:base64 entries with the signing key first.
+// Without it a random key is generated and access tokens do not survive a
+// restart.
+func newAccessTokenKeys(logger *log.Logger) (*jwt.KeySet, error) {
+	spec := os.Getenv("JWT_KEYS")
+	if spec == "" {
+		logger.Println("WARN: JWT_KEYS is not set, signing access tokens with a temporary key")
+		key, err := jwt.GenerateEd25519Key("dev")
+		if err != nil {
+			return nil, err
+		}
+		return jwt.NewKeySet(jwtIssuer, key)
+	}
+	keys, err := jwt.ParseKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.NewKeySet(jwtIssuer, keys...)
+}
+
+// oidcProviders configures the providers named in OIDC_PROVIDERS, e.g.
+// "google", from OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and
+// _REDIRECT_URL. The redirect URL points at /auth/oidc/<name>/callback.
+func oidcProviders() []*oidc.Provider {
+	var providers []*oidc.Provider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, oidc.NewProvider(oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}, nil))
+	}
+	return providers
+}
+
+// retentionPeriod reads how long deleted records can be restored from the
+// environment variable name, e.g. ACCOUNT_DELETION_GRACE=720h.
+func retentionPeriod(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return period, nil
+}
+
+// newRateLimiter keeps limits in memory unless RATE_LIMIT_STORE=postgres,
+// which shares them between instances. TRUST_PROXY=true reads client
+// addresses from X-Forwarded-For.
+func newRateLimiter(db *sql.DB, logger *log.Logger) (*middleware.RateLimiter, error) {
+	limiter := &middleware.RateLimiter{
+		Limits:     map[string]ratelimit.Limit{},
+		Logger:     logger,
+		TrustProxy: os.Getenv("TRUST_PROXY") == "true",
+	}
+	switch backend := os.Getenv("RATE_LIMIT_STORE"); backend {
+	case "", "memory":
+		limiter.Store = ratelimit.NewMemoryStore()
+	case "postgres":
+		limiter.Store = store.NewPostgresRateLimitStore(db)
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_STORE %q", backend)
+	}
+
+	for name, value := range defaultRateLimits {
+		if override := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name)); override != "" {
+			value = override
+		}
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_%s: %w", strings.ToUpper(name), err)
+		}
+		limiter.Limits[name] = limit
+	}
+	return limiter, nil
+}
+
+// newMailer sends email through the SMTP server in SMTP_HOST. Without it
+// emails are written to the log for local development.
+func newMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "noreply@localhost"
+	}
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return mailer.NewLogMailer(os.Stdout, from), nil
+	}
+
+	port := 587
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		var err error
+		port, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+	}
+	return mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Server is up and running \n")
 }
@@ -0,0 +1,99 @@
+// Package authz decides what users may do with resources they do not own,
+// based on the roles they hold in shared organizations.
+package authz
+
+import "github.com/Naveenravi07/go-api/internal/store"
+
+type Action string
+
+// Actions on resources owned by another user.
+const (
+	ViewWorkout   Action = "workout:view"
+	EditWorkout   Action = "workout:edit"
+	DeleteWorkout Action = "workout:delete"
+	ViewAccount   Action = "account:view"
+)
+
+// Actions on an organization.
+const (
+	ViewMembers      Action = "organization:view_members"
+	ViewAthletes     Action = "organization:view_athletes"
+	InviteAthletes   Action = "organization:invite_athletes"
+	InviteStaff      Action = "organization:invite_staff"
+	RemoveMembers    Action = "organization:remove_members"
+	ManageAthletes   Action = "organization:manage_athletes"
+	ManageChallenges Action = "organization:manage_challenges"
+)
+
+// rolePermissions lists what each role may do within its organization.
+var rolePermissions = map[store.Role]map[Action]bool{
+	store.RoleOwner: {
+		ViewMembers: true, ViewAthletes: true, InviteAthletes: true, InviteStaff: true,
+		RemoveMembers: true, ManageAthletes: true, ManageChallenges: true,
+	},
+	store.RoleCoach: {
+		ViewMembers: true, ViewAthletes: true, InviteAthletes: true, ManageAthletes: true,
+		ManageChallenges: true,
+	},
+	store.RoleAthlete: {
+		ViewMembers: true,
+	},
+}
+
+// delegated lists the actions staff may take on the resources of athletes.
+// Deleting is never delegated.
+var delegated = map[Action]bool{
+	ViewWorkout: true,
+	EditWorkout: true,
+	ViewAccount: true,
+}
+
+// Permits reports whether role allows action within its organization.
+func Permits(role store.Role, action Action) bool {
+	return rolePermissions[role][action]
+}
+
+// Grants reports whether a member with role actor may take action on the
+// resources of a member with role subject of the same organization.
+func Grants(actor, subject store.Role, action Action) bool {
+	return delegated[action] && subject == store.RoleAthlete && Permits(actor, ManageAthletes)
+}
+
+// RoleStore looks up the roles two users share.
+type RoleStore interface {
+	GetRoles(actorId, subjectId int) ([]store.RolePair, error)
+}
+
+type Authorizer struct {
+	roles RoleStore
+}
+
+func NewAuthorizer(roles RoleStore) *Authorizer {
+	return &Authorizer{roles: roles}
+}
+
+// CanActFor reports whether actorId may take action on a resource owned by
+// ownerId. Owners may do anything with their own resources; anonymous users
+// and resources without an owner are never delegated.
+func (a *Authorizer) CanActFor(actorId, ownerId int, action Action) (bool, error) {
+	if actorId == 0 || ownerId == 0 {
+		return false, nil
+	}
+	if actorId == ownerId {
+		return true, nil
+	}
+	if !delegated[action] {
+		return false, nil
+	}
+
+	pairs, err := a.roles.GetRoles(actorId, ownerId)
+	if err != nil {
+		return false, err
+	}
+	for _, pair := range pairs {
+		if Grants(pair.Actor, pair.Subject, action) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
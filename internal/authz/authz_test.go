@@ -0,0 +1,70 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryRoleStore map[[2]int][]store.RolePair
+
+func (m memoryRoleStore) GetRoles(actorId, subjectId int) ([]store.RolePair, error) {
+	return m[[2]int{actorId, subjectId}], nil
+}
+
+func TestCanActFor(t *testing.T) {
+	const (
+		owner   = 1
+		coach   = 2
+		athlete = 3
+		other   = 4
+	)
+	roles := memoryRoleStore{
+		{coach, athlete}: {{Actor: store.RoleCoach, Subject: store.RoleAthlete}},
+		{athlete, coach}: {{Actor: store.RoleAthlete, Subject: store.RoleCoach}},
+		{owner, coach}:   {{Actor: store.RoleOwner, Subject: store.RoleCoach}},
+		// shared through two organizations, only one of which makes other a coach
+		{other, athlete}: {
+			{Actor: store.RoleAthlete, Subject: store.RoleAthlete},
+			{Actor: store.RoleCoach, Subject: store.RoleAthlete},
+		},
+	}
+	authorizer := NewAuthorizer(roles)
+
+	tests := []struct {
+		name    string
+		actor   int
+		subject int
+		action  Action
+		want    bool
+	}{
+		{name: "own workout", actor: athlete, subject: athlete, action: DeleteWorkout, want: true},
+		{name: "coach edits athlete", actor: coach, subject: athlete, action: EditWorkout, want: true},
+		{name: "coach views athlete account", actor: coach, subject: athlete, action: ViewAccount, want: true},
+		{name: "coach cannot delete", actor: coach, subject: athlete, action: DeleteWorkout, want: false},
+		{name: "athlete cannot view coach", actor: athlete, subject: coach, action: ViewWorkout, want: false},
+		{name: "owner cannot edit coach", actor: owner, subject: coach, action: EditWorkout, want: false},
+		{name: "any organization grants", actor: other, subject: athlete, action: ViewWorkout, want: true},
+		{name: "no shared organization", actor: owner, subject: athlete, action: ViewWorkout, want: false},
+		{name: "anonymous", actor: 0, subject: athlete, action: ViewWorkout, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authorizer.CanActFor(tt.actor, tt.subject, tt.action)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPermits(t *testing.T) {
+	assert.True(t, Permits(store.RoleOwner, InviteStaff))
+	assert.False(t, Permits(store.RoleCoach, InviteStaff))
+	assert.True(t, Permits(store.RoleCoach, InviteAthletes))
+	assert.False(t, Permits(store.RoleAthlete, ViewAthletes))
+	assert.True(t, Permits(store.RoleAthlete, ViewMembers))
+	assert.False(t, Permits("", ViewMembers))
+}
@@ -0,0 +1,39 @@
+// Package challenges keeps the cached challenge standings up to date.
+package challenges
+
+import (
+	"context"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+// Triggers are the events after which the standings of a user are
+// recomputed. Deletions are included so removed workouts stop counting, and
+// restores so they count again.
+var Triggers = []string{
+	store.EventWorkoutCreated,
+	store.EventWorkoutUpdated,
+	store.EventWorkoutDeleted,
+	store.EventWorkoutRestored,
+	store.EventWorkoutSessionFinished,
+}
+
+// StandingsStore is the part of store.ChallengeStore the refresher needs.
+type StandingsStore interface {
+	RefreshStandings(userId int) error
+}
+
+type Refresher struct {
+	store StandingsStore
+}
+
+func NewRefresher(standingsStore StandingsStore) *Refresher {
+	return &Refresher{store: standingsStore}
+}
+
+func (r *Refresher) HandleEvent(ctx context.Context, event store.Event) error {
+	if event.UserId == 0 {
+		return nil
+	}
+	return r.store.RefreshStandings(event.UserId)
+}
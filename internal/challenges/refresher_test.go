@@ -0,0 +1,30 @@
+package challenges
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingStore struct {
+	refreshed []int
+}
+
+func (s *recordingStore) RefreshStandings(userId int) error {
+	s.refreshed = append(s.refreshed, userId)
+	return nil
+}
+
+func TestRefresherHandleEvent(t *testing.T) {
+	standings := &recordingStore{}
+	refresher := NewRefresher(standings)
+
+	require.NoError(t, refresher.HandleEvent(context.Background(), store.Event{Type: store.EventWorkoutDeleted, UserId: 7}))
+	// workouts without an owner take part in no challenge
+	require.NoError(t, refresher.HandleEvent(context.Background(), store.Event{Type: store.EventWorkoutCreated}))
+
+	assert.Equal(t, []int{7}, standings.refreshed)
+}
@@ -0,0 +1,237 @@
+// Package jwt issues and verifies the signed access tokens of the API. Tokens
+// are compact JWS signed with Ed25519 (EdDSA) or HMAC-SHA256 (HS256); the
+// kid header selects the verification key so that keys can be rotated.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+)
+
+// leeway tolerates clock skew between servers when checking exp and iat.
+const leeway = 30 * time.Second
+
+var (
+	ErrMalformed  = errors.New("malformed token")
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrSignature  = errors.New("invalid token signature")
+	ErrExpired    = errors.New("token expired")
+	ErrIssuer     = errors.New("token issued by another issuer")
+)
+
+type Key struct {
+	Id        string
+	Algorithm string
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+	secret    []byte
+}
+
+func NewEd25519Key(id string, private ed25519.PrivateKey) *Key {
+	return &Key{Id: id, Algorithm: AlgEdDSA, private: private, public: private.Public().(ed25519.PublicKey)}
+}
+
+// NewHMACKey returns an HS256 key. Secrets shorter than the 32 byte hash
+// output are rejected.
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < sha256.Size {
+		return nil, fmt.Errorf("jwt: HS256 secret of key %q must have at least %d bytes", id, sha256.Size)
+	}
+	return &Key{Id: id, Algorithm: AlgHS256, secret: secret}, nil
+}
+
+// GenerateEd25519Key returns a new random key, e.g. for development where
+// tokens need not outlive the process.
+func GenerateEd25519Key(id string) (*Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewEd25519Key(id, private), nil
+}
+
+// ParseKeys reads keys from a comma separated list of kid:alg:base64 entries,
+// where the value is the 32 byte Ed25519 seed or the HS256 secret encoded
+// with standard base64.
+func ParseKeys(spec string) ([]*Key, error) {
+	var keys []*Key
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("jwt: key %q must be kid:alg:base64", entry)
+		}
+		value, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("jwt: decoding key %q: %w", parts[0], err)
+		}
+
+		switch parts[1] {
+		case AlgEdDSA:
+			if len(value) != ed25519.SeedSize {
+				return nil, fmt.Errorf("jwt: EdDSA key %q must be a %d byte seed", parts[0], ed25519.SeedSize)
+			}
+			keys = append(keys, NewEd25519Key(parts[0], ed25519.NewKeyFromSeed(value)))
+		case AlgHS256:
+			key, err := NewHMACKey(parts[0], value)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		default:
+			return nil, fmt.Errorf("jwt: key %q has unsupported algorithm %q", parts[0], parts[1])
+		}
+	}
+	return keys, nil
+}
+
+func (k *Key) sign(input []byte) []byte {
+	if k.Algorithm == AlgEdDSA {
+		return ed25519.Sign(k.private, input)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k *Key) verify(input, signature []byte) bool {
+	if k.Algorithm == AlgEdDSA {
+		return ed25519.Verify(k.public, input, signature)
+	}
+	return hmac.Equal(k.sign(input), signature)
+}
+
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Id        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyId     string `json:"kid"`
+}
+
+// KeySet signs with its first key and verifies with all of them. To rotate,
+// put the new key first and keep the previous one until the access tokens
+// it signed have expired.
+type KeySet struct {
+	Issuer  string
+	signing *Key
+	keys    map[string]*Key
+	now     func() time.Time
+}
+
+func NewKeySet(issuer string, keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("jwt: a key set needs at least one key")
+	}
+	set := &KeySet{Issuer: issuer, signing: keys[0], keys: map[string]*Key{}, now: time.Now}
+	for _, key := range keys {
+		if _, ok := set.keys[key.Id]; ok {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", key.Id)
+		}
+		set.keys[key.Id] = key
+	}
+	return set, nil
+}
+
+var encoding = base64.RawURLEncoding
+
+// Issue returns a token for subject that expires after ttl.
+func (s *KeySet) Issue(subject string, ttl time.Duration) (string, *Claims, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", nil, err
+	}
+	now := s.now()
+	claims := &Claims{
+		Issuer:    s.Issuer,
+		Subject:   subject,
+		Id:        encoding.EncodeToString(id),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	headerJSON, err := json.Marshal(header{Algorithm: s.signing.Algorithm, Type: "JWT", KeyId: s.signing.Id})
+	if err != nil {
+		return "", nil, err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	input := encoding.EncodeToString(headerJSON) + "." + encoding.EncodeToString(claimsJSON)
+	return input + "." + encoding.EncodeToString(s.signing.sign([]byte(input))), claims, nil
+}
+
+// Verify checks the signature, issuer and lifetime of token. The algorithm in
+// the header must match the one of the key, which rules out "none" and
+// algorithm confusion.
+func (s *KeySet) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	headerJSON, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, ErrMalformed
+	}
+	key, ok := s.keys[h.KeyId]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if h.Algorithm != key.Algorithm {
+		return nil, ErrSignature
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrSignature
+	}
+
+	claimsJSON, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if claims.Issuer != s.Issuer {
+		return nil, ErrIssuer
+	}
+	now := s.now()
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) || now.Add(leeway).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+// IsJWT tells compact JWS tokens apart from the opaque tokens of the tokens
+// package, which never contain a dot.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hmacKey(t *testing.T, id string) *Key {
+	key, err := NewHMACKey(id, bytes.Repeat([]byte(id[:1]), 32))
+	require.NoError(t, err)
+	return key
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	edKey, err := GenerateEd25519Key("ed-1")
+	require.NoError(t, err)
+
+	for _, key := range []*Key{edKey, hmacKey(t, "hs-1")} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			set, err := NewKeySet("go-api", key)
+			require.NoError(t, err)
+
+			token, issued, err := set.Issue("42", 15*time.Minute)
+			require.NoError(t, err)
+			assert.True(t, IsJWT(token))
+
+			claims, err := set.Verify(token)
+			require.NoError(t, err)
+			assert.Equal(t, "42", claims.Subject)
+			assert.Equal(t, issued.Id, claims.Id)
+
+			// any change to the payload breaks the signature
+			parts := strings.Split(token, ".")
+			forged := strings.Replace(parts[1], parts[1][:4], "eyJz", 1)
+			_, err = set.Verify(parts[0] + "." + forged + "." + parts[2])
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	oldKey, newKey := hmacKey(t, "a-2023"), hmacKey(t, "b-2024")
+	before, err := NewKeySet("go-api", oldKey)
+	require.NoError(t, err)
+	token, _, err := before.Issue("7", time.Hour)
+	require.NoError(t, err)
+
+	// the retired key keeps verifying until it is removed
+	rotated, err := NewKeySet("go-api", newKey, oldKey)
+	require.NoError(t, err)
+	_, err = rotated.Verify(token)
+	assert.NoError(t, err)
+
+	removed, err := NewKeySet("go-api", newKey)
+	require.NoError(t, err)
+	_, err = removed.Verify(token)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key := hmacKey(t, "hs-1")
+	set, err := NewKeySet("go-api", key)
+	require.NoError(t, err)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	set.now = func() time.Time { return now }
+	token, _, err := set.Issue("1", 15*time.Minute)
+	require.NoError(t, err)
+
+	t.Run("expired", func(t *testing.T) {
+		set.now = func() time.Time { return now.Add(16 * time.Minute) }
+		defer func() { set.now = func() time.Time { return now } }()
+		_, err := set.Verify(token)
+		assert.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("other issuer", func(t *testing.T) {
+		other, err := NewKeySet("someone-else", key)
+		require.NoError(t, err)
+		other.now = set.now
+		_, err = other.Verify(token)
+		assert.ErrorIs(t, err, ErrIssuer)
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"hs-1"}`))
+		_, err := set.Verify(none + "." + parts[1] + ".")
+		assert.ErrorIs(t, err, ErrSignature)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := set.Verify("not-a-token")
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	seed := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	keys, err := ParseKeys("k2:EdDSA:" + seed + ", k1:HS256:" + seed)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "k2", keys[0].Id)
+	assert.Equal(t, AlgEdDSA, keys[0].Algorithm)
+	assert.Equal(t, AlgHS256, keys[1].Algorithm)
+
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+	for _, spec := range []string{"k1:HS256:" + short, "k1:RS256:" + seed, "k1:" + seed, "k1:EdDSA:" + short} {
+		_, err := ParseKeys(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogMailerSend(t *testing.T) {
+	var out bytes.Buffer
+	m := NewLogMailer(&out, "noreply@example.com")
+
+	expiry := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	err := m.Send(context.Background(), PasswordResetEmail("sam@example.com", "sam", "TOKEN123", expiry))
+	require.NoError(t, err)
+
+	mail := out.String()
+	assert.Contains(t, mail, "From: noreply@example.com\r\n")
+	assert.Contains(t, mail, "To: sam@example.com\r\n")
+	assert.Contains(t, mail, "Subject: Reset your password\r\n")
+	assert.Contains(t, mail, "TOKEN123")
+	assert.Contains(t, mail, "Jun 1, 2024 at 12:00 UTC")
+	// bodies use CRLF line endings only
+	assert.NotContains(t, strings.ReplaceAll(mail, "\r\n", ""), "\n")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		wantErr bool
+	}{
+		{name: "valid", msg: Message{To: "sam@example.com", Subject: "Hi"}},
+		{name: "missing recipient", msg: Message{Subject: "Hi"}, wantErr: true},
+		{name: "not an address", msg: Message{To: "sam", Subject: "Hi"}, wantErr: true},
+		{name: "header injection", msg: Message{To: "sam@example.com\r\nBcc: eve@example.com", Subject: "Hi"}, wantErr: true},
+		{name: "subject injection", msg: Message{To: "sam@example.com", Subject: "Hi\nBcc: eve@example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(tt.msg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
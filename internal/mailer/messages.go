@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+const expiryLayout = "Jan 2, 2006 at 15:04 MST"
+
+func VerificationEmail(to, username, token string, expiry time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(`Hi %s,
+
+please confirm this is your email address by sending the token below to
+PUT /user/verified as {"token": "<token>"}.
+
+%s
+
+The token can be used once and expires on %s.
+If you did not create an account you can ignore this email.
+`, username, token, expiry.UTC().Format(expiryLayout)),
+	}
+}
+
+func PasswordResetEmail(to, username, token string, expiry time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(`Hi %s,
+
+somebody asked to reset the password of your account. To choose a new
+password send the token below to PUT /user/password as
+{"token": "<token>", "password": "<new password>"}.
+
+%s
+
+The token can be used once and expires on %s.
+If you did not ask for a reset you can ignore this email, your password
+stays unchanged.
+`, username, token, expiry.UTC().Format(expiryLayout)),
+	}
+}
+
+func InvitationEmail(to, role, token string, expiry time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "You have been invited to an organization",
+		Body: fmt.Sprintf(`Hi,
+
+you have been invited to join an organization as %s. Sign in with this
+email address and send the token below to POST /invitations/accept as
+{"token": "<token>"}.
+
+%s
+
+The invitation expires on %s.
+`, role, token, expiry.UTC().Format(expiryLayout)),
+	}
+}
+
+func AccountDeletionEmail(to, username string, purgeAt time.Time) Message {
+	return Message{
+		To:      to,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf(`Hi %s,
+
+your account was deleted and can no longer be used. It and all of your
+workouts will be removed for good on %s.
+
+Changed your mind? Until then you can restore the account by sending your
+username and password to POST /user/restore.
+`, username, purgeAt.UTC().Format(expiryLayout)),
+	}
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Naveenravi07/go-api/internal/apikeys"
+	"github.com/Naveenravi07/go-api/internal/jwt"
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/Naveenravi07/go-api/internal/tokens"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+type UserMiddleware struct {
+	UserStore store.UserStore
+	// AccessTokens verifies signed access tokens; without it only opaque
+	// authentication tokens are accepted
+	AccessTokens *jwt.KeySet
+	// APIKeys authenticates personal API keys; without it they are rejected
+	APIKeys store.APIKeyStore
+}
+
+type contextKey string
+
+const (
+	UserContextKey   = contextKey("user")
+	APIKeyContextKey = contextKey("api_key")
+)
+
+func SetUser(r *http.Request, user *store.User) *http.Request {
+	ctx := context.WithValue(r.Context(), UserContextKey, user)
+	return r.WithContext(ctx)
+}
+
+func GetUser(r *http.Request) *store.User {
+	user, ok := r.Context().Value(UserContextKey).(*store.User)
+	if !ok {
+		return store.AnonymousUser
+	}
+	return user
+}
+
+// GetAPIKey returns the key the request was authenticated with, or nil for
+// requests of signed in users.
+func GetAPIKey(r *http.Request) *store.APIKey {
+	key, _ := r.Context().Value(APIKeyContextKey).(*store.APIKey)
+	return key
+}
+
+func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			r = SetUser(r, store.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid authorization header"})
+			return
+		}
+
+		var user *store.User
+		var err error
+		if um.AccessTokens != nil && jwt.IsJWT(headerParts[1]) {
+			user, err = um.userFromJWT(headerParts[1])
+		} else if apikeys.IsAPIKey(headerParts[1]) {
+			var key *store.APIKey
+			user, key, err = um.userFromAPIKey(headerParts[1])
+			if key != nil {
+				r = r.WithContext(context.WithValue(r.Context(), APIKeyContextKey, key))
+			}
+		} else {
+			user, err = um.UserStore.GetUserToken(tokens.ScopeAuth, headerParts[1])
+		}
+		if err != nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+			return
+		}
+		if user == nil {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token expired or invalid"})
+			return
+		}
+
+		r = SetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// userFromJWT returns nil for invalid or expired tokens and for users that no
+// longer exist.
+func (um *UserMiddleware) userFromJWT(token string) (*store.User, error) {
+	claims, err := um.AccessTokens.Verify(token)
+	if err != nil {
+		return nil, nil
+	}
+	userId, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, nil
+	}
+	return um.UserStore.GetUserById(userId)
+}
+
+func (um *UserMiddleware) userFromAPIKey(plaintextKey string) (*store.User, *store.APIKey, error) {
+	if um.APIKeys == nil {
+		return nil, nil, nil
+	}
+	if _, ok := apikeys.Parse(plaintextKey); !ok {
+		return nil, nil, nil
+	}
+	return um.APIKeys.GetUserForAPIKey(plaintextKey)
+}
+
+// RequireUser lets signed in users through. API keys only work on routes
+// that name the scope they need with RequireScope or AllowScope.
+func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if user.IsAnonymous() {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this route"})
+			return
+		}
+		if GetAPIKey(r) != nil {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api keys cannot access this route"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope is RequireUser for routes API keys with the scope may use.
+func (um *UserMiddleware) RequireScope(scope apikeys.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if user.IsAnonymous() {
+			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this route"})
+			return
+		}
+		if !hasScope(r, scope) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api key is missing the " + string(scope) + " scope"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowScope guards routes anonymous users may use as well.
+func (um *UserMiddleware) AllowScope(scope apikeys.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasScope(r, scope) {
+			utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "api key is missing the " + string(scope) + " scope"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasScope(r *http.Request, scope apikeys.Scope) bool {
+	key := GetAPIKey(r)
+	return key == nil || key.HasScope(string(scope))
+}
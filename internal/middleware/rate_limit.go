@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Naveenravi07/go-api/internal/ratelimit"
+	"github.com/Naveenravi07/go-api/internal/utils"
+)
+
+// KeyFunc names the identity a request is counted against.
+type KeyFunc func(r *http.Request) string
+
+type RateLimiter struct {
+	Store ratelimit.Store
+	// Limits are the limits of the routes by name
+	Limits map[string]ratelimit.Limit
+	Logger *log.Logger
+	// TrustProxy takes the client address from X-Forwarded-For, as set by
+	// the proxy in front of the API
+	TrustProxy bool
+}
+
+// ClientIP is the address of the client, or of the proxy in front of the API
+// unless TrustProxy is set.
+func (rl *RateLimiter) ClientIP(r *http.Request) string {
+	if rl.TrustProxy {
+		// the last entry is the one the proxy added, the others are up to
+		// the client
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByIP counts requests per client address.
+func (rl *RateLimiter) ByIP(r *http.Request) string {
+	return "ip:" + rl.ClientIP(r)
+}
+
+// ByIdentity counts requests per API key or signed in user, and anonymous
+// requests per client address.
+func (rl *RateLimiter) ByIdentity(r *http.Request) string {
+	if key := GetAPIKey(r); key != nil {
+		return fmt.Sprintf("key:%d", key.Id)
+	}
+	if user := GetUser(r); !user.IsAnonymous() {
+		return fmt.Sprintf("user:%d", user.Id)
+	}
+	return rl.ByIP(r)
+}
+
+// Limit applies the limit called name to a route. Responses carry the
+// RateLimit headers; rejected requests also get Retry-After. The route stays
+// open when the store fails, so an outage of the store does not take the API
+// down with it.
+func (rl *RateLimiter) Limit(name string, by KeyFunc, next http.HandlerFunc) http.HandlerFunc {
+	limit, ok := rl.Limits[name]
+	if !ok {
+		panic("no rate limit named " + name)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := rl.Store.Take(name+":"+by(r), limit)
+		if err != nil {
+			rl.Logger.Printf("ERROR: rate limit %s: %v", name, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds())))
+		h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(result.Reset.Seconds())))
+		if !result.Allowed {
+			h.Set("Retry-After", strconv.Itoa(int(result.RetryAfter.Seconds())))
+			utils.WriteJSON(w, http.StatusTooManyRequests, utils.Envelope{"error": "rate limit exceeded, try again later"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitAll applies the limit called name to every route of a group.
+func (rl *RateLimiter) LimitAll(name string, by KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return rl.Limit(name, by, next.ServeHTTP)
+	}
+}
@@ -0,0 +1,95 @@
+// Package moderation reviews user generated text before it is published.
+package moderation
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Verdict int
+
+const (
+	// Approve publishes the text right away.
+	Approve Verdict = iota
+	// Hold stores the text but only shows it to its author and the owner of
+	// the content it was posted on until the owner approves it.
+	Hold
+	// Reject refuses the text.
+	Reject
+)
+
+type Decision struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// Hook reviews a piece of text. Hooks must be safe for concurrent use.
+type Hook interface {
+	Review(text string) (Decision, error)
+}
+
+// HookFunc adapts a function to the Hook interface.
+type HookFunc func(text string) (Decision, error)
+
+func (f HookFunc) Review(text string) (Decision, error) {
+	return f(text)
+}
+
+// Chain runs every hook and returns the strictest decision. The reason of the
+// first hook reaching that verdict is kept.
+type Chain []Hook
+
+func (c Chain) Review(text string) (Decision, error) {
+	decision := Decision{Verdict: Approve}
+	for _, hook := range c {
+		d, err := hook.Review(text)
+		if err != nil {
+			return Decision{}, err
+		}
+		if d.Verdict > decision.Verdict {
+			decision = d
+		}
+		if decision.Verdict == Reject {
+			break
+		}
+	}
+	return decision, nil
+}
+
+// WordFilter rejects text containing any of the words, ignoring case.
+type WordFilter struct {
+	words map[string]bool
+}
+
+func NewWordFilter(words ...string) *WordFilter {
+	f := &WordFilter{words: map[string]bool{}}
+	for _, word := range words {
+		f.words[strings.ToLower(word)] = true
+	}
+	return f
+}
+
+func (f *WordFilter) Review(text string) (Decision, error) {
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isSeparator) {
+		if f.words[word] {
+			return Decision{Verdict: Reject, Reason: "text contains blocked language"}, nil
+		}
+	}
+	return Decision{Verdict: Approve}, nil
+}
+
+func isSeparator(r rune) bool {
+	return !(r == '\'' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 127)
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+
+// LinkLimit holds text with more links than allowed, a common sign of spam.
+type LinkLimit int
+
+func (l LinkLimit) Review(text string) (Decision, error) {
+	if len(linkPattern.FindAllStringIndex(text, -1)) > int(l) {
+		return Decision{Verdict: Hold, Reason: "too many links"}, nil
+	}
+	return Decision{Verdict: Approve}, nil
+}
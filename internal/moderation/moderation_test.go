@@ -0,0 +1,42 @@
+package moderation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	chain := Chain{NewWordFilter("Spam"), LinkLimit(1)}
+
+	tests := []struct {
+		name string
+		text string
+		want Verdict
+	}{
+		{name: "clean", text: "Great session, that PR was huge!", want: Approve},
+		{name: "one link", text: "My plan: https://example.com/plan", want: Approve},
+		{name: "too many links", text: "https://a.example and www.b.example", want: Hold},
+		{name: "blocked word ignores case", text: "buy SPAM now", want: Reject},
+		{name: "blocked word inside another word", text: "spammer", want: Approve},
+		{name: "reject wins over hold", text: "spam https://a.example https://b.example", want: Reject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := chain.Review(tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, decision.Verdict)
+		})
+	}
+}
+
+func TestChainError(t *testing.T) {
+	failing := HookFunc(func(string) (Decision, error) {
+		return Decision{}, errors.New("classifier unavailable")
+	})
+	_, err := Chain{LinkLimit(1), failing}.Review("hello")
+	assert.Error(t, err)
+}
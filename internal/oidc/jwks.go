@@ -0,0 +1,145 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jwksTTL = time.Hour
+	// jwksMinRefresh limits how often tokens with unknown key ids make us
+	// fetch the key set again
+	jwksMinRefresh = time.Minute
+)
+
+var ErrUnknownKey = errors.New("id token signed with unknown key")
+
+type jwk struct {
+	KeyId string `json:"kid"`
+	Type  string `json:"kty"`
+	Use   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// publicKey returns the RSA or P-256 key, or nil for keys we cannot use.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, nil
+	}
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Type {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31 {
+			return nil, fmt.Errorf("oidc: RSA exponent of key %q is too large", k.KeyId)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, nil
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("oidc: EC key %q is not on P-256", k.KeyId)
+		}
+		return key, nil
+	}
+	return nil, nil
+}
+
+// keyCache keeps the provider's signing keys for an hour. A token signed
+// with a key we do not know yet triggers an early refresh, which is how
+// providers roll their keys.
+type keyCache struct {
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	uri       string
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeyCache(client *http.Client, now func() time.Time) *keyCache {
+	return &keyCache{client: client, now: now}
+}
+
+func (c *keyCache) get(ctx context.Context, uri, keyId string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := c.now().Sub(c.fetchedAt)
+	if c.uri == uri && age < jwksTTL {
+		if key, ok := c.lookup(keyId); ok {
+			return key, nil
+		}
+		if age < jwksMinRefresh {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := getJSON(ctx, c.client, uri, &set)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			keys[k.KeyId] = key
+		}
+	}
+	c.uri, c.keys, c.fetchedAt = uri, keys, c.now()
+
+	if key, ok := c.lookup(keyId); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// lookup falls back to the only key when the token names none.
+func (c *keyCache) lookup(keyId string) (crypto.PublicKey, bool) {
+	if keyId == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[keyId]
+	return key, ok
+}
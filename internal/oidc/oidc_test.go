@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider is a minimal OpenID provider: it hands out one code per
+// authorization request and checks the PKCE verifier when it is redeemed.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	keyId  string
+
+	mu          sync.Mutex
+	jwksFetches int
+	challenges  map[string]string
+	nonces      map[string]string
+	claims      map[string]interface{}
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockProvider{t: t, key: key, keyId: "key-1", challenges: map[string]string{}, nonces: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.jwksFetches++
+		pub := m.key.PublicKey
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": m.keyId, "kty": "RSA", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		m.mu.Lock()
+		challenge, ok := m.challenges[r.PostForm.Get("code")]
+		nonce := m.nonces[r.PostForm.Get("code")]
+		delete(m.challenges, r.PostForm.Get("code"))
+		m.mu.Unlock()
+		if !ok || CodeChallenge(r.PostForm.Get("code_verifier")) != challenge || r.PostForm.Get("client_id") != "client-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(m.idTokenClaims(nonce))})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize plays the user signing in: it returns the code the provider
+// would redirect back with.
+func (m *mockProvider) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(m.t, err)
+	query := u.Query()
+	require.Equal(m.t, "S256", query.Get("code_challenge_method"))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code = "code-" + query.Get("state")[:8]
+	m.challenges[code] = query.Get("code_challenge")
+	m.nonces[code] = query.Get("nonce")
+	return code, query.Get("state")
+}
+
+func (m *mockProvider) idTokenClaims(nonce string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": m.server.URL, "sub": "248289761001", "aud": "client-1", "nonce": nonce,
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		"email": "jane@example.com", "email_verified": true, "name": "Jane Doe",
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	return claims
+}
+
+func (m *mockProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": m.keyId, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	require.NoError(m.t, err)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name: "mock", Issuer: m.server.URL, ClientID: "client-1", ClientSecret: "secret",
+		RedirectURL: "http://localhost/auth/oidc/mock/callback",
+	}, m.server.Client())
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	ctx := context.Background()
+
+	req, err := NewAuthRequest()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	require.NoError(t, err)
+	code, state := mock.authorize(authURL)
+	assert.Equal(t, req.State, state)
+
+	token, err := provider.Exchange(ctx, code, req)
+	require.NoError(t, err)
+	assert.Equal(t, "248289761001", token.Subject)
+	assert.Equal(t, "jane@example.com", token.Email)
+	assert.True(t, token.EmailVerified)
+
+	// codes are single use
+	_, err = provider.Exchange(ctx, code, req)
+	assert.Error(t, err)
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	ctx := context.Background()
+
+	req, err := NewAuthRequest()
+	require.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	require.NoError(t, err)
+	code, _ := mock.authorize(authURL)
+
+	other, err := NewAuthRequest()
+	require.NoError(t, err)
+	_, err = provider.Exchange(ctx, code, &AuthRequest{State: req.State, Nonce: req.Nonce, CodeVerifier: other.CodeVerifier})
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		nonce   string
+		wantErr error
+	}{
+		{name: "valid", nonce: "n-1"},
+		{name: "audience array", claims: map[string]interface{}{"aud": []string{"other", "client-1"}}, nonce: "n-1"},
+		{name: "wrong nonce", nonce: "n-2", wantErr: ErrNonce},
+		{name: "other audience", claims: map[string]interface{}{"aud": "other"}, nonce: "n-1", wantErr: ErrInvalidIDToken},
+		{name: "other issuer", claims: map[string]interface{}{"iss": "https://evil.example.com"}, nonce: "n-1", wantErr: ErrInvalidIDToken},
+		{name: "expired", claims: map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, nonce: "n-1", wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.claims = tt.claims
+			claims := mock.idTokenClaims("n-1")
+			_, err := provider.Verify(ctx, mock.sign(claims), tt.nonce)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestJWKSCache(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	ctx := context.Background()
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := provider.Verify(ctx, mock.sign(mock.idTokenClaims("n")), "n")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, mock.jwksFetches)
+
+	// the provider rolls its key: unknown key ids refresh the cache, but at
+	// most once a minute
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	mock.mu.Lock()
+	mock.key, mock.keyId = newKey, "key-2"
+	mock.mu.Unlock()
+
+	_, err = provider.Verify(ctx, mock.sign(mock.idTokenClaims("n")), "n")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Equal(t, 1, mock.jwksFetches)
+
+	now = now.Add(2 * time.Minute)
+	_, err = provider.Verify(ctx, mock.sign(mock.idTokenClaims("n")), "n")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, mock.jwksFetches)
+}
@@ -0,0 +1,135 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+// Relay moves committed events from the outbox table to the registered sinks.
+// Delivery is at-least-once: an event is only marked published once every
+// sink accepted it, and a failure on a sink retries it on that sink only.
+// Events of one aggregate are published strictly in insertion order; a failed
+// event holds back the later events of its aggregate until it succeeds or,
+// after MaxAttempts, is given up on as dead.
+type Relay struct {
+	store       store.OutboxStore
+	sinks       []Sink
+	logger      *log.Logger
+	Interval    time.Duration
+	BatchSize   int
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+func NewRelay(outboxStore store.OutboxStore, logger *log.Logger, sinks ...Sink) *Relay {
+	return &Relay{
+		store:       outboxStore,
+		sinks:       sinks,
+		logger:      logger,
+		Interval:    500 * time.Millisecond,
+		BatchSize:   100,
+		MaxBackoff:  10 * time.Minute,
+		MaxAttempts: 20,
+	}
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		_, err := r.ProcessOnce(ctx)
+		if err != nil {
+			r.logger.Printf("ERROR: outbox relay: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessOnce publishes one batch of pending events and returns how many were
+// published. It does nothing if another relay instance holds the lock.
+func (r *Relay) ProcessOnce(ctx context.Context) (int, error) {
+	unlock, ok, err := r.store.TryLock(ctx)
+	if err != nil || !ok {
+		return 0, err
+	}
+	defer unlock()
+
+	events, err := r.store.GetPendingEvents(r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// the store leaves out aggregates waiting for a retry, this keeps the
+	// events after a failure of this batch in order
+	blocked := map[string]bool{}
+	published := 0
+	for i := range events {
+		event := &events[i]
+		key := event.AggregateKey()
+		if blocked[key] {
+			continue
+		}
+
+		sinks, err := r.publish(ctx, event)
+		if err != nil && event.Attempts+1 >= r.MaxAttempts {
+			r.logger.Printf("ERROR: outbox event %d is dead after %d attempts: %v", event.Id, event.Attempts+1, err)
+			if err := r.store.MarkDead(event.Id, err.Error(), sinks); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err != nil {
+			blocked[key] = true
+			next := time.Now().Add(r.backoff(event.Attempts))
+			if err := r.store.MarkFailed(event.Id, err.Error(), sinks, next); err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		if err := r.store.MarkPublished(event.Id); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// publish hands the event to the sinks that have not accepted it yet and
+// returns every sink that has.
+func (r *Relay) publish(ctx context.Context, event *store.OutboxEvent) ([]string, error) {
+	published := append([]string{}, event.PublishedSinks...)
+	var errs []error
+	for _, sink := range r.sinks {
+		if slices.Contains(event.PublishedSinks, sink.Name()) {
+			continue
+		}
+		if err := sink.Publish(ctx, event.Event()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		published = append(published, sink.Name())
+	}
+	return published, errors.Join(errs...)
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	if attempts > 20 {
+		return r.MaxBackoff
+	}
+	backoff := time.Second << attempts
+	if backoff > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+	return backoff
+}
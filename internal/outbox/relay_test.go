@@ -0,0 +1,233 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryOutboxStore struct {
+	events    []store.OutboxEvent
+	published map[int64]bool
+	dead      map[int64]bool
+}
+
+func (m *memoryOutboxStore) TryLock(ctx context.Context) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+// GetPendingEvents filters like the Postgres store: events waiting for a
+// retry and the later events of their aggregates are left out.
+func (m *memoryOutboxStore) GetPendingEvents(limit int) ([]store.OutboxEvent, error) {
+	now := time.Now()
+	waiting := map[string]bool{}
+	var pending []store.OutboxEvent
+	for _, e := range m.events {
+		if m.published[e.Id] || m.dead[e.Id] || waiting[e.AggregateKey()] {
+			continue
+		}
+		if e.NextAttemptAt.After(now) {
+			waiting[e.AggregateKey()] = true
+			continue
+		}
+		if len(pending) < limit {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (m *memoryOutboxStore) MarkPublished(id int64) error {
+	m.published[id] = true
+	return nil
+}
+
+func (m *memoryOutboxStore) MarkFailed(id int64, reason string, publishedSinks []string, nextAttemptAt time.Time) error {
+	for i := range m.events {
+		if m.events[i].Id == id {
+			m.events[i].Attempts++
+			m.events[i].NextAttemptAt = nextAttemptAt
+			m.events[i].PublishedSinks = publishedSinks
+		}
+	}
+	return nil
+}
+
+func (m *memoryOutboxStore) MarkDead(id int64, reason string, publishedSinks []string) error {
+	m.dead[id] = true
+	return nil
+}
+
+func (m *memoryOutboxStore) GetAggregateEvents(aggregateType string, aggregateId int, afterId int64, limit int) ([]store.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (m *memoryOutboxStore) GetEventsAfter(aggregateType string, cursors map[int]int64, limit int) ([]store.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (m *memoryOutboxStore) GetLatestAggregateEventId(aggregateType string, aggregateId int) (int64, error) {
+	return 0, nil
+}
+
+func TestRelayOrdersPerAggregate(t *testing.T) {
+	ms := &memoryOutboxStore{
+		published: map[int64]bool{},
+		dead:      map[int64]bool{},
+		events: []store.OutboxEvent{
+			{Id: 1, AggregateType: store.AggregateWorkout, AggregateId: 1, EventType: store.EventWorkoutCreated},
+			{Id: 2, AggregateType: store.AggregateWorkout, AggregateId: 2, EventType: store.EventWorkoutCreated},
+			{Id: 3, AggregateType: store.AggregateWorkout, AggregateId: 1, EventType: store.EventWorkoutUpdated},
+			{Id: 4, AggregateType: store.AggregateWorkout, AggregateId: 2, EventType: store.EventWorkoutDeleted},
+		},
+	}
+
+	var received []string
+	failFirst := true
+	subscribers := NewSubscribers("subscribers")
+	subscribers.Subscribe("*", func(ctx context.Context, event store.Event) error {
+		if event.Id == "1" && failFirst {
+			failFirst = false
+			return errors.New("subscriber unavailable")
+		}
+		received = append(received, event.Id)
+		return nil
+	})
+
+	relay := NewRelay(ms, log.New(io.Discard, "", 0), subscribers)
+	relay.MaxBackoff = 0
+
+	published, err := relay.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	// event 3 must wait for event 1 of the same workout
+	assert.Equal(t, []string{"2", "4"}, received)
+
+	published, err = relay.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, published)
+	assert.Equal(t, []string{"2", "4", "1", "3"}, received)
+}
+
+func TestRelaySkipsWaitingAggregates(t *testing.T) {
+	ms := &memoryOutboxStore{published: map[int64]bool{}, dead: map[int64]bool{}}
+	// a full batch of a workout whose first event waits for a retry
+	for i := 1; i <= 5; i++ {
+		ms.events = append(ms.events, store.OutboxEvent{Id: int64(i), AggregateType: store.AggregateWorkout, AggregateId: 1, EventType: store.EventWorkoutSetLogged})
+	}
+	ms.events[0].NextAttemptAt = time.Now().Add(time.Hour)
+	ms.events = append(ms.events, store.OutboxEvent{Id: 6, AggregateType: store.AggregateWorkout, AggregateId: 2, EventType: store.EventWorkoutCreated})
+
+	var received []string
+	subscribers := NewSubscribers("subscribers")
+	subscribers.Subscribe("*", func(ctx context.Context, event store.Event) error {
+		received = append(received, event.Id)
+		return nil
+	})
+	relay := NewRelay(ms, log.New(io.Discard, "", 0), subscribers)
+	relay.BatchSize = 5
+
+	published, err := relay.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []string{"6"}, received)
+}
+
+func TestRelayGivesUpOnDeadEvents(t *testing.T) {
+	ms := &memoryOutboxStore{
+		published: map[int64]bool{},
+		dead:      map[int64]bool{},
+		events: []store.OutboxEvent{
+			{Id: 1, AggregateType: store.AggregateWorkout, AggregateId: 1, EventType: store.EventWorkoutCreated},
+			{Id: 2, AggregateType: store.AggregateWorkout, AggregateId: 1, EventType: store.EventWorkoutUpdated},
+		},
+	}
+
+	var received []string
+	subscribers := NewSubscribers("subscribers")
+	subscribers.Subscribe("*", func(ctx context.Context, event store.Event) error {
+		if event.Id == "1" {
+			return errors.New("malformed event")
+		}
+		received = append(received, event.Id)
+		return nil
+	})
+	relay := NewRelay(ms, log.New(io.Discard, "", 0), subscribers)
+	relay.MaxBackoff = 0
+	relay.MaxAttempts = 3
+
+	for i := 0; i < 2; i++ {
+		_, err := relay.ProcessOnce(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, received)
+	}
+	// the third attempt gives up on event 1, event 2 no longer waits for it
+	published, err := relay.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.True(t, ms.dead[1])
+	assert.Equal(t, []string{"2"}, received)
+}
+
+func TestRelayRetriesFailedSinksOnly(t *testing.T) {
+	ms := &memoryOutboxStore{
+		published: map[int64]bool{},
+		dead:      map[int64]bool{},
+		events: []store.OutboxEvent{
+			{Id: 1, AggregateType: store.AggregateWorkout, AggregateId: 1, EventType: store.EventWorkoutCreated},
+		},
+	}
+
+	healthyCalls := 0
+	healthy := NewSubscribers("healthy")
+	healthy.Subscribe("*", func(ctx context.Context, event store.Event) error {
+		healthyCalls++
+		return nil
+	})
+	flakyCalls := 0
+	flaky := NewSubscribers("flaky")
+	flaky.Subscribe("*", func(ctx context.Context, event store.Event) error {
+		flakyCalls++
+		if flakyCalls == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	relay := NewRelay(ms, log.New(io.Discard, "", 0), healthy, flaky)
+	relay.MaxBackoff = 0
+
+	published, err := relay.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	assert.Equal(t, []string{"healthy"}, ms.events[0].PublishedSinks)
+
+	published, err = relay.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, 1, healthyCalls)
+	assert.Equal(t, 2, flakyCalls)
+}
+
+type fakeNATS struct {
+	subjects []string
+}
+
+func (f *fakeNATS) Publish(subject string, data []byte) error {
+	f.subjects = append(f.subjects, subject)
+	return nil
+}
+
+func TestNATSSinkSubject(t *testing.T) {
+	conn := &fakeNATS{}
+	sink := NewNATSSink(conn, "events")
+	err := sink.Publish(context.Background(), store.Event{Type: store.EventWorkoutCreated})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"events.workout.created"}, conn.subjects)
+}
@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+// Sink is a destination the relay publishes outbox events to. Publish must
+// only return nil once the sink has durably accepted the event.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event store.Event) error
+}
+
+type Handler func(ctx context.Context, event store.Event) error
+
+// Subscribers is an in-process sink dispatching events to handlers registered
+// per event type. Handlers registered for "*" receive every event. A failed
+// handler retries the event on all handlers of the sink, so independent
+// consumers each get their own Subscribers.
+type Subscribers struct {
+	name     string
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewSubscribers(name string) *Subscribers {
+	return &Subscribers{name: name, handlers: map[string][]Handler{}}
+}
+
+func (s *Subscribers) Subscribe(eventType string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[eventType] = append(s.handlers[eventType], handler)
+}
+
+func (s *Subscribers) Name() string {
+	return s.name
+}
+
+func (s *Subscribers) Publish(ctx context.Context, event store.Event) error {
+	s.mu.RLock()
+	handlers := append([]Handler{}, s.handlers[event.Type]...)
+	handlers = append(handlers, s.handlers["*"]...)
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NATSPublisher is the subset of *nats.Conn the NATS sink needs, so any
+// NATS-compatible client can be plugged in without this package importing it.
+type NATSPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSSink publishes each event as JSON on "<prefix>.<event type>",
+// e.g. "events.workout.created".
+type NATSSink struct {
+	conn   NATSPublisher
+	prefix string
+}
+
+func NewNATSSink(conn NATSPublisher, prefix string) *NATSSink {
+	return &NATSSink{conn: conn, prefix: prefix}
+}
+
+func (n *NATSSink) Name() string {
+	return "nats"
+}
+
+func (n *NATSSink) Publish(ctx context.Context, event store.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return n.conn.Publish(n.prefix+"."+event.Type, data)
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import "time"
+
+// Lockout locks a key, like the username of a login, after repeated
+// failures. Each failure past the free ones doubles the lock, up to Max.
+type Lockout struct {
+	Store Store
+	// Free is the number of failures that do not lock
+	Free int
+	Base time.Duration
+	Max  time.Duration
+	// Forget is how long failures are remembered after the last one
+	Forget time.Duration
+	now    func() time.Time
+}
+
+func NewLockout(store Store) *Lockout {
+	return &Lockout{
+		Store:  store,
+		Free:   5,
+		Base:   time.Minute,
+		Max:    time.Hour,
+		Forget: 24 * time.Hour,
+		now:    time.Now,
+	}
+}
+
+// Delay is how long a key is locked after its last failure.
+func (l *Lockout) Delay(failures int) time.Duration {
+	if failures <= l.Free {
+		return 0
+	}
+	delay := l.Base
+	for i := l.Free + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= l.Max {
+			return l.Max
+		}
+	}
+	return delay
+}
+
+// Check returns how long the key is still locked, zero if it is not.
+func (l *Lockout) Check(key string) (time.Duration, error) {
+	failures, last, err := l.Store.GetFailures(key)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(failures, last), nil
+}
+
+// Fail records a failure and returns the lock it results in.
+func (l *Lockout) Fail(key string) (time.Duration, error) {
+	failures, last, err := l.Store.AddFailure(key, l.Forget)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(failures, last), nil
+}
+
+func (l *Lockout) Succeed(key string) error {
+	return l.Store.ResetFailures(key)
+}
+
+func (l *Lockout) remaining(failures int, last time.Time) time.Duration {
+	remaining := last.Add(l.Delay(failures)).Sub(l.now())
+	if remaining <= 0 {
+		return 0
+	}
+	// whole seconds, rounded up, for Retry-After
+	return (remaining + time.Second - 1).Truncate(time.Second)
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many calls pass between removing stale entries.
+const sweepEvery = 1000
+
+type memoryFailures struct {
+	count   int
+	last    time.Time
+	expires time.Time
+}
+
+type memoryBucket struct {
+	bucket  Bucket
+	expires time.Time
+}
+
+// MemoryStore keeps limits in process. Every instance of the API counts on
+// its own with it.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]memoryBucket
+	failures map[string]memoryFailures
+	calls    int
+	now      func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  map[string]memoryBucket{},
+		failures: map[string]memoryFailures{},
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	bucket, result := limit.Take(m.buckets[key].bucket, now)
+	// once refilled the bucket is the same as none at all and can be swept
+	m.buckets[key] = memoryBucket{bucket: bucket, expires: now.Add(result.Reset)}
+	return result, nil
+}
+
+func (m *MemoryStore) AddFailure(key string, ttl time.Duration) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	f, ok := m.failures[key]
+	if !ok || !now.Before(f.expires) {
+		f = memoryFailures{}
+	}
+	f.count++
+	f.last = now
+	f.expires = now.Add(ttl)
+	m.failures[key] = f
+	return f.count, f.last, nil
+}
+
+func (m *MemoryStore) GetFailures(key string) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.failures[key]
+	if !ok || !m.now().Before(f.expires) {
+		return 0, time.Time{}, nil
+	}
+	return f.count, f.last, nil
+}
+
+func (m *MemoryStore) ResetFailures(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failures, key)
+	return nil
+}
+
+// sweep drops expired entries now and then so that keys of clients that went
+// away do not pile up. Callers hold mu.
+func (m *MemoryStore) sweep(now time.Time) {
+	m.calls++
+	if m.calls%sweepEvery != 0 {
+		return
+	}
+	for key, b := range m.buckets {
+		if !now.Before(b.expires) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, f := range m.failures {
+		if !now.Before(f.expires) {
+			delete(m.failures, key)
+		}
+	}
+}
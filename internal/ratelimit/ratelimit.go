@@ -0,0 +1,100 @@
+// Package ratelimit implements token bucket rate limits and the progressive
+// lockout of failed logins. Buckets live in a Store: MemoryStore for a single
+// instance, a database backed one when several instances share the limits.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Period. Unused requests accumulate up
+// to Requests, so a client may spend a whole period's worth at once.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// ParseLimit reads limits written like 5/1h or 100/1m.
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q: want requests/period", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q: requests must be a positive number", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid period", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// rate is the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Bucket is the state stores keep per key. A zero Bucket is full.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Result describes a request against a limit, for the RateLimit headers.
+type Result struct {
+	Allowed   bool
+	Limit     Limit
+	Remaining int
+	// Reset is when the bucket is full again
+	Reset time.Duration
+	// RetryAfter is when the next request is allowed, zero if it is now
+	RetryAfter time.Duration
+}
+
+// Take refills the bucket for the time passed since its last update and
+// takes a token if there is one.
+func (l Limit) Take(b Bucket, now time.Time) (Bucket, Result) {
+	tokens := float64(l.Requests)
+	if !b.Updated.IsZero() {
+		elapsed := now.Sub(b.Updated).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(tokens, b.Tokens+elapsed*l.rate())
+	}
+
+	result := Result{Limit: l}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / l.rate())
+	}
+	result.Remaining = int(tokens)
+	result.Reset = seconds((float64(l.Requests) - tokens) / l.rate())
+	return Bucket{Tokens: tokens, Updated: now}, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+// Store keeps buckets and failed login counts by key.
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+	// AddFailure counts a failure and returns the count. Counts expire ttl
+	// after the last failure.
+	AddFailure(key string, ttl time.Duration) (int, time.Time, error)
+	GetFailures(key string) (int, time.Time, error)
+	ResetFailures(key string) error
+}
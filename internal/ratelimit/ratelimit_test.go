@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"5/1h", Limit{Requests: 5, Period: time.Hour}, false},
+		{" 100/1m ", Limit{Requests: 100, Period: time.Minute}, false},
+		{"5", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"x/1m", Limit{}, true},
+		{"5/soon", Limit{}, true},
+		{"5/-1m", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLimitTake(t *testing.T) {
+	limit := Limit{Requests: 3, Period: time.Minute}
+	now := time.Unix(1700000000, 0)
+
+	var bucket Bucket
+	var result Result
+	for i := 2; i >= 0; i-- {
+		bucket, result = limit.Take(bucket, now)
+		require.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	assert.Equal(t, time.Minute, result.Reset)
+
+	bucket, result = limit.Take(bucket, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+
+	// a token comes back every 20 seconds
+	bucket, result = limit.Take(bucket, now.Add(20*time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// and the bucket never holds more than Requests
+	_, result = limit.Take(bucket, now.Add(time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	store := NewMemoryStore()
+	store.now = c.now
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Take("signup:10.0.0.1", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, err := store.Take("signup:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// other keys have their own bucket
+	result, err = store.Take("signup:10.0.0.2", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// refilled buckets are swept
+	c.t = c.t.Add(time.Hour)
+	for i := 0; i < sweepEvery; i++ {
+		_, err = store.Take(fmt.Sprint("other:", i%2), limit)
+		require.NoError(t, err)
+	}
+	assert.NotContains(t, store.buckets, "signup:10.0.0.1")
+}
+
+func TestLockoutDelay(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore())
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{5, 0},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{8, 4 * time.Minute},
+		{11, 32 * time.Minute},
+		{12, time.Hour},
+		{40, time.Hour},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, lockout.Delay(tt.failures), "failures=%d", tt.failures)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	store := NewMemoryStore()
+	store.now = c.now
+	lockout := NewLockout(store)
+	lockout.now = c.now
+
+	for i := 0; i < lockout.Free; i++ {
+		locked, err := lockout.Fail("login:jane")
+		require.NoError(t, err)
+		assert.Zero(t, locked)
+	}
+	locked, err := lockout.Fail("login:jane")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, locked)
+
+	c.t = c.t.Add(30 * time.Second)
+	locked, err = lockout.Check("login:jane")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, locked)
+
+	c.t = c.t.Add(30 * time.Second)
+	locked, err = lockout.Check("login:jane")
+	require.NoError(t, err)
+	assert.Zero(t, locked)
+
+	// the next failure locks for twice as long
+	locked, err = lockout.Fail("login:jane")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, locked)
+
+	require.NoError(t, lockout.Succeed("login:jane"))
+	locked, err = lockout.Check("login:jane")
+	require.NoError(t, err)
+	assert.Zero(t, locked)
+
+	// failures are forgotten a while after the last one
+	for i := 0; i <= lockout.Free; i++ {
+		_, err = lockout.Fail("login:john")
+		require.NoError(t, err)
+	}
+	c.t = c.t.Add(lockout.Forget)
+	locked, err = lockout.Fail("login:john")
+	require.NoError(t, err)
+	assert.Zero(t, locked)
+}
@@ -0,0 +1,144 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+type Message struct {
+	Id   int64           `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Subscription receives the messages of one workout on C. C is closed when
+// the subscription is cancelled or the subscriber fell too far behind; a
+// client that was dropped is expected to reconnect with its last event id.
+type Subscription struct {
+	C         <-chan Message
+	ch        chan Message
+	workoutId int
+	hub       *Hub
+}
+
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub fans workout events out to any number of subscribers per workout.
+// Publishing never blocks on a subscriber.
+type Hub struct {
+	mu         sync.Mutex
+	topics     map[int]*topic
+	bufferSize int
+}
+
+type topic struct {
+	subs map[*Subscription]struct{}
+	// lastId is the id of the latest event broadcast to the workout
+	lastId int64
+}
+
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		topics:     map[int]*topic{},
+		bufferSize: bufferSize,
+	}
+}
+
+// Subscribe starts receiving the events of a workout. afterId is where the
+// workout's events start if nobody else is watching it yet; whatever the
+// subscriber missed before that it has to read from the outbox itself.
+func (h *Hub) Subscribe(workoutId int, afterId int64) *Subscription {
+	ch := make(chan Message, h.bufferSize)
+	sub := &Subscription{C: ch, ch: ch, workoutId: workoutId, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[workoutId]
+	if !ok {
+		t = &topic{subs: map[*Subscription]struct{}{}, lastId: afterId}
+		h.topics[workoutId] = t
+	}
+	t.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) Broadcast(workoutId int, msg Message) {
+	var slow []*Subscription
+
+	h.mu.Lock()
+	if t, ok := h.topics[workoutId]; ok {
+		t.lastId = max(t.lastId, msg.Id)
+		for sub := range t.subs {
+			select {
+			case sub.ch <- msg:
+			default:
+				slow = append(slow, sub)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sub := range slow {
+		h.remove(sub)
+	}
+}
+
+// SubscriberCount returns the number of live subscribers of a workout.
+func (h *Hub) SubscriberCount(workoutId int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if t, ok := h.topics[workoutId]; ok {
+		return len(t.subs)
+	}
+	return 0
+}
+
+// Cursors returns the id of the latest event broadcast to each workout that
+// has subscribers.
+func (h *Hub) Cursors() map[int]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cursors := make(map[int]int64, len(h.topics))
+	for workoutId, t := range h.topics {
+		cursors[workoutId] = t.lastId
+	}
+	return cursors
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[sub.workoutId]
+	if !ok {
+		return
+	}
+	if _, ok := t.subs[sub]; !ok {
+		return
+	}
+	delete(t.subs, sub)
+	close(sub.ch)
+	if len(t.subs) == 0 {
+		delete(h.topics, sub.workoutId)
+	}
+}
+
+func NewMessage(event store.Event) (Message, error) {
+	id, err := strconv.ParseInt(event.Id, 10, 64)
+	if err != nil {
+		return Message{}, err
+	}
+
+	data, ok := event.Data.(json.RawMessage)
+	if !ok {
+		data, err = json.Marshal(event.Data)
+		if err != nil {
+			return Message{}, err
+		}
+	}
+	return Message{Id: id, Type: event.Type, Data: data}, nil
+}
@@ -0,0 +1,55 @@
+package realtime
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubBroadcast(t *testing.T) {
+	hub := NewHub(2)
+	a := hub.Subscribe(1, 0)
+	b := hub.Subscribe(1, 0)
+	other := hub.Subscribe(2, 0)
+	defer a.Close()
+	defer other.Close()
+
+	msg, err := NewMessage(store.Event{
+		Id:            "10",
+		Type:          store.EventWorkoutEntryCreated,
+		AggregateType: store.AggregateWorkout,
+		AggregateId:   1,
+		Data:          json.RawMessage(`{"id":3}`),
+	})
+	require.NoError(t, err)
+	hub.Broadcast(1, msg)
+
+	msg = <-a.C
+	assert.Equal(t, int64(10), msg.Id)
+	assert.JSONEq(t, `{"id":3}`, string(msg.Data))
+	assert.Equal(t, int64(10), (<-b.C).Id)
+	assert.Len(t, other.C, 0)
+
+	b.Close()
+	_, open := <-b.C
+	assert.False(t, open)
+	assert.Equal(t, 1, hub.SubscriberCount(1))
+	assert.Equal(t, map[int]int64{1: 10, 2: 0}, hub.Cursors())
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub(1)
+	sub := hub.Subscribe(1, 0)
+
+	hub.Broadcast(1, Message{Id: 1})
+	hub.Broadcast(1, Message{Id: 2})
+
+	assert.Equal(t, int64(1), (<-sub.C).Id)
+	_, open := <-sub.C
+	assert.False(t, open)
+	assert.Equal(t, 0, hub.SubscriberCount(1))
+	sub.Close()
+}
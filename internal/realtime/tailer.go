@@ -0,0 +1,74 @@
+package realtime
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+// Tailer feeds the hub of this instance from the outbox. Only the instance
+// holding the relay lock publishes events, so rather than being handed events
+// by the relay every instance follows the published events of the workouts
+// its own clients are watching.
+type Tailer struct {
+	hub       *Hub
+	store     store.OutboxStore
+	logger    *log.Logger
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewTailer(hub *Hub, outboxStore store.OutboxStore, logger *log.Logger) *Tailer {
+	return &Tailer{
+		hub:       hub,
+		store:     outboxStore,
+		logger:    logger,
+		Interval:  500 * time.Millisecond,
+		BatchSize: 100,
+	}
+}
+
+func (t *Tailer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		_, err := t.PollOnce()
+		if err != nil {
+			t.logger.Printf("ERROR: realtime tailer: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollOnce broadcasts the events published since the last poll for every
+// watched workout and returns how many there were. Events of one workout are
+// published in id order, so a cursor per workout is enough to see each once.
+func (t *Tailer) PollOnce() (int, error) {
+	cursors := t.hub.Cursors()
+	broadcast := 0
+	for len(cursors) > 0 {
+		events, err := t.store.GetEventsAfter(store.AggregateWorkout, cursors, t.BatchSize)
+		if err != nil {
+			return broadcast, err
+		}
+		for i := range events {
+			msg, err := NewMessage(events[i].Event())
+			if err != nil {
+				return broadcast, err
+			}
+			t.hub.Broadcast(events[i].AggregateId, msg)
+			cursors[events[i].AggregateId] = msg.Id
+			broadcast++
+		}
+		if len(events) < t.BatchSize {
+			break
+		}
+	}
+	return broadcast, nil
+}
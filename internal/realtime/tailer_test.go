@@ -0,0 +1,83 @@
+package realtime
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOutboxStore holds published events only.
+type memoryOutboxStore struct {
+	store.OutboxStore
+	events []store.OutboxEvent
+}
+
+func (m *memoryOutboxStore) GetEventsAfter(aggregateType string, cursors map[int]int64, limit int) ([]store.OutboxEvent, error) {
+	var events []store.OutboxEvent
+	for _, e := range m.events {
+		afterId, ok := cursors[e.AggregateId]
+		if e.AggregateType != aggregateType || !ok || e.Id <= afterId {
+			continue
+		}
+		if len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryOutboxStore) publish(workoutId int) {
+	m.events = append(m.events, store.OutboxEvent{
+		Id:            int64(len(m.events) + 1),
+		AggregateType: store.AggregateWorkout,
+		AggregateId:   workoutId,
+		EventType:     store.EventWorkoutUpdated,
+		Payload:       json.RawMessage(`{}`),
+	})
+}
+
+func TestTailerFeedsEveryInstance(t *testing.T) {
+	ms := &memoryOutboxStore{}
+	ms.publish(1)
+
+	// two instances watching the same workout, neither runs the relay
+	hubs := []*Hub{NewHub(16), NewHub(16)}
+	var subs []*Subscription
+	var tailers []*Tailer
+	for _, hub := range hubs {
+		sub := hub.Subscribe(1, 1)
+		defer sub.Close()
+		subs = append(subs, sub)
+		tailer := NewTailer(hub, ms, log.New(io.Discard, "", 0))
+		tailer.BatchSize = 2
+		tailers = append(tailers, tailer)
+	}
+
+	ms.publish(2)
+	ms.publish(1)
+	ms.publish(1)
+	ms.publish(1)
+
+	for i, tailer := range tailers {
+		n, err := tailer.PollOnce()
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+
+		var ids []int64
+		for len(subs[i].C) > 0 {
+			ids = append(ids, (<-subs[i].C).Id)
+		}
+		assert.Equal(t, []int64{3, 4, 5}, ids)
+	}
+
+	// nothing new, nothing is sent twice
+	n, err := tailers[0].PollOnce()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Len(t, subs[0].C, 0)
+}
@@ -0,0 +1,71 @@
+// Package retention removes data that is kept only for a limited time.
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PurgeFunc removes up to limit records deleted before deletedBefore for
+// good and returns how many it removed, e.g. store.UserStore's
+// PurgeDeletedUsers.
+type PurgeFunc func(deletedBefore time.Time, limit int) (int, error)
+
+// Purger removes deleted records for good once their grace period is over.
+// Several instances may run one; each record is purged by one of them.
+type Purger struct {
+	// name is what is purged, for the logs
+	name      string
+	purge     PurgeFunc
+	logger    *log.Logger
+	Grace     time.Duration
+	Interval  time.Duration
+	BatchSize int
+	now       func() time.Time
+}
+
+func NewPurger(name string, purge PurgeFunc, grace time.Duration, logger *log.Logger) *Purger {
+	return &Purger{
+		name:      name,
+		purge:     purge,
+		logger:    logger,
+		Grace:     grace,
+		Interval:  time.Hour,
+		BatchSize: 100,
+		now:       time.Now,
+	}
+}
+
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		purged, err := p.PurgeOnce()
+		if err != nil {
+			p.logger.Printf("ERROR: purging deleted %s: %v", p.name, err)
+		}
+		if purged > 0 {
+			p.logger.Printf("purged %d deleted %s", purged, p.name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce purges every record whose grace period is over, a batch at a
+// time, and returns how many it purged.
+func (p *Purger) PurgeOnce() (int, error) {
+	deletedBefore := p.now().Add(-p.Grace)
+	total := 0
+	for {
+		purged, err := p.purge(deletedBefore, p.BatchSize)
+		total += purged
+		if err != nil || purged < p.BatchSize {
+			return total, err
+		}
+	}
+}
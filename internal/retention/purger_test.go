@@ -0,0 +1,71 @@
+package retention
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	deletedAt []time.Time
+	calls     int
+	err       error
+}
+
+func (m *memoryStore) PurgeDeleted(deletedBefore time.Time, limit int) (int, error) {
+	m.calls++
+	if m.err != nil {
+		return 0, m.err
+	}
+	purged := 0
+	kept := m.deletedAt[:0]
+	for _, at := range m.deletedAt {
+		if purged < limit && at.Before(deletedBefore) {
+			purged++
+			continue
+		}
+		kept = append(kept, at)
+	}
+	m.deletedAt = kept
+	return purged, nil
+}
+
+func TestPurgeOnce(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	store := &memoryStore{deletedAt: []time.Time{
+		now.Add(-40 * 24 * time.Hour),
+		now.Add(-31 * 24 * time.Hour),
+		now.Add(-30*24*time.Hour - time.Minute),
+		// still within the grace period
+		now.Add(-29 * 24 * time.Hour),
+		now.Add(-time.Hour),
+	}}
+	purger := NewPurger("accounts", store.PurgeDeleted, 30*24*time.Hour, log.New(io.Discard, "", 0))
+	purger.now = func() time.Time { return now }
+	purger.BatchSize = 2
+
+	purged, err := purger.PurgeOnce()
+	require.NoError(t, err)
+	assert.Equal(t, 3, purged)
+	assert.Len(t, store.deletedAt, 2)
+	// a full batch, then one with the rest
+	assert.Equal(t, 2, store.calls)
+
+	purged, err = purger.PurgeOnce()
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+}
+
+func TestPurgeOnceError(t *testing.T) {
+	store := &memoryStore{err: errors.New("connection refused")}
+	purger := NewPurger("workouts", store.PurgeDeleted, time.Hour, log.New(io.Discard, "", 0))
+
+	_, err := purger.PurgeOnce()
+	assert.Error(t, err)
+	assert.Equal(t, 1, store.calls)
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/Naveenravi07/go-api/internal/apikeys"
 	"github.com/Naveenravi07/go-api/internal/app"
 	"github.com/go-chi/chi/v5"
 )
@@ -8,15 +9,109 @@ import (
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
 
+	r.Group(func(r chi.Router) {
+		r.Use(app.Middleware.Authenticate)
+		r.Use(app.RateLimiter.LimitAll("api", app.RateLimiter.ByIdentity))
+
+		r.Get("/workouts/{id}", app.Middleware.AllowScope(apikeys.WorkoutsRead, app.WorkoutHandler.HandleWorkoutById))
+		r.Get("/workouts/{id}/stream", app.Middleware.AllowScope(apikeys.WorkoutsRead, app.StreamHandler.HandleWorkoutStream))
+		r.Get("/workouts/{id}/ws", app.Middleware.AllowScope(apikeys.WorkoutsRead, app.StreamHandler.HandleWorkoutSocket))
+		r.Post("/workouts", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.HandleCreateWorkout))
+		r.Patch("/workouts", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.HandleUpdateWorkout))
+		r.Delete("/workouts/{id}", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.DeleteWorkoutHandler))
+		r.Get("/workouts/trash", app.Middleware.RequireScope(apikeys.WorkoutsRead, app.WorkoutHandler.HandleListTrash))
+		r.Post("/workouts/{id}/restore", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.HandleRestoreWorkout))
+		r.Get("/workouts/{id}/track", app.Middleware.RequireScope(apikeys.WorkoutsRead, app.WorkoutHandler.HandleWorkoutTrack))
+		r.Post("/workouts/import/gpx", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.HandleImportGPX))
+		r.Post("/workouts/import/tcx", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.HandleImportTCX))
+		r.Post("/workouts/import/fit", app.Middleware.RequireScope(apikeys.WorkoutsWrite, app.WorkoutHandler.HandleImportFIT))
+
+		r.Get("/workouts/{id}/comments", app.Middleware.AllowScope(apikeys.WorkoutsRead, app.CommentHandler.HandleListComments))
+		r.Post("/workouts/{id}/comments", app.Middleware.RequireUser(app.CommentHandler.HandleCreateComment))
+		r.Patch("/comments/{id}", app.Middleware.RequireUser(app.CommentHandler.HandleUpdateComment))
+		r.Delete("/comments/{id}", app.Middleware.RequireUser(app.CommentHandler.HandleDeleteComment))
+		r.Post("/comments/{id}/approve", app.Middleware.RequireUser(app.CommentHandler.HandleApproveComment))
+		r.Put("/workouts/{id}/reactions/{kind}", app.Middleware.RequireUser(app.CommentHandler.HandleAddReaction))
+		r.Delete("/workouts/{id}/reactions/{kind}", app.Middleware.RequireUser(app.CommentHandler.HandleRemoveReaction))
+
+		r.Post("/sessions", app.Middleware.RequireUser(app.SessionHandler.HandleStartSession))
+		r.Get("/sessions/{id}", app.Middleware.RequireUser(app.SessionHandler.HandleGetSession))
+		r.Post("/sessions/{id}/sets", app.Middleware.RequireUser(app.SessionHandler.HandleLogSet))
+		r.Post("/sessions/{id}/finish", app.Middleware.RequireUser(app.SessionHandler.HandleFinishSession))
+
+		r.Get("/me/measurements", app.Middleware.RequireUser(app.MeasurementHandler.HandleListMeasurements))
+		r.Post("/me/measurements", app.Middleware.RequireUser(app.MeasurementHandler.HandleCreateMeasurement))
+		r.Get("/me/measurements/moving-average", app.Middleware.RequireUser(app.MeasurementHandler.HandleMovingAverage))
+		r.Get("/me/measurements/trend", app.Middleware.RequireUser(app.MeasurementHandler.HandleTrend))
+		r.Get("/me/measurements/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleGetMeasurement))
+		r.Patch("/me/measurements/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleUpdateMeasurement))
+		r.Delete("/me/measurements/{id}", app.Middleware.RequireUser(app.MeasurementHandler.HandleDeleteMeasurement))
+
+		r.Get("/me/goals", app.Middleware.RequireUser(app.GoalHandler.HandleListGoals))
+		r.Post("/me/goals", app.Middleware.RequireUser(app.GoalHandler.HandleCreateGoal))
+		r.Get("/me/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleGetGoal))
+		r.Patch("/me/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleUpdateGoal))
+		r.Delete("/me/goals/{id}", app.Middleware.RequireUser(app.GoalHandler.HandleDeleteGoal))
+
+		r.Get("/me/achievements", app.Middleware.RequireUser(app.AchievementHandler.HandleListAchievements))
+
+		r.Get("/feed", app.Middleware.RequireUser(app.SocialHandler.HandleFeed))
+		r.Patch("/user", app.Middleware.RequireUser(app.UserHandler.UpdateUserHandler))
+		r.Delete("/user", app.Middleware.RequireUser(app.UserHandler.HandleDeleteAccount))
+		r.Get("/me/identities", app.Middleware.RequireUser(app.OIDCHandler.HandleListIdentities))
+		r.Post("/me/two-factor", app.Middleware.RequireUser(app.TwoFactorHandler.HandleEnroll))
+		r.Post("/me/two-factor/confirm", app.Middleware.RequireUser(app.TwoFactorHandler.HandleConfirm))
+		r.Post("/me/two-factor/recovery-codes", app.Middleware.RequireUser(app.TwoFactorHandler.HandleRegenerateRecoveryCodes))
+		r.Delete("/me/two-factor", app.Middleware.RequireUser(app.TwoFactorHandler.HandleDisable))
+		r.Get("/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleListAPIKeys))
+		r.Post("/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Delete("/me/api-keys/{id}", app.Middleware.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+		r.Get("/auth/oidc/{provider}/login", app.OIDCHandler.HandleLogin)
+		r.Post("/tokens/verification", app.RateLimiter.Limit("email", app.RateLimiter.ByIdentity,
+			app.Middleware.RequireUser(app.TokenHandler.HandleCreateVerificationToken)))
+		r.Get("/user/{username}", app.Middleware.AllowScope(apikeys.ProfileRead, app.UserHandler.GetUserByUsernameHandler))
+		r.Get("/user/{username}/followers", app.Middleware.AllowScope(apikeys.ProfileRead, app.SocialHandler.HandleFollowers))
+		r.Get("/user/{username}/following", app.Middleware.AllowScope(apikeys.ProfileRead, app.SocialHandler.HandleFollowing))
+		r.Post("/user/{username}/follow", app.Middleware.RequireUser(app.SocialHandler.HandleFollow))
+		r.Delete("/user/{username}/follow", app.Middleware.RequireUser(app.SocialHandler.HandleUnfollow))
+		r.Get("/me/follow-requests", app.Middleware.RequireUser(app.SocialHandler.HandleFollowRequests))
+		r.Post("/me/follow-requests/{username}", app.Middleware.RequireUser(app.SocialHandler.HandleApproveFollow))
+		r.Delete("/me/follow-requests/{username}", app.Middleware.RequireUser(app.SocialHandler.HandleRejectFollow))
+
+		r.Get("/organizations", app.Middleware.RequireUser(app.OrganizationHandler.HandleListOrganizations))
+		r.Post("/organizations", app.Middleware.RequireUser(app.OrganizationHandler.HandleCreateOrganization))
+		r.Get("/organizations/{id}/members", app.Middleware.RequireUser(app.OrganizationHandler.HandleListMembers))
+		r.Delete("/organizations/{id}/members/{userId}", app.Middleware.RequireUser(app.OrganizationHandler.HandleRemoveMember))
+		r.Post("/organizations/{id}/invitations", app.Middleware.RequireUser(app.OrganizationHandler.HandleCreateInvitation))
+		r.Post("/invitations/accept", app.Middleware.RequireUser(app.OrganizationHandler.HandleAcceptInvitation))
+		r.Get("/organizations/{id}/athletes", app.Middleware.RequireUser(app.OrganizationHandler.HandleListAthletes))
+		r.Get("/organizations/{id}/athletes/{userId}/workouts", app.Middleware.RequireUser(app.OrganizationHandler.HandleAthleteWorkouts))
+
+		r.Get("/challenges", app.Middleware.RequireUser(app.ChallengeHandler.HandleListChallenges))
+		r.Post("/challenges", app.Middleware.RequireUser(app.ChallengeHandler.HandleCreateChallenge))
+		r.Get("/challenges/{id}", app.Middleware.RequireUser(app.ChallengeHandler.HandleGetChallenge))
+		r.Get("/challenges/{id}/leaderboard", app.Middleware.RequireUser(app.ChallengeHandler.HandleLeaderboard))
+		r.Post("/challenges/{id}/join", app.Middleware.RequireUser(app.ChallengeHandler.HandleJoinChallenge))
+		r.Delete("/challenges/{id}/join", app.Middleware.RequireUser(app.ChallengeHandler.HandleLeaveChallenge))
+
+		r.Get("/webhooks", app.Middleware.RequireUser(app.WebhookHandler.HandleListWebhooks))
+		r.Post("/webhooks", app.Middleware.RequireUser(app.WebhookHandler.HandleCreateWebhook))
+		r.Delete("/webhooks/{id}", app.Middleware.RequireUser(app.WebhookHandler.HandleDeleteWebhook))
+		r.Get("/webhooks/{id}/deliveries", app.Middleware.RequireUser(app.WebhookHandler.HandleListDeliveries))
+	})
+
 	r.Get("/health", app.HealthCheck)
-	r.Get("/workouts/{id}", app.WorkoutHandler.HandleWorkoutById)
-	r.Post("/workouts", app.WorkoutHandler.HandleCreateWorkout)
-	r.Patch("/workouts", app.WorkoutHandler.HandleUpdateWorkout)
-	r.Delete("/workouts/{id}", app.WorkoutHandler.DeleteWorkoutHandler)
-
-	r.Post("/user", app.UserHandler.CreateUserHandler)
-	r.Patch("/user", app.UserHandler.UpdateUserHandler)
-	r.Get("/user/{username}", app.UserHandler.GetUserByUsernameHandler)
+	r.Post("/user", app.RateLimiter.Limit("signup", app.RateLimiter.ByIP, app.UserHandler.CreateUserHandler))
+	r.Post("/tokens/authentication", app.RateLimiter.Limit("login", app.RateLimiter.ByIP, app.TokenHandler.HandleCreateToken))
+	r.Get("/auth/oidc/{provider}/callback", app.OIDCHandler.HandleCallback)
+	r.Post("/tokens/jwt", app.RateLimiter.Limit("login", app.RateLimiter.ByIP, app.TokenHandler.HandleCreateJWT))
+	r.Post("/tokens/refresh", app.RateLimiter.Limit("refresh", app.RateLimiter.ByIP, app.TokenHandler.HandleRefreshJWT))
+	r.Post("/tokens/revoke", app.TokenHandler.HandleRevokeJWT)
+	r.Post("/tokens/two-factor", app.RateLimiter.Limit("login", app.RateLimiter.ByIP, app.TokenHandler.HandleCompleteTwoFactor))
+	r.Post("/tokens/password-reset", app.RateLimiter.Limit("email", app.RateLimiter.ByIP, app.TokenHandler.HandleCreatePasswordResetToken))
+	r.Put("/user/verified", app.UserHandler.HandleVerifyEmail)
+	r.Put("/user/password", app.UserHandler.HandleResetPassword)
+	r.Post("/user/restore", app.RateLimiter.Limit("login", app.RateLimiter.ByIP, app.TokenHandler.HandleRestoreAccount))
 
 	return r
 }
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestUser(t *testing.T, userStore *PostgresUserStore, username string) *User {
+	user := &User{Username: username, Email: username + "@example.com"}
+	require.NoError(t, user.PasswordHash.Set("correct horse battery"))
+	user, err := userStore.CreateUser(user)
+	require.NoError(t, err)
+	return user
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	suffix := time.Now().UnixNano()
+	userStore := NewPostgresUserStore(db)
+	workoutStore := NewPostgresWorkoutStore(db)
+	socialStore := NewPostgresSocialStore(db)
+	commentStore := NewPostgresCommentStore(db)
+	organizationStore := NewPostgresOrganizationStore(db)
+
+	user := createTestUser(t, userStore, fmt.Sprintf("purged_%d", suffix))
+	friend := createTestUser(t, userStore, fmt.Sprintf("friend_%d", suffix))
+
+	workout, err := workoutStore.CreateWorkout(&Workout{
+		UserId:          user.Id,
+		Title:           "Leg day",
+		DurationMinutes: 45,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 5, Reps: IntPtr(5), Weight: FloatPtr(100), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+	friendWorkout, err := workoutStore.CreateWorkout(&Workout{
+		UserId:          friend.Id,
+		Title:           "Run",
+		DurationMinutes: 30,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Run", Sets: 1, DurationSeconds: IntPtr(1800), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = socialStore.Follow(user.Id, friend.Id)
+	require.NoError(t, err)
+	_, err = socialStore.Follow(friend.Id, user.Id)
+	require.NoError(t, err)
+	_, err = commentStore.CreateComment(&Comment{WorkoutId: friendWorkout.Id, UserId: user.Id, Body: "Nice run"})
+	require.NoError(t, err)
+
+	org, err := organizationStore.CreateOrganization(&Organization{Name: fmt.Sprintf("Club %d", suffix)}, user.Id)
+	require.NoError(t, err)
+	_, err = organizationStore.CreateInvitation(&Invitation{
+		OrganizationId: org.Id, Email: friend.Email, Role: RoleAthlete, InvitedBy: user.Id,
+	}, time.Hour)
+	require.NoError(t, err)
+	// an invitation addressed to the purged user in the friend's organization
+	friendOrg, err := organizationStore.CreateOrganization(&Organization{Name: fmt.Sprintf("Team %d", suffix)}, friend.Id)
+	require.NoError(t, err)
+	_, err = organizationStore.CreateInvitation(&Invitation{
+		OrganizationId: friendOrg.Id, Email: user.Email, Role: RoleAthlete, InvitedBy: friend.Id,
+	}, time.Hour)
+	require.NoError(t, err)
+
+	deletedAt, err := userStore.DeleteUser(user.Id)
+	require.NoError(t, err)
+
+	// deleted accounts can no longer sign in but can be restored
+	found, err := userStore.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = userStore.GetDeletedUser(user.Username)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, user.Id, found.Id)
+
+	// still within the grace period
+	_, err = userStore.PurgeDeletedUsers(deletedAt, 100)
+	require.NoError(t, err)
+	found, err = userStore.GetDeletedUser(user.Username)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+
+	purged, err := userStore.PurgeDeletedUsers(deletedAt.Add(time.Second), 100)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, 1)
+
+	byUser := []string{
+		`SELECT COUNT(*) FROM users WHERE id=$1`,
+		`SELECT COUNT(*) FROM workouts WHERE user_id=$1`,
+		`SELECT COUNT(*) FROM workout_comments WHERE user_id=$1`,
+		`SELECT COUNT(*) FROM follows WHERE follower_id=$1 OR followee_id=$1`,
+		`SELECT COUNT(*) FROM organization_members WHERE user_id=$1`,
+		`SELECT COUNT(*) FROM organization_invitations WHERE invited_by=$1`,
+		`SELECT COUNT(*) FROM outbox WHERE user_id=$1`,
+	}
+	for _, query := range byUser {
+		var count int
+		require.NoError(t, db.QueryRow(query, user.Id).Scan(&count))
+		assert.Zero(t, count, query)
+	}
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM workout_entries WHERE workout_id=$1`, workout.Id).Scan(&count))
+	assert.Zero(t, count, "workout entries")
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM organizations WHERE id=$1`, org.Id).Scan(&count))
+	assert.Zero(t, count, "organization without members")
+
+	// nothing else may mention the user's username or email
+	for _, table := range []string{"outbox", "webhook_deliveries", "webhook_jobs", "organization_invitations"} {
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s t WHERE t::text ILIKE '%%' || $1 || '%%' OR t::text ILIKE '%%' || $2 || '%%'`, table)
+		require.NoError(t, db.QueryRow(query, user.Username, user.Email).Scan(&count))
+		assert.Zero(t, count, table)
+	}
+
+	// the friend keeps their account and workouts
+	found, err = userStore.GetUserById(friend.Id)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM workouts WHERE id=$1`, friendWorkout.Id).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestRestoreUser(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userStore := NewPostgresUserStore(db)
+	user := createTestUser(t, userStore, fmt.Sprintf("restored_%d", time.Now().UnixNano()))
+
+	// only deleted accounts can be restored
+	assert.ErrorIs(t, userStore.RestoreUser(user.Id), sql.ErrNoRows)
+
+	_, err := userStore.DeleteUser(user.Id)
+	require.NoError(t, err)
+	require.NoError(t, userStore.RestoreUser(user.Id))
+
+	found, err := userStore.GetUserByUsername(user.Username)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, user.Id, found.Id)
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TrainingStats are the lifetime figures achievements are evaluated from.
+type TrainingStats struct {
+	Workouts       int
+	LifetimeVolume float64
+	// ActiveWeeks holds the start (Monday, UTC) of every week with at least
+	// one workout, in chronological order.
+	ActiveWeeks []time.Time
+}
+
+type Award struct {
+	UserId    int       `json:"user_id"`
+	Code      string    `json:"code"`
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+type PostgresAchievementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAchievementStore(db *sql.DB) *PostgresAchievementStore {
+	return &PostgresAchievementStore{db: db}
+}
+
+type AchievementStore interface {
+	GetTrainingStats(userId int) (*TrainingStats, error)
+	GetAwards(userId int) ([]Award, error)
+	// AwardAchievement records an award once, reporting whether it is new.
+	AwardAchievement(userId int, code string, awardedAt time.Time) (bool, error)
+}
+
+func (pg *PostgresAchievementStore) GetTrainingStats(userId int) (*TrainingStats, error) {
+	stats := &TrainingStats{}
+	query := `SELECT COUNT(*) FROM workouts w WHERE w.user_id=$1 AND ` + completedWorkout
+	err := pg.db.QueryRow(query, userId).Scan(&stats.Workouts)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT COALESCE(SUM(` + entryVolume + `),0)
+	FROM workouts w JOIN workout_entries e ON e.workout_id=w.id
+	WHERE w.user_id=$1 AND ` + completedWorkout + ` AND e.reps IS NOT NULL AND e.weight IS NOT NULL`
+	err = pg.db.QueryRow(query, userId).Scan(&stats.LifetimeVolume)
+	if err != nil {
+		return nil, err
+	}
+
+	// date_trunc('week') starts weeks on Monday
+	query = `
+	SELECT DISTINCT date_trunc('week', ` + performedAt + ` AT TIME ZONE 'UTC') AS week
+	FROM workouts w WHERE w.user_id=$1 AND ` + completedWorkout + `
+	ORDER BY week`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var week time.Time
+		if err := rows.Scan(&week); err != nil {
+			return nil, err
+		}
+		stats.ActiveWeeks = append(stats.ActiveWeeks, week.UTC())
+	}
+	return stats, rows.Err()
+}
+
+func (pg *PostgresAchievementStore) GetAwards(userId int) ([]Award, error) {
+	rows, err := pg.db.Query(`SELECT user_id,code,awarded_at FROM user_achievements WHERE user_id=$1 ORDER BY awarded_at, code`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := []Award{}
+	for rows.Next() {
+		var award Award
+		if err := rows.Scan(&award.UserId, &award.Code, &award.AwardedAt); err != nil {
+			return nil, err
+		}
+		awards = append(awards, award)
+	}
+	return awards, rows.Err()
+}
+
+// AwardAchievement records the award together with an achievement.awarded
+// event, so webhooks and notifications learn about new badges.
+func (pg *PostgresAchievementStore) AwardAchievement(userId int, code string, awardedAt time.Time) (bool, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	award := Award{UserId: userId, Code: code}
+	query := `
+	INSERT INTO user_achievements (user_id,code,awarded_at) VALUES ($1,$2,$3)
+	ON CONFLICT (user_id,code) DO NOTHING
+	RETURNING awarded_at`
+	err = tx.QueryRow(query, userId, code, awardedAt).Scan(&award.AwardedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = insertOutboxEvent(tx, Event{
+		Type:          EventAchievementAwarded,
+		AggregateType: AggregateUser,
+		AggregateId:   userId,
+		UserId:        userId,
+		Data:          award,
+		OccurredAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+)
+
+// lastUsedPrecision throttles the writes of last-used tracking for keys that
+// are used for many requests in a row.
+const lastUsedPrecision = time.Minute
+
+// APIKey is a personal key of a user. Only a hash of the full key is stored.
+type APIKey struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db}
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key *APIKey) (*APIKey, error)
+	GetAPIKeys(userId int) ([]APIKey, error)
+	DeleteAPIKey(id int64, userId int) error
+	GetUserForAPIKey(plaintextKey string) (*User, *APIKey, error)
+}
+
+func (pg *PostgresAPIKeyStore) CreateAPIKey(key *APIKey) (*APIKey, error) {
+	query := `
+	INSERT INTO api_keys (user_id,name,prefix,hash,scopes,expiry)
+	VALUES ($1,$2,$3,$4,string_to_array($5,','),$6)
+	RETURNING id,createdAT`
+	err := pg.db.QueryRow(query, key.UserId, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, ","), key.Expiry).
+		Scan(&key.Id, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (pg *PostgresAPIKeyStore) GetAPIKeys(userId int) ([]APIKey, error) {
+	query := `
+	SELECT id,user_id,name,prefix,array_to_string(scopes,','),expiry,last_used_at,createdAT
+	FROM api_keys WHERE user_id=$1 ORDER BY createdAT DESC`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		err := rows.Scan(&key.Id, &key.UserId, &key.Name, &key.Prefix, &scopes, &key.Expiry, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (pg *PostgresAPIKeyStore) DeleteAPIKey(id int64, userId int) error {
+	result, err := pg.db.Exec(`DELETE FROM api_keys WHERE id=$1 AND user_id=$2`, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserForAPIKey returns the owner of a valid key and records its use. It
+// returns nil for unknown and expired keys.
+func (pg *PostgresAPIKeyStore) GetUserForAPIKey(plaintextKey string) (*User, *APIKey, error) {
+	key := &APIKey{}
+	var scopes string
+	query := `
+	SELECT id,user_id,name,prefix,array_to_string(scopes,','),expiry,last_used_at,createdAT
+	FROM api_keys WHERE hash=$1 AND (expiry IS NULL OR expiry > $2)`
+	err := pg.db.QueryRow(query, tokens.Hash(plaintextKey), time.Now()).Scan(&key.Id, &key.UserId, &key.Name,
+		&key.Prefix, &scopes, &key.Expiry, &key.LastUsedAt, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+
+	query = `SELECT ` + userColumns + ` FROM users u WHERE u.id=$1 AND ` + activeUser
+	user, err := scanUser(pg.db.QueryRow(query, key.UserId))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedPrecision {
+		_, err = pg.db.Exec(`UPDATE api_keys SET last_used_at=$1 WHERE id=$2`, now, key.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return user, key, nil
+}
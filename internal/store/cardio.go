@@ -0,0 +1,168 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// DefaultBodyweightKg is used for calorie estimates when the athlete's
+// bodyweight is unknown.
+const DefaultBodyweightKg = 70.0
+
+// strengthMET is the metabolic equivalent used for the part of a workout not
+// covered by timed cardio entries.
+const strengthMET = 5.0
+
+// prepare validates an entry before it is written and fills every field that
+// is derived from others.
+func (e *WorkoutEntry) prepare() error {
+	if err := e.normalizeSets(); err != nil {
+		return err
+	}
+	if err := e.validateCardio(); err != nil {
+		return err
+	}
+	if e.DistanceMeters != nil && e.Sets == 0 {
+		e.Sets = 1
+	}
+	e.deriveCardioMetrics()
+	return nil
+}
+
+func (e *WorkoutEntry) validateCardio() error {
+	if e.Reps == nil && e.DurationSeconds == nil && e.DistanceMeters == nil {
+		return errors.New("entry " + e.ExerciseName + ": one of reps, duration_seconds or distance_meters is required")
+	}
+	if e.Reps != nil && e.DurationSeconds != nil {
+		return errors.New("entry " + e.ExerciseName + ": reps and duration_seconds are mutually exclusive")
+	}
+	if e.DistanceMeters != nil && *e.DistanceMeters <= 0 {
+		return errors.New("distance_meters must be positive")
+	}
+	if e.ElevationGainMeters != nil && *e.ElevationGainMeters < 0 {
+		return errors.New("elevation_gain_meters must not be negative")
+	}
+	for _, hr := range []*int{e.AvgHeartRate, e.MaxHeartRate} {
+		if hr != nil && (*hr < 20 || *hr > 250) {
+			return errors.New("heart rate must be between 20 and 250 bpm")
+		}
+	}
+	if e.AvgHeartRate != nil && e.MaxHeartRate != nil && *e.AvgHeartRate > *e.MaxHeartRate {
+		return errors.New("avg_heart_rate must not exceed max_heart_rate")
+	}
+	return nil
+}
+
+// deriveCardioMetrics computes pace and speed for entries with both a
+// distance and a duration.
+func (e *WorkoutEntry) deriveCardioMetrics() {
+	e.PaceSecondsPerKm = nil
+	e.SpeedKmh = nil
+	if e.DistanceMeters == nil || e.DurationSeconds == nil || *e.DistanceMeters <= 0 || *e.DurationSeconds <= 0 {
+		return
+	}
+	km := *e.DistanceMeters / 1000
+	seconds := float64(*e.DurationSeconds)
+	pace := math.Round(seconds/km*10) / 10
+	speed := math.Round(km/(seconds/3600)*100) / 100
+	e.PaceSecondsPerKm = &pace
+	e.SpeedKmh = &speed
+}
+
+type activity int
+
+const (
+	activityRun activity = iota
+	activityWalk
+	activityCycle
+	activityRow
+	activitySwim
+)
+
+func classifyActivity(exerciseName string) activity {
+	name := strings.ToLower(exerciseName)
+	switch {
+	case strings.Contains(name, "walk") || strings.Contains(name, "hike"):
+		return activityWalk
+	case strings.Contains(name, "cycl") || strings.Contains(name, "bike") || strings.Contains(name, "ride"):
+		return activityCycle
+	case strings.Contains(name, "row"):
+		return activityRow
+	case strings.Contains(name, "swim"):
+		return activitySwim
+	}
+	return activityRun
+}
+
+// cardioMET approximates the metabolic equivalent of a distance entry from
+// its activity and average speed (Compendium of Physical Activities).
+func cardioMET(a activity, speedKmh float64) float64 {
+	switch a {
+	case activityWalk:
+		if speedKmh >= 6.5 {
+			return 5.0
+		}
+		return 3.5
+	case activityCycle:
+		switch {
+		case speedKmh < 16:
+			return 4.0
+		case speedKmh < 19:
+			return 6.8
+		case speedKmh < 22.5:
+			return 8.0
+		case speedKmh < 25.7:
+			return 10.0
+		}
+		return 12.0
+	case activityRow:
+		return 7.0
+	case activitySwim:
+		return 8.0
+	}
+	// running burns roughly one MET per km/h
+	return math.Max(6.0, speedKmh)
+}
+
+// kcalPerKgKm is used for distance entries without a duration.
+var kcalPerKgKm = map[activity]float64{
+	activityRun:   1.0,
+	activityWalk:  0.5,
+	activityCycle: 0.3,
+	activityRow:   0.6,
+	activitySwim:  2.5,
+}
+
+// EstimateCalories estimates the energy expenditure of a workout. Distance
+// entries are estimated from their activity and speed; the rest of the
+// workout duration is treated as strength training.
+func EstimateCalories(workout *Workout, bodyweightKg float64) int {
+	if bodyweightKg <= 0 {
+		bodyweightKg = DefaultBodyweightKg
+	}
+
+	kcal := 0.0
+	cardioSeconds := 0
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		if entry.DistanceMeters == nil {
+			continue
+		}
+		a := classifyActivity(entry.ExerciseName)
+		km := *entry.DistanceMeters / 1000
+		if entry.DurationSeconds != nil && *entry.DurationSeconds > 0 {
+			hours := float64(*entry.DurationSeconds) / 3600
+			kcal += cardioMET(a, km/hours) * bodyweightKg * hours
+			cardioSeconds += *entry.DurationSeconds
+			continue
+		}
+		kcal += kcalPerKgKm[a] * bodyweightKg * km
+	}
+
+	remainingHours := (float64(workout.DurationMinutes*60) - float64(cardioSeconds)) / 3600
+	if remainingHours > 0 {
+		kcal += strengthMET * bodyweightKg * remainingHours
+	}
+	return int(math.Round(kcal))
+}
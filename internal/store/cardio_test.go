@@ -0,0 +1,87 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareCardioEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     WorkoutEntry
+		wantErr   bool
+		wantPace  *float64
+		wantSpeed *float64
+	}{
+		{
+			name:      "5k run",
+			entry:     WorkoutEntry{ExerciseName: "Run", DistanceMeters: FloatPtr(5000), DurationSeconds: IntPtr(1500), AvgHeartRate: IntPtr(150), MaxHeartRate: IntPtr(172)},
+			wantPace:  FloatPtr(300),
+			wantSpeed: FloatPtr(12),
+		},
+		{
+			name:  "distance only",
+			entry: WorkoutEntry{ExerciseName: "Row", DistanceMeters: FloatPtr(2000)},
+		},
+		{
+			name:    "nothing measured",
+			entry:   WorkoutEntry{ExerciseName: "Run"},
+			wantErr: true,
+		},
+		{
+			name:    "avg above max heart rate",
+			entry:   WorkoutEntry{ExerciseName: "Ride", DistanceMeters: FloatPtr(20000), AvgHeartRate: IntPtr(160), MaxHeartRate: IntPtr(150)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.prepare()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, tt.entry.Sets)
+			assert.Equal(t, tt.wantPace, tt.entry.PaceSecondsPerKm)
+			assert.Equal(t, tt.wantSpeed, tt.entry.SpeedKmh)
+		})
+	}
+}
+
+func TestEstimateCalories(t *testing.T) {
+	tests := []struct {
+		name    string
+		workout Workout
+		want    int
+	}{
+		{
+			name: "strength only",
+			workout: Workout{DurationMinutes: 60, Entries: []WorkoutEntry{
+				{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(8)},
+			}},
+			want: 350,
+		},
+		{
+			name: "timed run",
+			workout: Workout{DurationMinutes: 30, Entries: []WorkoutEntry{
+				{ExerciseName: "Run", DistanceMeters: FloatPtr(6000), DurationSeconds: IntPtr(1800)},
+			}},
+			want: 420,
+		},
+		{
+			name: "run without duration plus strength",
+			workout: Workout{DurationMinutes: 30, Entries: []WorkoutEntry{
+				{ExerciseName: "Run", DistanceMeters: FloatPtr(5000)},
+			}},
+			want: 525,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EstimateCalories(&tt.workout, DefaultBodyweightKg))
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+var ErrChallengeEnded = errors.New("challenge has already ended")
+
+type PostgresChallengeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresChallengeStore(db *sql.DB) *PostgresChallengeStore {
+	return &PostgresChallengeStore{db: db}
+}
+
+type ChallengeStore interface {
+	CreateChallenge(*Challenge) (*Challenge, error)
+	GetChallengeById(id int64, viewerId int) (*Challenge, error)
+	GetChallengesForUser(userId int) ([]Challenge, error)
+	JoinChallenge(challengeId int64, userId int) error
+	LeaveChallenge(challengeId int64, userId int) error
+	GetStandings(challengeId int64) ([]Standing, error)
+	RefreshStandings(userId int) error
+}
+
+// entryReps counts the reps of a workout entry (alias e) like entryVolume
+// weighs them: completed working sets when it has set details, otherwise
+// sets x reps.
+const entryReps = `COALESCE(
+	(SELECT SUM(s.reps) FROM workout_sets s WHERE s.entry_id=e.id AND s.set_type<>'warmup' AND s.completed),
+	e.sets*e.reps)`
+
+// inChallenge restricts workouts w to the completed ones participant p
+// performed during challenge c.
+const inChallenge = `w.user_id=p.user_id AND ` + completedWorkout + `
+	AND ` + performedAt + ` >= c.starts_at AND ` + performedAt + ` < c.ends_at`
+
+// matchesExercise restricts entries e to the exercise of challenge c.
+const matchesExercise = `LOWER(e.exercise_name)=LOWER(c.exercise_name)`
+
+// refreshStandings returns the statement recomputing the cached score of
+// the participants p of challenges c matched by condition.
+func refreshStandings(condition string) string {
+	return `
+	UPDATE challenge_participants cp SET score=s.score,reached_at=s.reached_at,refreshed_at=CURRENT_TIMESTAMP
+	FROM (
+		SELECT p.challenge_id,p.user_id,
+			CASE c.metric
+			WHEN 'volume' THEN (SELECT COALESCE(SUM(` + entryVolume + `),0)
+				FROM workouts w JOIN workout_entries e ON e.workout_id=w.id WHERE ` + inChallenge + `)
+			WHEN 'workouts' THEN (SELECT COUNT(*) FROM workouts w WHERE ` + inChallenge + `)
+			WHEN 'duration' THEN (SELECT COALESCE(SUM(w.duration_minutes),0) FROM workouts w WHERE ` + inChallenge + `)
+			ELSE (SELECT COALESCE(SUM(` + entryReps + `),0)
+				FROM workouts w JOIN workout_entries e ON e.workout_id=w.id WHERE ` + inChallenge + ` AND ` + matchesExercise + `)
+			END AS score,
+			CASE c.metric
+			WHEN 'exercise_reps' THEN (SELECT MAX(` + performedAt + `)
+				FROM workouts w JOIN workout_entries e ON e.workout_id=w.id WHERE ` + inChallenge + ` AND ` + matchesExercise + `)
+			ELSE (SELECT MAX(` + performedAt + `) FROM workouts w WHERE ` + inChallenge + `)
+			END AS reached_at
+		FROM challenge_participants p
+		JOIN challenges c ON c.id=p.challenge_id
+		WHERE ` + condition + `
+	) s WHERE cp.challenge_id=s.challenge_id AND cp.user_id=s.user_id`
+}
+
+const challengeColumns = `c.id,COALESCE(c.created_by,0),c.organization_id,c.title,c.metric,COALESCE(c.exercise_name,''),
+	c.starts_at,c.ends_at,c.createdAT,c.updatedAt,
+	(SELECT COUNT(*) FROM challenge_participants p WHERE p.challenge_id=c.id),
+	EXISTS (SELECT 1 FROM challenge_participants p WHERE p.challenge_id=c.id AND p.user_id=$1)`
+
+func scanChallenge(row interface{ Scan(...interface{}) error }) (*Challenge, error) {
+	c := &Challenge{WeightUnit: units.Canonical}
+	err := row.Scan(&c.Id, &c.CreatedBy, &c.OrganizationId, &c.Title, &c.Metric, &c.ExerciseName,
+		&c.StartsAt, &c.EndsAt, &c.CreatedAt, &c.UpdatedAt, &c.Participants, &c.Joined)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (pg *PostgresChallengeStore) CreateChallenge(challenge *Challenge) (*Challenge, error) {
+	var id int64
+	query := `
+	INSERT INTO challenges (created_by,organization_id,title,metric,exercise_name,starts_at,ends_at)
+	VALUES ($1,$2,$3,$4,NULLIF($5,''),$6,$7)
+	RETURNING id`
+	err := pg.db.QueryRow(query, challenge.CreatedBy, challenge.OrganizationId, challenge.Title, challenge.Metric,
+		challenge.ExerciseName, challenge.StartsAt, challenge.EndsAt).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return pg.GetChallengeById(id, challenge.CreatedBy)
+}
+
+// GetChallengeById reads a challenge; Joined tells whether viewerId takes
+// part in it.
+func (pg *PostgresChallengeStore) GetChallengeById(id int64, viewerId int) (*Challenge, error) {
+	query := `SELECT ` + challengeColumns + ` FROM challenges c WHERE c.id=$2`
+	return scanChallenge(pg.db.QueryRow(query, viewerId, id))
+}
+
+// GetChallengesForUser lists the open challenges and those of the
+// organizations userId is a member of, the most recent first.
+func (pg *PostgresChallengeStore) GetChallengesForUser(userId int) ([]Challenge, error) {
+	query := `
+	SELECT ` + challengeColumns + `
+	FROM challenges c
+	WHERE c.organization_id IS NULL
+		OR EXISTS (SELECT 1 FROM organization_members m WHERE m.organization_id=c.organization_id AND m.user_id=$1)
+	ORDER BY c.starts_at DESC,c.id DESC`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges := []Challenge{}
+	for rows.Next() {
+		challenge, err := scanChallenge(rows)
+		if err != nil {
+			return nil, err
+		}
+		challenges = append(challenges, *challenge)
+	}
+	return challenges, rows.Err()
+}
+
+// JoinChallenge adds userId to a challenge that has not ended yet and scores
+// the workouts they already performed during it. Joining twice is a no-op.
+func (pg *PostgresChallengeStore) JoinChallenge(challengeId int64, userId int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var endsAt time.Time
+	err = tx.QueryRow(`SELECT ends_at FROM challenges WHERE id=$1`, challengeId).Scan(&endsAt)
+	if err != nil {
+		return err
+	}
+	if !endsAt.After(time.Now()) {
+		return ErrChallengeEnded
+	}
+
+	query := `INSERT INTO challenge_participants (challenge_id,user_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(query, challengeId, userId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(refreshStandings(`p.challenge_id=$1 AND p.user_id=$2`), challengeId, userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresChallengeStore) LeaveChallenge(challengeId int64, userId int) error {
+	query := `DELETE FROM challenge_participants WHERE challenge_id=$1 AND user_id=$2`
+	result, err := pg.db.Exec(query, challengeId, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetStandings returns the ranked leaderboard from the cached scores.
+func (pg *PostgresChallengeStore) GetStandings(challengeId int64) ([]Standing, error) {
+	query := `
+	SELECT p.user_id,u.username,p.score,p.reached_at,p.joined_at
+	FROM challenge_participants p
+	JOIN users u ON u.id=p.user_id
+	WHERE p.challenge_id=$1 AND ` + activeUser + `
+	ORDER BY p.score DESC,p.reached_at NULLS LAST`
+	rows, err := pg.db.Query(query, challengeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standings := []Standing{}
+	for rows.Next() {
+		var s Standing
+		err := rows.Scan(&s.UserId, &s.Username, &s.Score, &s.ReachedAt, &s.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		standings = append(standings, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	RankStandings(standings)
+	return standings, nil
+}
+
+// RefreshStandings recomputes the scores of userId in every challenge they
+// take part in. It runs after each workout write so that edits and deletions
+// of past workouts are reflected too.
+func (pg *PostgresChallengeStore) RefreshStandings(userId int) error {
+	_, err := pg.db.Exec(refreshStandings(`p.user_id=$1`), userId)
+	return err
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+const (
+	ChallengeVolume       = "volume"
+	ChallengeWorkouts     = "workouts"
+	ChallengeDuration     = "duration"
+	ChallengeExerciseReps = "exercise_reps"
+)
+
+const maxChallengeDays = 366
+
+type Challenge struct {
+	Id             int              `json:"id"`
+	CreatedBy      int              `json:"created_by"`
+	OrganizationId *int             `json:"organization_id"`
+	Title          string           `json:"title"`
+	Metric         string           `json:"metric"`
+	ExerciseName   string           `json:"exercise_name,omitempty"`
+	StartsAt       time.Time        `json:"starts_at"`
+	EndsAt         time.Time        `json:"ends_at"`
+	Participants   int              `json:"participants"`
+	Joined         bool             `json:"joined"`
+	WeightUnit     units.WeightUnit `json:"weight_unit"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+func (c *Challenge) Validate() error {
+	if c.Title == "" {
+		return errors.New("title is required")
+	}
+	switch c.Metric {
+	case ChallengeVolume, ChallengeWorkouts, ChallengeDuration:
+		c.ExerciseName = ""
+	case ChallengeExerciseReps:
+		if c.ExerciseName == "" {
+			return errors.New("exercise_name is required for exercise_reps challenges")
+		}
+	default:
+		return errors.New("metric must be one of volume, workouts, duration or exercise_reps")
+	}
+	if c.StartsAt.IsZero() || c.EndsAt.IsZero() {
+		return errors.New("starts_at and ends_at are required")
+	}
+	if !c.EndsAt.After(c.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if c.EndsAt.Sub(c.StartsAt) > maxChallengeDays*24*time.Hour {
+		return errors.New("challenges can last at most 366 days")
+	}
+	return nil
+}
+
+// Weighted reports whether the scores of the challenge are weights.
+func (c *Challenge) Weighted() bool {
+	return c.Metric == ChallengeVolume
+}
+
+type Standing struct {
+	Rank     int     `json:"rank"`
+	UserId   int     `json:"user_id"`
+	Username string  `json:"username"`
+	Score    float64 `json:"score"`
+	// ReachedAt is when the last workout counting towards the score was
+	// performed; of two equal scores the one reached first ranks higher
+	ReachedAt *time.Time `json:"reached_at"`
+	JoinedAt  time.Time  `json:"joined_at"`
+}
+
+// RankStandings orders standings by score, then by who reached the score
+// first, then by who joined first, and assigns competition ranks (1, 2, 2,
+// 4): only participants equal on score and time reached share a rank.
+func RankStandings(standings []Standing) {
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !sameTime(a.ReachedAt, b.ReachedAt) {
+			return reachedBefore(a.ReachedAt, b.ReachedAt)
+		}
+		if !a.JoinedAt.Equal(b.JoinedAt) {
+			return a.JoinedAt.Before(b.JoinedAt)
+		}
+		return a.UserId < b.UserId
+	})
+
+	for i := range standings {
+		if i > 0 && standings[i].Score == standings[i-1].Score && sameTime(standings[i].ReachedAt, standings[i-1].ReachedAt) {
+			standings[i].Rank = standings[i-1].Rank
+			continue
+		}
+		standings[i].Rank = i + 1
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// reachedBefore orders participants without any counted workout last.
+func reachedBefore(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return b == nil && a != nil
+	}
+	return a.Before(*b)
+}
+
+func (s *Standing) ConvertWeights(from, to units.WeightUnit) {
+	s.Score = units.Convert(s.Score, from, to)
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankStandings(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 18, 0, 0, 0, time.UTC) }
+	joined := day(1)
+
+	standings := []Standing{
+		{UserId: 1, Score: 5000, ReachedAt: timePtr(day(20)), JoinedAt: joined},
+		{UserId: 2, Score: 7000, ReachedAt: timePtr(day(25)), JoinedAt: joined},
+		{UserId: 3, Score: 5000, ReachedAt: timePtr(day(12)), JoinedAt: joined},
+		{UserId: 4, Score: 0, JoinedAt: joined},
+		{UserId: 5, Score: 5000, ReachedAt: timePtr(day(12)), JoinedAt: day(2)},
+		{UserId: 6, Score: 0, ReachedAt: timePtr(day(3)), JoinedAt: day(3)},
+	}
+	RankStandings(standings)
+
+	var order, ranks []int
+	for _, s := range standings {
+		order = append(order, s.UserId)
+		ranks = append(ranks, s.Rank)
+	}
+	// equal scores reached at the same time share a rank but keep joining order
+	assert.Equal(t, []int{2, 3, 5, 1, 6, 4}, order)
+	assert.Equal(t, []int{1, 2, 2, 4, 5, 6}, ranks)
+}
+
+func TestChallengeValidate(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		challenge Challenge
+		wantErr   bool
+	}{
+		{name: "volume", challenge: Challenge{Title: "June", Metric: ChallengeVolume, StartsAt: start, EndsAt: start.AddDate(0, 1, 0)}},
+		{name: "exercise reps", challenge: Challenge{Title: "Pull ups", Metric: ChallengeExerciseReps, ExerciseName: "Pull Up", StartsAt: start, EndsAt: start.AddDate(0, 1, 0)}},
+		{name: "exercise reps without exercise", challenge: Challenge{Title: "Reps", Metric: ChallengeExerciseReps, StartsAt: start, EndsAt: start.AddDate(0, 1, 0)}, wantErr: true},
+		{name: "unknown metric", challenge: Challenge{Title: "Km", Metric: "distance", StartsAt: start, EndsAt: start.AddDate(0, 1, 0)}, wantErr: true},
+		{name: "ends before start", challenge: Challenge{Title: "June", Metric: ChallengeWorkouts, StartsAt: start, EndsAt: start}, wantErr: true},
+		{name: "too long", challenge: Challenge{Title: "Forever", Metric: ChallengeDuration, StartsAt: start, EndsAt: start.AddDate(2, 0, 0)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.challenge.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxCommentLength = 2000
+
+const (
+	CommentVisible = "visible"
+	// CommentHeld comments wait for the workout owner's approval and are
+	// only shown to their author and the owner
+	CommentHeld = "held"
+)
+
+var ErrInvalidParent = errors.New("parent_id must be a comment on the same workout")
+
+type ReactionKind string
+
+const (
+	ReactionLike   ReactionKind = "like"
+	ReactionFire   ReactionKind = "fire"
+	ReactionStrong ReactionKind = "strong"
+)
+
+func ParseReactionKind(value string) (ReactionKind, error) {
+	switch kind := ReactionKind(value); kind {
+	case ReactionLike, ReactionFire, ReactionStrong:
+		return kind, nil
+	}
+	return "", errors.New("reaction must be one of like, fire or strong")
+}
+
+type Comment struct {
+	Id               int        `json:"id"`
+	WorkoutId        int        `json:"workout_id"`
+	UserId           int        `json:"user_id"`
+	Username         string     `json:"username"`
+	ParentId         *int       `json:"parent_id"`
+	Body             string     `json:"body"`
+	Status           string     `json:"status"`
+	ModerationReason string     `json:"moderation_reason,omitempty"`
+	Deleted          bool       `json:"deleted"`
+	EditedAt         *time.Time `json:"edited_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Replies          []Comment  `json:"replies,omitempty"`
+}
+
+func (c *Comment) Validate() error {
+	c.Body = strings.TrimSpace(c.Body)
+	if c.Body == "" {
+		return errors.New("body is required")
+	}
+	if utf8.RuneCountInString(c.Body) > maxCommentLength {
+		return errors.New("body must be at most 2000 characters")
+	}
+	return nil
+}
+
+type reactionData struct {
+	WorkoutId int          `json:"workout_id"`
+	UserId    int          `json:"user_id"`
+	Username  string       `json:"username"`
+	Kind      ReactionKind `json:"kind"`
+}
+
+type PostgresCommentStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCommentStore(db *sql.DB) *PostgresCommentStore {
+	return &PostgresCommentStore{db: db}
+}
+
+type CommentStore interface {
+	CreateComment(*Comment) (*Comment, error)
+	GetCommentById(id int64) (*Comment, error)
+	GetComments(workoutId int64, viewerId int) ([]Comment, error)
+	UpdateComment(*Comment) error
+	DeleteComment(id int64, userId int) error
+	ApproveComment(id int64, ownerId int) error
+	AddReaction(workoutId int64, userId int, kind ReactionKind) error
+	RemoveReaction(workoutId int64, userId int, kind ReactionKind) error
+}
+
+// commentEvent notifies the owner of the workout the comment was posted on.
+func commentEvent(eventType string, ownerId int, comment *Comment) Event {
+	return Event{
+		Type:          eventType,
+		AggregateType: AggregateWorkout,
+		AggregateId:   comment.WorkoutId,
+		UserId:        ownerId,
+		Data:          comment,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+// comments of accounts scheduled for deletion read as deleted
+const commentColumns = `c.id,c.workout_id,c.user_id,u.username,c.parent_id,c.body,c.status,COALESCE(c.moderation_reason,''),
+	(c.deleted_at IS NOT NULL OR u.deleted_at IS NOT NULL),c.edited_at,c.createdAT`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (*Comment, error) {
+	c := &Comment{}
+	err := row.Scan(&c.Id, &c.WorkoutId, &c.UserId, &c.Username, &c.ParentId, &c.Body, &c.Status, &c.ModerationReason,
+		&c.Deleted, &c.EditedAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if c.Deleted {
+		c.Body = ""
+	}
+	return c, nil
+}
+
+// CreateComment stores a comment. Replies to a reply are attached to the
+// top level comment so threads stay one level deep. The workout owner is
+// notified once the comment is visible.
+func (pg *PostgresCommentStore) CreateComment(comment *Comment) (*Comment, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if comment.ParentId != nil {
+		var workoutId int
+		var rootId *int
+		query := `SELECT workout_id,parent_id FROM workout_comments WHERE id=$1 AND deleted_at IS NULL`
+		err = tx.QueryRow(query, *comment.ParentId).Scan(&workoutId, &rootId)
+		if err == sql.ErrNoRows || (err == nil && workoutId != comment.WorkoutId) {
+			return nil, ErrInvalidParent
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rootId != nil {
+			comment.ParentId = rootId
+		}
+	}
+	if comment.Status == "" {
+		comment.Status = CommentVisible
+	}
+
+	var id int64
+	query := `
+	INSERT INTO workout_comments (workout_id,user_id,parent_id,body,status,moderation_reason)
+	VALUES ($1,$2,$3,$4,$5,NULLIF($6,''))
+	RETURNING id`
+	err = tx.QueryRow(query, comment.WorkoutId, comment.UserId, comment.ParentId, comment.Body, comment.Status,
+		comment.ModerationReason).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	created, err := getComment(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if created.Status == CommentVisible {
+		err = notifyComment(tx, created)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func notifyComment(tx *sql.Tx, comment *Comment) error {
+	var ownerId int
+	err := tx.QueryRow(`SELECT COALESCE(user_id,0) FROM workouts WHERE id=$1`, comment.WorkoutId).Scan(&ownerId)
+	if err != nil {
+		return err
+	}
+	return insertOutboxEvent(tx, commentEvent(EventCommentCreated, ownerId, comment))
+}
+
+func (pg *PostgresCommentStore) GetCommentById(id int64) (*Comment, error) {
+	return getComment(pg.db, id)
+}
+
+func getComment(q querier, id int64) (*Comment, error) {
+	query := `SELECT ` + commentColumns + ` FROM workout_comments c JOIN users u ON u.id=c.user_id WHERE c.id=$1`
+	return scanComment(q.QueryRow(query, id))
+}
+
+// GetComments returns the comment threads of a workout in the order they
+// were posted. Held comments are only included for their author and the
+// workout owner.
+func (pg *PostgresCommentStore) GetComments(workoutId int64, viewerId int) ([]Comment, error) {
+	query := `
+	SELECT ` + commentColumns + `
+	FROM workout_comments c
+	JOIN users u ON u.id=c.user_id
+	JOIN workouts w ON w.id=c.workout_id
+	WHERE c.workout_id=$1 AND (c.status='visible' OR c.user_id=$2 OR w.user_id=$2)
+	ORDER BY c.id`
+	rows, err := pg.db.Query(query, workoutId, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, *comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ThreadComments(comments), nil
+}
+
+// ThreadComments nests replies under their top level comment. Deleted
+// comments are only kept as placeholders for threads that have replies, and
+// replies whose parent is not in comments are dropped.
+func ThreadComments(comments []Comment) []Comment {
+	replies := map[int][]Comment{}
+	for _, c := range comments {
+		if c.ParentId != nil && !c.Deleted {
+			replies[*c.ParentId] = append(replies[*c.ParentId], c)
+		}
+	}
+
+	threads := []Comment{}
+	for _, c := range comments {
+		if c.ParentId != nil {
+			continue
+		}
+		c.Replies = replies[c.Id]
+		if c.Deleted && len(c.Replies) == 0 {
+			continue
+		}
+		threads = append(threads, c)
+	}
+	return threads
+}
+
+// UpdateComment edits the body of a comment of comment.UserId and records
+// the new moderation outcome.
+func (pg *PostgresCommentStore) UpdateComment(comment *Comment) error {
+	query := `
+	UPDATE workout_comments SET body=$1,status=$2,moderation_reason=NULLIF($3,''),edited_at=CURRENT_TIMESTAMP,updatedAt=CURRENT_TIMESTAMP
+	WHERE id=$4 AND user_id=$5 AND deleted_at IS NULL
+	RETURNING edited_at`
+	err := pg.db.QueryRow(query, comment.Body, comment.Status, comment.ModerationReason, comment.Id, comment.UserId).Scan(&comment.EditedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteComment soft deletes a comment. Both its author and the owner of the
+// workout may delete it.
+func (pg *PostgresCommentStore) DeleteComment(id int64, userId int) error {
+	query := `
+	UPDATE workout_comments c SET deleted_at=CURRENT_TIMESTAMP,updatedAt=CURRENT_TIMESTAMP
+	FROM workouts w
+	WHERE c.id=$1 AND w.id=c.workout_id AND c.deleted_at IS NULL AND (c.user_id=$2 OR w.user_id=$2)`
+	result, err := pg.db.Exec(query, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ApproveComment publishes a held comment on a workout of ownerId.
+func (pg *PostgresCommentStore) ApproveComment(id int64, ownerId int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE workout_comments c SET status='visible',moderation_reason=NULL,updatedAt=CURRENT_TIMESTAMP
+	FROM workouts w
+	WHERE c.id=$1 AND w.id=c.workout_id AND w.user_id=$2 AND c.status='held' AND c.deleted_at IS NULL`
+	result, err := tx.Exec(query, id, ownerId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	comment, err := getComment(tx, id)
+	if err != nil {
+		return err
+	}
+	err = insertOutboxEvent(tx, commentEvent(EventCommentCreated, ownerId, comment))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddReaction records a reaction of userId. Reacting twice with the same
+// kind is a no-op and only the first reaction notifies the workout owner.
+func (pg *PostgresCommentStore) AddReaction(workoutId int64, userId int, kind ReactionKind) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO workout_reactions (workout_id,user_id,kind) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`
+	result, err := tx.Exec(query, workoutId, userId, kind)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return tx.Commit()
+	}
+
+	var ownerId int
+	data := reactionData{WorkoutId: int(workoutId), UserId: userId, Kind: kind}
+	query = `SELECT COALESCE(w.user_id,0),u.username FROM workouts w, users u WHERE w.id=$1 AND u.id=$2`
+	err = tx.QueryRow(query, workoutId, userId).Scan(&ownerId, &data.Username)
+	if err != nil {
+		return err
+	}
+	err = insertOutboxEvent(tx, Event{
+		Type:          EventReactionAdded,
+		AggregateType: AggregateWorkout,
+		AggregateId:   int(workoutId),
+		UserId:        ownerId,
+		Data:          data,
+		OccurredAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresCommentStore) RemoveReaction(workoutId int64, userId int, kind ReactionKind) error {
+	query := `DELETE FROM workout_reactions WHERE workout_id=$1 AND user_id=$2 AND kind=$3`
+	result, err := pg.db.Exec(query, workoutId, userId, kind)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// getInteractions fills the visible comment count and the reaction counts
+// of a workout.
+func getInteractions(q querier, workout *Workout) error {
+	query := `SELECT COUNT(*) FROM workout_comments WHERE workout_id=$1 AND status='visible' AND deleted_at IS NULL`
+	err := q.QueryRow(query, workout.Id).Scan(&workout.CommentCount)
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.Query(`SELECT kind,COUNT(*) FROM workout_reactions WHERE workout_id=$1 GROUP BY kind`, workout.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	workout.Reactions = map[ReactionKind]int{ReactionLike: 0, ReactionFire: 0, ReactionStrong: 0}
+	for rows.Next() {
+		var kind ReactionKind
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return err
+		}
+		workout.Reactions[kind] = count
+	}
+	return rows.Err()
+}
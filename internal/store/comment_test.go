@@ -0,0 +1,50 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThreadComments(t *testing.T) {
+	comments := []Comment{
+		{Id: 1, Body: "nice"},
+		{Id: 2, Deleted: true},
+		{Id: 3, ParentId: IntPtr(1), Body: "thanks"},
+		{Id: 4, Deleted: true},
+		{Id: 5, ParentId: IntPtr(2), Body: "what did they say?"},
+		{Id: 6, ParentId: IntPtr(1), Deleted: true},
+		{Id: 7, ParentId: IntPtr(99), Body: "reply to a held comment"},
+	}
+
+	threads := ThreadComments(comments)
+	require.Len(t, threads, 2)
+
+	assert.Equal(t, 1, threads[0].Id)
+	require.Len(t, threads[0].Replies, 1)
+	assert.Equal(t, 3, threads[0].Replies[0].Id)
+
+	// deleted comments stay as placeholders while they have replies
+	assert.Equal(t, 2, threads[1].Id)
+	assert.True(t, threads[1].Deleted)
+	require.Len(t, threads[1].Replies, 1)
+	assert.Equal(t, 5, threads[1].Replies[0].Id)
+}
+
+func TestCommentValidate(t *testing.T) {
+	comment := Comment{Body: "  strong work  "}
+	require.NoError(t, comment.Validate())
+	assert.Equal(t, "strong work", comment.Body)
+
+	assert.Error(t, (&Comment{Body: " \n "}).Validate())
+	assert.Error(t, (&Comment{Body: strings.Repeat("x", maxCommentLength+1)}).Validate())
+	assert.NoError(t, (&Comment{Body: strings.Repeat("ü", maxCommentLength)}).Validate())
+
+	_, err := ParseReactionKind("love")
+	assert.Error(t, err)
+	kind, err := ParseReactionKind("fire")
+	require.NoError(t, err)
+	assert.Equal(t, ReactionFire, kind)
+}
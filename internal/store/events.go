@@ -0,0 +1,60 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AggregateWorkout = "workout"
+	AggregateUser    = "user"
+)
+
+const (
+	EventWorkoutCreated  = "workout.created"
+	EventWorkoutUpdated  = "workout.updated"
+	EventWorkoutDeleted  = "workout.deleted"
+	EventWorkoutRestored = "workout.restored"
+
+	EventWorkoutEntryCreated = "workout_entry.created"
+	EventWorkoutEntryUpdated = "workout_entry.updated"
+	EventWorkoutEntryDeleted = "workout_entry.deleted"
+
+	EventWorkoutSessionStarted  = "workout_session.started"
+	EventWorkoutSetLogged       = "workout_session.set_logged"
+	EventWorkoutSessionFinished = "workout_session.finished"
+
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserFollowed = "user.followed"
+
+	EventAchievementAwarded = "achievement.awarded"
+
+	EventCommentCreated = "workout_comment.created"
+	EventReactionAdded  = "workout_reaction.added"
+)
+
+type Event struct {
+	Id            string      `json:"id"`
+	Type          string      `json:"type"`
+	AggregateType string      `json:"aggregate_type"`
+	AggregateId   int         `json:"aggregate_id"`
+	UserId        int         `json:"user_id"`
+	Data          interface{} `json:"data"`
+	OccurredAt    time.Time   `json:"occurred_at"`
+}
+
+// insertOutboxEvent records the event in the outbox as part of tx so that it
+// is only ever published if the mutation that produced it commits.
+func insertOutboxEvent(tx *sql.Tx, event Event) error {
+	payload, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	query := `
+	INSERT INTO outbox (aggregate_type,aggregate_id,event_type,user_id,payload)
+	VALUES ($1,$2,$3,NULLIF($4,0),$5)`
+	_, err = tx.Exec(query, event.AggregateType, event.AggregateId, event.Type, event.UserId, string(payload))
+	return err
+}
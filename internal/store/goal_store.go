@@ -0,0 +1,204 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+type PostgresGoalStore struct {
+	db *sql.DB
+}
+
+func NewPostgresGoalStore(db *sql.DB) *PostgresGoalStore {
+	return &PostgresGoalStore{db: db}
+}
+
+type GoalStore interface {
+	CreateGoal(*Goal) (*Goal, error)
+	GetGoalById(id int64) (*Goal, error)
+	GetGoalsForUser(userId int) ([]Goal, error)
+	UpdateGoal(*Goal) error
+	DeleteGoal(id int64, userId int) error
+	EvaluateGoal(goal *Goal, now time.Time) error
+}
+
+// performedAt is when a workout took place: the start of live sessions and
+// imports, otherwise the time it was logged.
+const performedAt = `COALESCE(w.started_at,w.createdAT)`
+
+// completedWorkout excludes live sessions that are still running and
+// workouts in the trash.
+const completedWorkout = `(w.started_at IS NULL OR w.finished_at IS NOT NULL) AND w.deleted_at IS NULL`
+
+// entryVolume is the volume of a workout entry (alias e): its completed
+// working sets when it has set details, otherwise sets x reps x weight.
+const entryVolume = `COALESCE(
+	(SELECT SUM(s.reps*s.weight) FROM workout_sets s WHERE s.entry_id=e.id AND s.set_type<>'warmup' AND s.completed),
+	e.sets*e.reps*e.weight)`
+
+const goalColumns = `id,user_id,goal_type,title,COALESCE(exercise_name,''),target_value,start_value,COALESCE(period,''),
+	starts_at,deadline,achieved_at,createdAT,updatedAt`
+
+func scanGoal(row interface{ Scan(...interface{}) error }) (*Goal, error) {
+	g := &Goal{WeightUnit: units.Canonical}
+	err := row.Scan(&g.Id, &g.UserId, &g.Type, &g.Title, &g.ExerciseName, &g.TargetValue, &g.StartValue, &g.Period,
+		&g.StartsAt, &g.Deadline, &g.AchievedAt, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// CreateGoal stores a goal. Bodyweight goals without a start value start
+// from the latest recorded bodyweight.
+func (pg *PostgresGoalStore) CreateGoal(goal *Goal) (*Goal, error) {
+	if goal.StartsAt.IsZero() {
+		goal.StartsAt = time.Now().UTC()
+	}
+	if goal.Type == GoalBodyweight && goal.StartValue == nil {
+		bodyweight, err := latestBodyweight(pg.db, goal.UserId)
+		if err != nil {
+			return nil, err
+		}
+		goal.StartValue = bodyweight
+	}
+
+	query := `
+	INSERT INTO goals (user_id,goal_type,title,exercise_name,target_value,start_value,period,starts_at,deadline)
+	VALUES ($1,$2,$3,NULLIF($4,''),$5,$6,NULLIF($7,''),$8,$9)
+	RETURNING ` + goalColumns
+	return scanGoal(pg.db.QueryRow(query, goal.UserId, goal.Type, goal.Title, goal.ExerciseName, goal.TargetValue,
+		goal.StartValue, goal.Period, goal.StartsAt, goal.Deadline))
+}
+
+func (pg *PostgresGoalStore) GetGoalById(id int64) (*Goal, error) {
+	return scanGoal(pg.db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id=$1`, id))
+}
+
+func (pg *PostgresGoalStore) GetGoalsForUser(userId int) ([]Goal, error) {
+	rows, err := pg.db.Query(`SELECT `+goalColumns+` FROM goals WHERE user_id=$1 ORDER BY id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, *g)
+	}
+	return goals, rows.Err()
+}
+
+// UpdateGoal replaces the goal definition. A changed definition may no longer
+// be met, so the achievement is cleared and re-evaluated.
+func (pg *PostgresGoalStore) UpdateGoal(goal *Goal) error {
+	query := `
+	UPDATE goals
+	SET title=$1,exercise_name=NULLIF($2,''),target_value=$3,start_value=$4,period=NULLIF($5,''),starts_at=$6,deadline=$7,
+		achieved_at=NULL,updatedAt=CURRENT_TIMESTAMP
+	WHERE id=$8 AND user_id=$9
+	RETURNING updatedAt`
+	goal.AchievedAt = nil
+	return pg.db.QueryRow(query, goal.Title, goal.ExerciseName, goal.TargetValue, goal.StartValue, goal.Period,
+		goal.StartsAt, goal.Deadline, goal.Id, goal.UserId).Scan(&goal.UpdatedAt)
+}
+
+func (pg *PostgresGoalStore) DeleteGoal(id int64, userId int) error {
+	result, err := pg.db.Exec(`DELETE FROM goals WHERE id=$1 AND user_id=$2`, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EvaluateGoal fills in the progress of a goal from the user's workouts and
+// measurements. The first time a one-off goal is met the achievement is
+// recorded; frequency goals restart every period and are never recorded.
+func (pg *PostgresGoalStore) EvaluateGoal(goal *Goal, now time.Time) error {
+	samples, err := pg.goalSamples(goal, now)
+	if err != nil {
+		return err
+	}
+	goal.Progress = EvaluateGoal(goal, samples, now)
+
+	if goal.Progress.Achieved && goal.AchievedAt == nil && goal.Type != GoalFrequency {
+		err = pg.db.QueryRow(`UPDATE goals SET achieved_at=$1 WHERE id=$2 RETURNING achieved_at`, now, goal.Id).Scan(&goal.AchievedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pg *PostgresGoalStore) goalSamples(goal *Goal, now time.Time) ([]GoalSample, error) {
+	var query string
+	var args []interface{}
+	switch goal.Type {
+	case GoalLift:
+		// the heaviest weight lifted for at least one rep in each workout
+		query = `
+		SELECT ` + performedAt + `,MAX(e.weight)
+		FROM workouts w JOIN workout_entries e ON e.workout_id=w.id
+		WHERE w.user_id=$1 AND ` + completedWorkout + ` AND lower(e.exercise_name)=lower($2)
+			AND e.reps >= 1 AND e.weight IS NOT NULL AND ` + performedAt + ` <= $3
+		GROUP BY w.id ORDER BY 1`
+		args = []interface{}{goal.UserId, goal.ExerciseName, now}
+	case GoalFrequency:
+		// enough history for the current month and the pace window
+		query = `
+		SELECT ` + performedAt + `,1 FROM workouts w
+		WHERE w.user_id=$1 AND ` + completedWorkout + ` AND ` + performedAt + ` >= $2
+		ORDER BY 1`
+		args = []interface{}{goal.UserId, now.AddDate(0, 0, -32)}
+	case GoalVolume:
+		query = `
+		SELECT ` + performedAt + `,SUM(` + entryVolume + `)
+		FROM workouts w JOIN workout_entries e ON e.workout_id=w.id
+		WHERE w.user_id=$1 AND ` + completedWorkout + ` AND ($2='' OR lower(e.exercise_name)=lower($2))
+			AND e.reps IS NOT NULL AND e.weight IS NOT NULL AND ` + performedAt + ` >= $3
+		GROUP BY w.id ORDER BY 1`
+		args = []interface{}{goal.UserId, goal.ExerciseName, goal.StartsAt}
+	case GoalBodyweight:
+		query = `
+		SELECT measured_at,bodyweight FROM body_measurements
+		WHERE user_id=$1 AND bodyweight IS NOT NULL
+		ORDER BY measured_at, id`
+		args = []interface{}{goal.UserId}
+	default:
+		return nil, nil
+	}
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []GoalSample
+	for rows.Next() {
+		var sample GoalSample
+		var value sql.NullFloat64
+		err := rows.Scan(&sample.At, &value)
+		if err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			sample.Value = value.Float64
+			samples = append(samples, sample)
+		}
+	}
+	return samples, rows.Err()
+}
@@ -0,0 +1,338 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+const (
+	GoalLift       = "lift"
+	GoalFrequency  = "frequency"
+	GoalVolume     = "volume"
+	GoalBodyweight = "bodyweight"
+
+	GoalPeriodWeek  = "week"
+	GoalPeriodMonth = "month"
+)
+
+const (
+	// projections further out than this are not reported
+	maxProjection = 5 * 365 * 24 * time.Hour
+	// lift and frequency projections only look at recent training
+	goalTrendWindow = 12 * 7 * 24 * time.Hour
+	frequencyWindow = 4 * 7 * 24 * time.Hour
+)
+
+// Goal is a user goal. Weight based targets (lift, volume and bodyweight) are
+// stored in kilograms.
+type Goal struct {
+	Id           int              `json:"id"`
+	UserId       int              `json:"user_id"`
+	Type         string           `json:"type"`
+	Title        string           `json:"title"`
+	ExerciseName string           `json:"exercise_name"`
+	TargetValue  float64          `json:"target_value"`
+	StartValue   *float64         `json:"start_value"`
+	Period       string           `json:"period"`
+	StartsAt     time.Time        `json:"starts_at"`
+	Deadline     *time.Time       `json:"deadline"`
+	AchievedAt   *time.Time       `json:"achieved_at"`
+	WeightUnit   units.WeightUnit `json:"weight_unit"`
+	Progress     *GoalProgress    `json:"progress,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+type GoalProgress struct {
+	Current             float64    `json:"current"`
+	Percent             float64    `json:"percent"`
+	Achieved            bool       `json:"achieved"`
+	ProjectedCompletion *time.Time `json:"projected_completion"`
+	// OnTrack reports whether the projection meets the deadline, nil when
+	// the goal has no deadline or no projection.
+	OnTrack *bool `json:"on_track"`
+	// PeriodStart and PeriodEnd bound the current period of frequency goals.
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+}
+
+// GoalSample is one observation a goal is evaluated from: the best lift of a
+// workout, a workout, the volume of a workout or a bodyweight measurement.
+type GoalSample struct {
+	At    time.Time
+	Value float64
+}
+
+func (g *Goal) Validate() error {
+	switch g.Type {
+	case GoalLift:
+		if strings.TrimSpace(g.ExerciseName) == "" {
+			return errors.New("lift goals need an exercise_name")
+		}
+	case GoalFrequency:
+		if g.Period == "" {
+			g.Period = GoalPeriodWeek
+		}
+		if g.Period != GoalPeriodWeek && g.Period != GoalPeriodMonth {
+			return errors.New("period must be week or month")
+		}
+		if g.TargetValue != math.Trunc(g.TargetValue) {
+			return errors.New("frequency goals need a whole number of workouts")
+		}
+	case GoalVolume, GoalBodyweight:
+	default:
+		return errors.New("type must be one of lift, frequency, volume or bodyweight")
+	}
+	if g.Type != GoalFrequency {
+		g.Period = ""
+	}
+	if g.TargetValue <= 0 {
+		return errors.New("target_value must be positive")
+	}
+	if g.Title == "" {
+		g.Title = g.defaultTitle()
+	}
+	startsAt := g.StartsAt
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+	if g.Deadline != nil && !g.Deadline.After(startsAt) {
+		return errors.New("deadline must be after starts_at")
+	}
+	return nil
+}
+
+func (g *Goal) defaultTitle() string {
+	switch g.Type {
+	case GoalLift:
+		return g.ExerciseName + " target"
+	case GoalFrequency:
+		return "Workouts per " + g.Period
+	case GoalVolume:
+		return "Training volume"
+	}
+	return "Bodyweight target"
+}
+
+// weightBased reports whether the target is a weight that follows the
+// requester's unit.
+func (g *Goal) weightBased() bool {
+	return g.Type != GoalFrequency
+}
+
+func (g *Goal) ConvertWeights(from, to units.WeightUnit) {
+	if g.weightBased() {
+		g.TargetValue = units.Convert(g.TargetValue, from, to)
+		g.StartValue = units.ConvertPtr(g.StartValue, from, to)
+		if g.Progress != nil {
+			g.Progress.Current = units.Convert(g.Progress.Current, from, to)
+		}
+	}
+	g.WeightUnit = to
+}
+
+// EvaluateGoal computes the progress of a goal from its samples, which must be
+// in chronological order.
+func EvaluateGoal(goal *Goal, samples []GoalSample, now time.Time) *GoalProgress {
+	switch goal.Type {
+	case GoalLift:
+		return evaluateLift(goal, samples, now)
+	case GoalFrequency:
+		return evaluateFrequency(goal, samples, now)
+	case GoalVolume:
+		return evaluateVolume(goal, samples, now)
+	case GoalBodyweight:
+		return evaluateBodyweight(goal, samples, now)
+	}
+	return &GoalProgress{}
+}
+
+func evaluateLift(goal *Goal, samples []GoalSample, now time.Time) *GoalProgress {
+	p := &GoalProgress{}
+	var recent []GoalSample
+	for _, s := range samples {
+		p.Current = math.Max(p.Current, s.Value)
+		if now.Sub(s.At) <= goalTrendWindow {
+			recent = append(recent, s)
+		}
+	}
+	p.Percent = percent(p.Current, goal.TargetValue)
+	p.Achieved = p.Current >= goal.TargetValue
+	if !p.Achieved {
+		p.ProjectedCompletion = project(recent, p.Current, goal.TargetValue, now)
+	}
+	p.setOnTrack(goal, now)
+	return p
+}
+
+func evaluateVolume(goal *Goal, samples []GoalSample, now time.Time) *GoalProgress {
+	p := &GoalProgress{}
+	for _, s := range samples {
+		if !s.At.Before(goal.StartsAt) && (goal.Deadline == nil || !s.At.After(*goal.Deadline)) {
+			p.Current += s.Value
+		}
+	}
+	p.Current = round2(p.Current)
+	p.Percent = percent(p.Current, goal.TargetValue)
+	p.Achieved = p.Current >= goal.TargetValue
+
+	// volume accumulates at the average daily rate since the goal started
+	elapsedDays := now.Sub(goal.StartsAt).Hours() / 24
+	if !p.Achieved && elapsedDays >= 1 && p.Current > 0 {
+		rate := p.Current / elapsedDays
+		p.ProjectedCompletion = projectAt(now, (goal.TargetValue-p.Current)/rate)
+	}
+	p.setOnTrack(goal, now)
+	return p
+}
+
+func evaluateFrequency(goal *Goal, samples []GoalSample, now time.Time) *GoalProgress {
+	start, end := goalPeriod(goal.Period, now)
+	p := &GoalProgress{PeriodStart: &start, PeriodEnd: &end}
+
+	var recent float64
+	for _, s := range samples {
+		if !s.At.Before(start) && s.At.Before(end) {
+			p.Current += s.Value
+		}
+		if now.Sub(s.At) <= frequencyWindow && !s.At.After(now) {
+			recent += s.Value
+		}
+	}
+	p.Percent = percent(p.Current, goal.TargetValue)
+	p.Achieved = p.Current >= goal.TargetValue
+
+	// the rest of the period is projected at the pace of the last four weeks
+	if !p.Achieved && recent > 0 {
+		perDay := recent / (frequencyWindow.Hours() / 24)
+		p.ProjectedCompletion = projectAt(now, (goal.TargetValue-p.Current)/perDay)
+	}
+	if p.ProjectedCompletion != nil || p.Achieved {
+		onTrack := p.Achieved || p.ProjectedCompletion.Before(end)
+		p.OnTrack = &onTrack
+	}
+	return p
+}
+
+func evaluateBodyweight(goal *Goal, samples []GoalSample, now time.Time) *GoalProgress {
+	p := &GoalProgress{}
+	if len(samples) == 0 {
+		return p
+	}
+	latest := samples[len(samples)-1]
+	p.Current = latest.Value
+
+	start := latest.Value
+	if goal.StartValue != nil {
+		start = *goal.StartValue
+	} else {
+		for _, s := range samples {
+			if !s.At.Before(goal.StartsAt) {
+				start = s.Value
+				break
+			}
+		}
+	}
+
+	// bodyweight goals can be a loss or a gain
+	total := goal.TargetValue - start
+	done := p.Current - start
+	switch {
+	case total == 0 || (total > 0 && p.Current >= goal.TargetValue) || (total < 0 && p.Current <= goal.TargetValue):
+		p.Achieved = true
+		p.Percent = 100
+	default:
+		p.Percent = math.Max(0, round2(done/total*100))
+	}
+
+	if !p.Achieved {
+		var recent []GoalSample
+		for _, s := range samples {
+			if now.Sub(s.At) <= goalTrendWindow {
+				recent = append(recent, s)
+			}
+		}
+		p.ProjectedCompletion = project(recent, p.Current, goal.TargetValue, now)
+	}
+	p.setOnTrack(goal, now)
+	return p
+}
+
+func (p *GoalProgress) setOnTrack(goal *Goal, now time.Time) {
+	if goal.Deadline == nil {
+		return
+	}
+	switch {
+	case p.Achieved:
+		onTrack := true
+		p.OnTrack = &onTrack
+	case p.ProjectedCompletion != nil:
+		onTrack := !p.ProjectedCompletion.After(*goal.Deadline)
+		p.OnTrack = &onTrack
+	case now.After(*goal.Deadline):
+		onTrack := false
+		p.OnTrack = &onTrack
+	}
+}
+
+// project fits a least squares line through the samples and returns when it
+// reaches the target, nil when the trend does not move towards it.
+func project(samples []GoalSample, current, target float64, now time.Time) *time.Time {
+	if len(samples) < 2 {
+		return nil
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(samples))
+	origin := samples[0].At
+	for _, s := range samples {
+		x := s.At.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += s.Value
+		sumXY += x * s.Value
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return nil
+	}
+	perDay := (n*sumXY - sumX*sumY) / denominator
+	if perDay == 0 {
+		return nil
+	}
+	return projectAt(now, (target-current)/perDay)
+}
+
+func projectAt(now time.Time, days float64) *time.Time {
+	if math.IsNaN(days) || math.IsInf(days, 0) || days < 0 {
+		return nil
+	}
+	d := time.Duration(days * 24 * float64(time.Hour))
+	if d > maxProjection {
+		return nil
+	}
+	at := now.Add(d).Truncate(time.Second)
+	return &at
+}
+
+// goalPeriod returns the calendar week (starting Monday) or month containing now.
+func goalPeriod(period string, now time.Time) (time.Time, time.Time) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if period == GoalPeriodMonth {
+		start := day.AddDate(0, 0, 1-day.Day())
+		return start, start.AddDate(0, 1, 0)
+	}
+	offset := (int(day.Weekday()) + 6) % 7
+	start := day.AddDate(0, 0, -offset)
+	return start, start.AddDate(0, 0, 7)
+}
+
+func percent(current, target float64) float64 {
+	if target <= 0 {
+		return 0
+	}
+	return math.Min(100, round2(current/target*100))
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoalValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		goal    Goal
+		wantErr bool
+	}{
+		{name: "lift", goal: Goal{Type: GoalLift, ExerciseName: "Bench Press", TargetValue: 100}},
+		{name: "lift without exercise", goal: Goal{Type: GoalLift, TargetValue: 100}, wantErr: true},
+		{name: "frequency defaults to weekly", goal: Goal{Type: GoalFrequency, TargetValue: 3}},
+		{name: "fractional frequency", goal: Goal{Type: GoalFrequency, TargetValue: 2.5}, wantErr: true},
+		{name: "unknown period", goal: Goal{Type: GoalFrequency, TargetValue: 3, Period: "day"}, wantErr: true},
+		{name: "unknown type", goal: Goal{Type: "distance", TargetValue: 5}, wantErr: true},
+		{name: "zero target", goal: Goal{Type: GoalVolume}, wantErr: true},
+		{
+			name:    "deadline before start",
+			goal:    Goal{Type: GoalBodyweight, TargetValue: 75, StartsAt: time.Now(), Deadline: timePtr(time.Now().Add(-time.Hour))},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.goal.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, tt.goal.Title)
+		})
+	}
+}
+
+func TestEvaluateGoal(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+	deadline := now.AddDate(0, 1, 0)
+
+	t.Run("lift projects the recent trend", func(t *testing.T) {
+		goal := &Goal{Type: GoalLift, TargetValue: 100, Deadline: &deadline}
+		samples := []GoalSample{{daysAgo(28), 80}, {daysAgo(14), 85}, {daysAgo(0), 90}}
+
+		p := EvaluateGoal(goal, samples, now)
+		assert.Equal(t, 90.0, p.Current)
+		assert.Equal(t, 90.0, p.Percent)
+		assert.False(t, p.Achieved)
+		// +5 kg every two weeks, 10 kg to go
+		require.NotNil(t, p.ProjectedCompletion)
+		assert.Equal(t, now.AddDate(0, 0, 28), *p.ProjectedCompletion)
+		require.NotNil(t, p.OnTrack)
+		assert.True(t, *p.OnTrack)
+	})
+
+	t.Run("lift achieved", func(t *testing.T) {
+		goal := &Goal{Type: GoalLift, TargetValue: 100}
+		p := EvaluateGoal(goal, []GoalSample{{daysAgo(3), 102.5}}, now)
+		assert.True(t, p.Achieved)
+		assert.Equal(t, 100.0, p.Percent)
+		assert.Nil(t, p.ProjectedCompletion)
+	})
+
+	t.Run("frequency counts the current week", func(t *testing.T) {
+		goal := &Goal{Type: GoalFrequency, Period: GoalPeriodWeek, TargetValue: 3}
+		// Sunday belongs to the previous week
+		samples := []GoalSample{{daysAgo(10), 1}, {daysAgo(7), 1}, {daysAgo(3), 1}, {daysAgo(2), 1}, {daysAgo(1), 1}}
+
+		p := EvaluateGoal(goal, samples, now)
+		assert.Equal(t, 2.0, p.Current)
+		assert.InDelta(t, 66.67, p.Percent, 0.01)
+		assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), *p.PeriodStart)
+		assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), *p.PeriodEnd)
+		// five workouts in four weeks: the next one is due in 5.6 days
+		require.NotNil(t, p.ProjectedCompletion)
+		require.NotNil(t, p.OnTrack)
+		assert.False(t, *p.OnTrack)
+	})
+
+	t.Run("volume since start", func(t *testing.T) {
+		goal := &Goal{Type: GoalVolume, TargetValue: 10000, StartsAt: daysAgo(10)}
+		samples := []GoalSample{{daysAgo(12), 5000}, {daysAgo(8), 2000}, {daysAgo(4), 3000}}
+
+		p := EvaluateGoal(goal, samples, now)
+		assert.Equal(t, 5000.0, p.Current)
+		assert.Equal(t, 50.0, p.Percent)
+		// 500 kg a day, 5000 kg to go
+		assert.Equal(t, now.AddDate(0, 0, 10), *p.ProjectedCompletion)
+	})
+
+	t.Run("bodyweight loss", func(t *testing.T) {
+		goal := &Goal{Type: GoalBodyweight, TargetValue: 80, StartValue: FloatPtr(90)}
+		samples := []GoalSample{{daysAgo(14), 88}, {daysAgo(7), 87}, {daysAgo(0), 86}}
+
+		p := EvaluateGoal(goal, samples, now)
+		assert.Equal(t, 86.0, p.Current)
+		assert.Equal(t, 40.0, p.Percent)
+		// -1 kg a week, 6 kg to go
+		assert.Equal(t, now.AddDate(0, 0, 42), *p.ProjectedCompletion)
+	})
+
+	t.Run("bodyweight moving away from the target", func(t *testing.T) {
+		goal := &Goal{Type: GoalBodyweight, TargetValue: 80, StartValue: FloatPtr(90)}
+		samples := []GoalSample{{daysAgo(14), 90}, {daysAgo(0), 92}}
+
+		p := EvaluateGoal(goal, samples, now)
+		assert.Equal(t, 0.0, p.Percent)
+		assert.Nil(t, p.ProjectedCompletion)
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
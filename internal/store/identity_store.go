@@ -0,0 +1,271 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+var (
+	// ErrEmailTaken is returned when an external identity would create an
+	// account for an email that already has one. Linking it requires signing
+	// in to that account first so that nobody can take it over through a
+	// provider.
+	ErrEmailTaken = errors.New("an account with this email already exists")
+	// ErrIdentityLinked is returned when the identity belongs to another user
+	// or the user already linked another identity of the provider.
+	ErrIdentityLinked = errors.New("identity is already linked")
+)
+
+// Identity is an account of an external OpenID provider linked to a user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserId    int       `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginState is kept between sending the user to the provider and its
+// callback. UserId is set when a signed in user links an identity.
+type LoginState struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+	UserId       int
+}
+
+type PostgresIdentityStore struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityStore(db *sql.DB) *PostgresIdentityStore {
+	return &PostgresIdentityStore{db: db}
+}
+
+type IdentityStore interface {
+	CreateLoginState(state *LoginState, ttl time.Duration) error
+	ConsumeLoginState(provider, plaintextState string) (*LoginState, error)
+	GetIdentityUser(provider, subject string) (*User, error)
+	LinkIdentity(identity *Identity) error
+	CreateUserWithIdentity(user *User, identity *Identity, emailVerified bool) (*User, error)
+	GetIdentities(userId int) ([]Identity, error)
+}
+
+// CreateLoginState stores the state hashed like other tokens; nonce and
+// verifier are needed in plaintext to finish the flow.
+func (pg *PostgresIdentityStore) CreateLoginState(state *LoginState, ttl time.Duration) error {
+	query := `
+	INSERT INTO oidc_login_states (state_hash,provider,nonce,code_verifier,user_id,expiry)
+	VALUES ($1,$2,$3,$4,NULLIF($5,0),$6)`
+	_, err := pg.db.Exec(query, tokens.Hash(state.State), state.Provider, state.Nonce, state.CodeVerifier,
+		state.UserId, time.Now().Add(ttl))
+	if err != nil {
+		return err
+	}
+	// expired states of abandoned sign ins are dropped along the way
+	_, err = pg.db.Exec(`DELETE FROM oidc_login_states WHERE expiry < $1`, time.Now())
+	return err
+}
+
+// ConsumeLoginState returns and deletes the state so that every callback can
+// only be completed once.
+func (pg *PostgresIdentityStore) ConsumeLoginState(provider, plaintextState string) (*LoginState, error) {
+	state := &LoginState{Provider: provider, State: plaintextState}
+	query := `
+	DELETE FROM oidc_login_states WHERE state_hash=$1 AND provider=$2 AND expiry > $3
+	RETURNING nonce,code_verifier,COALESCE(user_id,0)`
+	err := pg.db.QueryRow(query, tokens.Hash(plaintextState), provider, time.Now()).Scan(
+		&state.Nonce, &state.CodeVerifier, &state.UserId)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetIdentityUser returns nil when the identity is not linked to a user yet.
+func (pg *PostgresIdentityStore) GetIdentityUser(provider, subject string) (*User, error) {
+	query := `
+	SELECT ` + userColumns + `
+	FROM users u
+	JOIN user_identities i ON i.user_id=u.id
+	WHERE i.provider=$1 AND i.subject=$2 AND ` + activeUser
+	user, err := scanUser(pg.db.QueryRow(query, provider, subject))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkIdentity links the identity to identity.UserId. Linking it again to
+// the same user is a no-op.
+func (pg *PostgresIdentityStore) LinkIdentity(identity *Identity) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertIdentity(tx, identity)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertIdentity(tx *sql.Tx, identity *Identity) error {
+	query := `
+	INSERT INTO user_identities (provider,subject,user_id,email) VALUES ($1,$2,$3,NULLIF($4,''))
+	ON CONFLICT DO NOTHING`
+	_, err := tx.Exec(query, identity.Provider, identity.Subject, identity.UserId, identity.Email)
+	if err != nil {
+		return err
+	}
+
+	var userId int
+	query = `SELECT user_id,createdAT FROM user_identities WHERE provider=$1 AND subject=$2`
+	err = tx.QueryRow(query, identity.Provider, identity.Subject).Scan(&userId, &identity.CreatedAt)
+	if err == sql.ErrNoRows {
+		// the user has another identity of this provider
+		return ErrIdentityLinked
+	}
+	if err != nil {
+		return err
+	}
+	if userId != identity.UserId {
+		return ErrIdentityLinked
+	}
+	return nil
+}
+
+// CreateUserWithIdentity signs up a user on their first sign in with a
+// provider. The username is made unique by appending digits; the email
+// counts as verified when the provider says so.
+func (pg *PostgresIdentityStore) CreateUserWithIdentity(user *User, identity *Identity, emailVerified bool) (*User, error) {
+	if len(user.PasswordHash.hash) == 0 {
+		return nil, ErrPasswordNotSet
+	}
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email)=LOWER($1))`, user.Email).Scan(&taken)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailTaken
+	}
+
+	base := SanitizeUsername(user.Username)
+	user.Username = base
+	for attempt := 0; ; attempt++ {
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE username=$1)`, user.Username).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+		if !taken {
+			break
+		}
+		if attempt == 10 {
+			return nil, fmt.Errorf("no free username for %q", base)
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return nil, err
+		}
+		user.Username = fmt.Sprintf("%s%04d", base, suffix.Int64())
+	}
+
+	if user.PreferredUnit == "" {
+		user.PreferredUnit = units.Kilograms
+	}
+	if user.ProfileVisibility == "" {
+		user.ProfileVisibility = VisibilityPublic
+	}
+	query := `
+	INSERT INTO users (username,email,password_hash,bio,preferred_unit,profile_visibility,email_verified_at)
+	VALUES ($1,$2,$3,$4,$5,$6,CASE WHEN $7 THEN CURRENT_TIMESTAMP END)
+	RETURNING id,email_verified_at,createdAT,updatedAt`
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.PreferredUnit,
+		user.ProfileVisibility, emailVerified).Scan(&user.Id, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.UserId = user.Id
+	err = insertIdentity(tx, identity)
+	if err != nil {
+		return nil, err
+	}
+	err = insertOutboxEvent(tx, userEvent(EventUserCreated, user))
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+func (pg *PostgresIdentityStore) GetIdentities(userId int) ([]Identity, error) {
+	query := `
+	SELECT provider,subject,user_id,COALESCE(email,''),createdAT
+	FROM user_identities WHERE user_id=$1 ORDER BY createdAT`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var i Identity
+		err := rows.Scan(&i.Provider, &i.Subject, &i.UserId, &i.Email, &i.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+// SanitizeUsername turns a provider's username or email into one of at most
+// 40 lowercase letters, digits and underscores, leaving room for a suffix.
+func SanitizeUsername(name string) string {
+	if at := strings.Index(name, "@"); at >= 0 {
+		// drop the domain and sub-addresses like +gym
+		name, _, _ = strings.Cut(name[:at], "+")
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		case r == '.', r == '-', r == ' ':
+			b.WriteRune('_')
+		}
+		if b.Len() == 40 {
+			break
+		}
+	}
+	username := strings.Trim(b.String(), "_")
+	if len(username) < 3 {
+		username = "athlete" + username
+	}
+	return username
+}
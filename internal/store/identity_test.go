@@ -0,0 +1,30 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "username", in: "JaneDoe", want: "janedoe"},
+		{name: "email", in: "jane.doe+gym@example.com", want: "jane_doe"},
+		{name: "display name", in: "Jane  Doe-Smith", want: "jane__doe_smith"},
+		{name: "non latin", in: "Zoë Li", want: "zo_li"},
+		{name: "too short", in: "li", want: "athleteli"},
+		{name: "empty", in: "", want: "athlete"},
+		{name: "too long", in: strings.Repeat("a", 60), want: strings.Repeat("a", 40)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeUsername(tt.in))
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+// Measurement metrics, named after their JSON fields.
+const (
+	MetricBodyweight     = "bodyweight"
+	MetricBodyFatPercent = "body_fat_percent"
+	MetricNeck           = "neck_cm"
+	MetricChest          = "chest_cm"
+	MetricWaist          = "waist_cm"
+	MetricHips           = "hips_cm"
+	MetricArm            = "arm_cm"
+	MetricThigh          = "thigh_cm"
+	MetricCalf           = "calf_cm"
+)
+
+// Measurement is one entry of a user's body metrics time series. Bodyweight
+// is stored in kilograms, circumferences in centimeters.
+type Measurement struct {
+	Id             int              `json:"id"`
+	UserId         int              `json:"user_id"`
+	MeasuredAt     time.Time        `json:"measured_at"`
+	Bodyweight     *float64         `json:"bodyweight"`
+	BodyFatPercent *float64         `json:"body_fat_percent"`
+	NeckCm         *float64         `json:"neck_cm"`
+	ChestCm        *float64         `json:"chest_cm"`
+	WaistCm        *float64         `json:"waist_cm"`
+	HipsCm         *float64         `json:"hips_cm"`
+	ArmCm          *float64         `json:"arm_cm"`
+	ThighCm        *float64         `json:"thigh_cm"`
+	CalfCm         *float64         `json:"calf_cm"`
+	Notes          string           `json:"notes"`
+	WeightUnit     units.WeightUnit `json:"weight_unit"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// Metric returns the value of a metric, nil when it was not measured or the
+// metric is unknown.
+func (m *Measurement) Metric(name string) *float64 {
+	switch name {
+	case MetricBodyweight:
+		return m.Bodyweight
+	case MetricBodyFatPercent:
+		return m.BodyFatPercent
+	case MetricNeck:
+		return m.NeckCm
+	case MetricChest:
+		return m.ChestCm
+	case MetricWaist:
+		return m.WaistCm
+	case MetricHips:
+		return m.HipsCm
+	case MetricArm:
+		return m.ArmCm
+	case MetricThigh:
+		return m.ThighCm
+	case MetricCalf:
+		return m.CalfCm
+	}
+	return nil
+}
+
+func IsMeasurementMetric(name string) bool {
+	switch name {
+	case MetricBodyweight, MetricBodyFatPercent, MetricNeck, MetricChest, MetricWaist,
+		MetricHips, MetricArm, MetricThigh, MetricCalf:
+		return true
+	}
+	return false
+}
+
+func (m *Measurement) circumferences() map[string]*float64 {
+	return map[string]*float64{
+		MetricNeck: m.NeckCm, MetricChest: m.ChestCm, MetricWaist: m.WaistCm, MetricHips: m.HipsCm,
+		MetricArm: m.ArmCm, MetricThigh: m.ThighCm, MetricCalf: m.CalfCm,
+	}
+}
+
+func (m *Measurement) Validate() error {
+	empty := m.Bodyweight == nil && m.BodyFatPercent == nil
+	if m.Bodyweight != nil && (*m.Bodyweight <= 0 || *m.Bodyweight > 1000) {
+		return errors.New("bodyweight must be between 0 and 1000 kg")
+	}
+	if m.BodyFatPercent != nil && (*m.BodyFatPercent <= 0 || *m.BodyFatPercent >= 100) {
+		return errors.New("body_fat_percent must be between 0 and 100")
+	}
+	for name, v := range m.circumferences() {
+		if v == nil {
+			continue
+		}
+		empty = false
+		if *v <= 0 || *v > 1000 {
+			return fmt.Errorf("%s must be between 0 and 1000", name)
+		}
+	}
+	if empty {
+		return errors.New("a measurement needs at least one value")
+	}
+	return nil
+}
+
+func (m *Measurement) ConvertWeights(from, to units.WeightUnit) {
+	m.Bodyweight = units.ConvertPtr(m.Bodyweight, from, to)
+	m.WeightUnit = to
+}
+
+type PostgresMeasurementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMeasurementStore(db *sql.DB) *PostgresMeasurementStore {
+	return &PostgresMeasurementStore{db: db}
+}
+
+type MeasurementStore interface {
+	CreateMeasurement(*Measurement) (*Measurement, error)
+	GetMeasurementById(id int64) (*Measurement, error)
+	GetMeasurements(userId int, from, to *time.Time) ([]Measurement, error)
+	UpdateMeasurement(*Measurement) error
+	DeleteMeasurement(id int64, userId int) error
+}
+
+const measurementColumns = `id,user_id,measured_at,bodyweight,body_fat_percent,neck_cm,chest_cm,waist_cm,hips_cm,arm_cm,thigh_cm,calf_cm,
+	COALESCE(notes,''),createdAT,updatedAt`
+
+func scanMeasurement(row interface{ Scan(...interface{}) error }) (*Measurement, error) {
+	m := &Measurement{WeightUnit: units.Canonical}
+	err := row.Scan(&m.Id, &m.UserId, &m.MeasuredAt, &m.Bodyweight, &m.BodyFatPercent, &m.NeckCm, &m.ChestCm, &m.WaistCm,
+		&m.HipsCm, &m.ArmCm, &m.ThighCm, &m.CalfCm, &m.Notes, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (pg *PostgresMeasurementStore) CreateMeasurement(m *Measurement) (*Measurement, error) {
+	if m.MeasuredAt.IsZero() {
+		m.MeasuredAt = time.Now().UTC()
+	}
+	query := `
+	INSERT INTO body_measurements (user_id,measured_at,bodyweight,body_fat_percent,neck_cm,chest_cm,waist_cm,hips_cm,arm_cm,thigh_cm,calf_cm,notes)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+	RETURNING ` + measurementColumns
+	return scanMeasurement(pg.db.QueryRow(query, m.UserId, m.MeasuredAt, m.Bodyweight, m.BodyFatPercent, m.NeckCm, m.ChestCm,
+		m.WaistCm, m.HipsCm, m.ArmCm, m.ThighCm, m.CalfCm, m.Notes))
+}
+
+func (pg *PostgresMeasurementStore) GetMeasurementById(id int64) (*Measurement, error) {
+	query := `SELECT ` + measurementColumns + ` FROM body_measurements WHERE id=$1`
+	return scanMeasurement(pg.db.QueryRow(query, id))
+}
+
+// GetMeasurements returns the measurements of a user in chronological order,
+// optionally bounded by from and to.
+func (pg *PostgresMeasurementStore) GetMeasurements(userId int, from, to *time.Time) ([]Measurement, error) {
+	query := `
+	SELECT ` + measurementColumns + `
+	FROM body_measurements
+	WHERE user_id=$1 AND ($2::timestamptz IS NULL OR measured_at >= $2) AND ($3::timestamptz IS NULL OR measured_at <= $3)
+	ORDER BY measured_at, id`
+	rows, err := pg.db.Query(query, userId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := []Measurement{}
+	for rows.Next() {
+		m, err := scanMeasurement(rows)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, *m)
+	}
+	return measurements, rows.Err()
+}
+
+func (pg *PostgresMeasurementStore) UpdateMeasurement(m *Measurement) error {
+	query := `
+	UPDATE body_measurements
+	SET measured_at=$1,bodyweight=$2,body_fat_percent=$3,neck_cm=$4,chest_cm=$5,waist_cm=$6,hips_cm=$7,arm_cm=$8,thigh_cm=$9,calf_cm=$10,
+		notes=$11,updatedAt=CURRENT_TIMESTAMP
+	WHERE id=$12 AND user_id=$13
+	RETURNING updatedAt`
+	return pg.db.QueryRow(query, m.MeasuredAt, m.Bodyweight, m.BodyFatPercent, m.NeckCm, m.ChestCm, m.WaistCm, m.HipsCm, m.ArmCm,
+		m.ThighCm, m.CalfCm, m.Notes, m.Id, m.UserId).Scan(&m.UpdatedAt)
+}
+
+func (pg *PostgresMeasurementStore) DeleteMeasurement(id int64, userId int) error {
+	result, err := pg.db.Exec(`DELETE FROM body_measurements WHERE id=$1 AND user_id=$2`, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// latestBodyweight returns the most recently measured bodyweight of a user in
+// kilograms, nil when none was recorded.
+func latestBodyweight(q querier, userId int) (*float64, error) {
+	if userId == 0 {
+		return nil, nil
+	}
+	var bodyweight float64
+	query := `
+	SELECT bodyweight FROM body_measurements
+	WHERE user_id=$1 AND bodyweight IS NOT NULL
+	ORDER BY measured_at DESC, id DESC LIMIT 1`
+	err := q.QueryRow(query, userId).Scan(&bodyweight)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bodyweight, nil
+}
+
+// estimationBodyweight is the bodyweight calorie estimates use for a user.
+func estimationBodyweight(q querier, userId int) (float64, error) {
+	bodyweight, err := latestBodyweight(q, userId)
+	if err != nil || bodyweight == nil {
+		return DefaultBodyweightKg, err
+	}
+	return *bodyweight, nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasurementValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement Measurement
+		wantErr     bool
+	}{
+		{name: "bodyweight only", measurement: Measurement{Bodyweight: FloatPtr(80)}},
+		{name: "circumference only", measurement: Measurement{WaistCm: FloatPtr(84.5)}},
+		{name: "empty", measurement: Measurement{Notes: "nothing measured"}, wantErr: true},
+		{name: "negative bodyweight", measurement: Measurement{Bodyweight: FloatPtr(-1)}, wantErr: true},
+		{name: "body fat over 100", measurement: Measurement{BodyFatPercent: FloatPtr(120)}, wantErr: true},
+		{name: "zero circumference", measurement: Measurement{Bodyweight: FloatPtr(80), ArmCm: FloatPtr(0)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.measurement.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMovingAverages(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2024, 1, 1+n, 8, 0, 0, 0, time.UTC) }
+	measurements := []Measurement{
+		{MeasuredAt: day(0), Bodyweight: FloatPtr(80)},
+		{MeasuredAt: day(1), Bodyweight: FloatPtr(82)},
+		{MeasuredAt: day(2), WaistCm: FloatPtr(85)},
+		{MeasuredAt: day(3), Bodyweight: FloatPtr(81)},
+		{MeasuredAt: day(7), Bodyweight: FloatPtr(79)},
+	}
+
+	points := MovingAverages(measurements, MetricBodyweight, 3*24*time.Hour)
+	require.Len(t, points, 4)
+	assert.Equal(t, 80.0, points[0].MovingAverage)
+	assert.Equal(t, 81.0, points[1].MovingAverage)
+	// day 0 is exactly three days old and falls out of the window
+	assert.Equal(t, 81.5, points[2].MovingAverage)
+	assert.Equal(t, 79.0, points[3].MovingAverage)
+
+	trend := ComputeTrend(MetricBodyweight, points)
+	assert.Equal(t, 4, trend.Count)
+	assert.Equal(t, 79.0, *trend.Latest)
+	assert.Equal(t, 79.0, *trend.Min)
+	assert.Equal(t, 82.0, *trend.Max)
+	assert.Equal(t, -1.0, *trend.Change)
+	require.NotNil(t, trend.ChangePerWeek)
+	assert.Less(t, *trend.ChangePerWeek, 0.0)
+
+	empty := ComputeTrend(MetricWaist, nil)
+	assert.Equal(t, 0, empty.Count)
+	assert.Nil(t, empty.Change)
+}
+
+func TestApplyBodyweight(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      WorkoutEntry
+		bodyweight *float64
+		want       *float64
+	}{
+		{
+			name:       "weighted pull up",
+			entry:      WorkoutEntry{ExerciseName: "Pull-Ups", Reps: IntPtr(5), Weight: FloatPtr(20)},
+			bodyweight: FloatPtr(80),
+			want:       FloatPtr(1.25),
+		},
+		{
+			name:       "push up",
+			entry:      WorkoutEntry{ExerciseName: "push up", Reps: IntPtr(20)},
+			bodyweight: FloatPtr(80),
+			want:       FloatPtr(0.64),
+		},
+		{
+			name:       "not a bodyweight exercise",
+			entry:      WorkoutEntry{ExerciseName: "Bench Press", Reps: IntPtr(5), Weight: FloatPtr(100)},
+			bodyweight: FloatPtr(80),
+		},
+		{
+			name:  "no bodyweight recorded",
+			entry: WorkoutEntry{ExerciseName: "Dips", Reps: IntPtr(10)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.applyBodyweight(tt.bodyweight)
+			assert.Equal(t, tt.want, tt.entry.RelativeStrength)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"math"
+	"time"
+)
+
+type TrendPoint struct {
+	MeasuredAt    time.Time `json:"measured_at"`
+	Value         float64   `json:"value"`
+	MovingAverage float64   `json:"moving_average"`
+}
+
+type Trend struct {
+	Metric string     `json:"metric"`
+	Count  int        `json:"count"`
+	From   *time.Time `json:"from"`
+	To     *time.Time `json:"to"`
+	Latest *float64   `json:"latest"`
+	Min    *float64   `json:"min"`
+	Max    *float64   `json:"max"`
+	// Change is the difference between the last and first moving average,
+	// which keeps day to day fluctuations out of it.
+	Change *float64 `json:"change"`
+	// ChangePerWeek is the least squares slope of the raw values.
+	ChangePerWeek *float64 `json:"change_per_week"`
+}
+
+// MovingAverages returns the series of a metric with the trailing moving
+// average over window at every point. Measurements must be in chronological
+// order; measurements without the metric are skipped.
+func MovingAverages(measurements []Measurement, metric string, window time.Duration) []TrendPoint {
+	points := []TrendPoint{}
+	for i := range measurements {
+		if v := measurements[i].Metric(metric); v != nil {
+			points = append(points, TrendPoint{MeasuredAt: measurements[i].MeasuredAt, Value: *v})
+		}
+	}
+
+	start, sum := 0, 0.0
+	for i := range points {
+		sum += points[i].Value
+		cutoff := points[i].MeasuredAt.Add(-window)
+		for start < i && !points[start].MeasuredAt.After(cutoff) {
+			sum -= points[start].Value
+			start++
+		}
+		points[i].MovingAverage = round2(sum / float64(i-start+1))
+	}
+	return points
+}
+
+// ComputeTrend summarizes a moving average series.
+func ComputeTrend(metric string, points []TrendPoint) *Trend {
+	trend := &Trend{Metric: metric, Count: len(points)}
+	if len(points) == 0 {
+		return trend
+	}
+	first, last := points[0], points[len(points)-1]
+	trend.From, trend.To = &first.MeasuredAt, &last.MeasuredAt
+	latest := last.Value
+	trend.Latest = &latest
+
+	lowest, highest := first.Value, first.Value
+	for _, p := range points {
+		lowest = math.Min(lowest, p.Value)
+		highest = math.Max(highest, p.Value)
+	}
+	trend.Min, trend.Max = &lowest, &highest
+
+	if len(points) < 2 {
+		return trend
+	}
+	change := round2(last.MovingAverage - first.MovingAverage)
+	trend.Change = &change
+
+	// least squares fit of value over days since the first point
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(points))
+	for _, p := range points {
+		x := p.MeasuredAt.Sub(first.MeasuredAt).Hours() / 24
+		sumX += x
+		sumY += p.Value
+		sumXY += x * p.Value
+		sumXX += x * x
+	}
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		perWeek := round2((n*sumXY - sumX*sumY) / denominator * 7)
+		trend.ChangePerWeek = &perWeek
+	}
+	return trend
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
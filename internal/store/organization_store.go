@@ -0,0 +1,336 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+)
+
+type Role string
+
+const (
+	RoleOwner   Role = "owner"
+	RoleCoach   Role = "coach"
+	RoleAthlete Role = "athlete"
+)
+
+func ParseRole(value string) (Role, error) {
+	switch role := Role(value); role {
+	case RoleOwner, RoleCoach, RoleAthlete:
+		return role, nil
+	}
+	return "", errors.New("role must be one of owner, coach or athlete")
+}
+
+var (
+	ErrInvitationInvalid = errors.New("invitation is invalid, expired or already accepted")
+	ErrInvitationEmail   = errors.New("invitation was sent to a different email address")
+	ErrLastOwner         = errors.New("an organization needs at least one owner")
+)
+
+type Organization struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Role is the role of the user the organization was read for
+	Role      Role      `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Member struct {
+	UserId   int       `json:"user_id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type Invitation struct {
+	Id             int        `json:"id"`
+	OrganizationId int        `json:"organization_id"`
+	Email          string     `json:"email"`
+	Role           Role       `json:"role"`
+	InvitedBy      int        `json:"invited_by"`
+	Token          string     `json:"token,omitempty"`
+	Expiry         time.Time  `json:"expiry"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+}
+
+// RolePair holds the roles of two users in an organization they share.
+type RolePair struct {
+	Actor   Role
+	Subject Role
+}
+
+type PostgresOrganizationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOrganizationStore(db *sql.DB) *PostgresOrganizationStore {
+	return &PostgresOrganizationStore{db: db}
+}
+
+type OrganizationStore interface {
+	CreateOrganization(org *Organization, ownerId int) (*Organization, error)
+	GetOrganizationsForUser(userId int) ([]Organization, error)
+	GetMemberRole(orgId int64, userId int) (Role, error)
+	GetMembers(orgId int64, role Role) ([]Member, error)
+	RemoveMember(orgId int64, userId int) error
+	CreateInvitation(invitation *Invitation, ttl time.Duration) (*Invitation, error)
+	AcceptInvitation(plaintextToken string, user *User) (*Organization, error)
+	GetRoles(actorId, subjectId int) ([]RolePair, error)
+	GetRecentWorkouts(userId int, limit int) ([]FeedItem, error)
+}
+
+// CreateOrganization stores the organization with ownerId as its owner.
+func (pg *PostgresOrganizationStore) CreateOrganization(org *Organization, ownerId int) (*Organization, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO organizations (name) VALUES ($1) RETURNING id,createdAT,updatedAt`
+	err = tx.QueryRow(query, org.Name).Scan(&org.Id, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO organization_members (organization_id,user_id,role) VALUES ($1,$2,$3)`, org.Id, ownerId, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	org.Role = RoleOwner
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (pg *PostgresOrganizationStore) GetOrganizationsForUser(userId int) ([]Organization, error) {
+	query := `
+	SELECT o.id,o.name,m.role,o.createdAT,o.updatedAt
+	FROM organizations o
+	JOIN organization_members m ON m.organization_id=o.id
+	WHERE m.user_id=$1 ORDER BY o.id`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		var org Organization
+		err := rows.Scan(&org.Id, &org.Name, &org.Role, &org.CreatedAt, &org.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetMemberRole returns sql.ErrNoRows when userId is not a member.
+func (pg *PostgresOrganizationStore) GetMemberRole(orgId int64, userId int) (Role, error) {
+	var role Role
+	query := `SELECT role FROM organization_members WHERE organization_id=$1 AND user_id=$2`
+	err := pg.db.QueryRow(query, orgId, userId).Scan(&role)
+	return role, err
+}
+
+// GetMembers lists the members of an organization, only those with role
+// unless it is empty.
+func (pg *PostgresOrganizationStore) GetMembers(orgId int64, role Role) ([]Member, error) {
+	query := `
+	SELECT u.id,u.username,u.email,m.role,m.createdAT
+	FROM organization_members m
+	JOIN users u ON u.id=m.user_id
+	WHERE m.organization_id=$1 AND ($2='' OR m.role=$2) AND ` + activeUser + `
+	ORDER BY u.username`
+	rows, err := pg.db.Query(query, orgId, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var m Member
+		err := rows.Scan(&m.UserId, &m.Username, &m.Email, &m.Role, &m.JoinedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// RemoveMember removes userId from the organization. The last owner can not
+// be removed.
+func (pg *PostgresOrganizationStore) RemoveMember(orgId int64, userId int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the owners so two owners can not remove each other concurrently
+	var owners int
+	var removingOwner bool
+	query := `
+	SELECT COUNT(*),COALESCE(BOOL_OR(user_id=$2),false) FROM (
+		SELECT user_id FROM organization_members WHERE organization_id=$1 AND role='owner' FOR UPDATE
+	) o`
+	err = tx.QueryRow(query, orgId, userId).Scan(&owners, &removingOwner)
+	if err != nil {
+		return err
+	}
+	if removingOwner && owners == 1 {
+		return ErrLastOwner
+	}
+
+	result, err := tx.Exec(`DELETE FROM organization_members WHERE organization_id=$1 AND user_id=$2`, orgId, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// CreateInvitation stores an invitation and returns it with the plaintext
+// token, which is only available at this point.
+func (pg *PostgresOrganizationStore) CreateInvitation(invitation *Invitation, ttl time.Duration) (*Invitation, error) {
+	token, err := tokens.GenerateToken(invitation.InvitedBy, ttl, tokens.ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+	invitation.Email = strings.ToLower(strings.TrimSpace(invitation.Email))
+	invitation.Token = token.Plaintext
+	invitation.Expiry = token.Expiry
+
+	query := `
+	INSERT INTO organization_invitations (organization_id,email,role,token_hash,invited_by,expiry)
+	VALUES ($1,$2,$3,$4,$5,$6)
+	RETURNING id`
+	err = pg.db.QueryRow(query, invitation.OrganizationId, invitation.Email, invitation.Role, token.Hash,
+		invitation.InvitedBy, invitation.Expiry).Scan(&invitation.Id)
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation adds user to the organization of the invitation. The
+// invitation can only be used once and only by the invited email address.
+// Users who already are members keep their role.
+func (pg *PostgresOrganizationStore) AcceptInvitation(plaintextToken string, user *User) (*Organization, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var invitationId int
+	var email string
+	var role Role
+	org := &Organization{}
+	query := `
+	SELECT i.id,i.email,i.role,o.id,o.name,o.createdAT,o.updatedAt
+	FROM organization_invitations i
+	JOIN organizations o ON o.id=i.organization_id
+	WHERE i.token_hash=$1 AND i.accepted_at IS NULL AND i.expiry > $2
+	FOR UPDATE OF i`
+	err = tx.QueryRow(query, tokens.Hash(plaintextToken), time.Now()).Scan(&invitationId, &email, &role,
+		&org.Id, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(email, user.Email) {
+		return nil, ErrInvitationEmail
+	}
+
+	query = `
+	INSERT INTO organization_members (organization_id,user_id,role) VALUES ($1,$2,$3)
+	ON CONFLICT (organization_id,user_id) DO UPDATE SET role=organization_members.role
+	RETURNING role`
+	err = tx.QueryRow(query, org.Id, user.Id, role).Scan(&org.Role)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`UPDATE organization_invitations SET accepted_at=CURRENT_TIMESTAMP WHERE id=$1`, invitationId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// GetRoles returns the roles actorId and subjectId hold in every
+// organization they are both members of.
+func (pg *PostgresOrganizationStore) GetRoles(actorId, subjectId int) ([]RolePair, error) {
+	query := `
+	SELECT a.role,s.role
+	FROM organization_members a
+	JOIN organization_members s ON s.organization_id=a.organization_id
+	WHERE a.user_id=$1 AND s.user_id=$2`
+	rows, err := pg.db.Query(query, actorId, subjectId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []RolePair
+	for rows.Next() {
+		var pair RolePair
+		if err := rows.Scan(&pair.Actor, &pair.Subject); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
+
+// GetRecentWorkouts summarizes the latest completed workouts of userId
+// regardless of their visibility.
+func (pg *PostgresOrganizationStore) GetRecentWorkouts(userId int, limit int) ([]FeedItem, error) {
+	query := `
+	SELECT ` + workoutSummaryColumns + `
+	FROM workouts w
+	JOIN users u ON u.id=w.user_id
+	WHERE w.user_id=$1 AND ` + activeUser + ` AND ` + completedWorkout + `
+	ORDER BY w.createdAT DESC,w.id DESC
+	LIMIT $2`
+	rows, err := pg.db.Query(query, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []FeedItem{}
+	for rows.Next() {
+		item, err := scanFeedItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outboxRelayLockKey is the advisory lock held by the relay that is currently
+// publishing, so that events for one aggregate are never published out of
+// order by two instances at once.
+const outboxRelayLockKey = 270270
+
+type OutboxEvent struct {
+	Id            int64
+	AggregateType string
+	AggregateId   int
+	EventType     string
+	UserId        int
+	Payload       json.RawMessage
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	// PublishedSinks are the sinks that already accepted the event; retries
+	// skip them
+	PublishedSinks []string
+}
+
+func (e *OutboxEvent) Event() Event {
+	return Event{
+		Id:            strconv.FormatInt(e.Id, 10),
+		Type:          e.EventType,
+		AggregateType: e.AggregateType,
+		AggregateId:   e.AggregateId,
+		UserId:        e.UserId,
+		Data:          e.Payload,
+		OccurredAt:    e.CreatedAt,
+	}
+}
+
+// AggregateKey identifies the aggregate the event belongs to.
+func (e *OutboxEvent) AggregateKey() string {
+	return e.AggregateType + ":" + strconv.Itoa(e.AggregateId)
+}
+
+type PostgresOutboxStore struct {
+	db *sql.DB
+}
+
+func NewPostgresOutboxStore(db *sql.DB) *PostgresOutboxStore {
+	return &PostgresOutboxStore{db: db}
+}
+
+type OutboxStore interface {
+	TryLock(ctx context.Context) (unlock func(), ok bool, err error)
+	GetPendingEvents(limit int) ([]OutboxEvent, error)
+	MarkPublished(id int64) error
+	MarkFailed(id int64, reason string, publishedSinks []string, nextAttemptAt time.Time) error
+	MarkDead(id int64, reason string, publishedSinks []string) error
+	GetAggregateEvents(aggregateType string, aggregateId int, afterId int64, limit int) ([]OutboxEvent, error)
+	GetEventsAfter(aggregateType string, cursors map[int]int64, limit int) ([]OutboxEvent, error)
+	GetLatestAggregateEventId(aggregateType string, aggregateId int) (int64, error)
+}
+
+func (pg *PostgresOutboxStore) TryLock(ctx context.Context) (func(), bool, error) {
+	conn, err := pg.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, outboxRelayLockKey).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+
+	unlock := func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, outboxRelayLockKey)
+		conn.Close()
+	}
+	return unlock, true, nil
+}
+
+// GetPendingEvents returns the oldest events that are due, leaving out events
+// that wait for a retry and every later event of their aggregates so that
+// these never fill a batch. Dead events no longer hold anything back.
+func (pg *PostgresOutboxStore) GetPendingEvents(limit int) ([]OutboxEvent, error) {
+	query := `
+	SELECT o.id,o.aggregate_type,o.aggregate_id,o.event_type,COALESCE(o.user_id,0),o.payload,o.attempts,o.next_attempt_at,o.createdAT,
+		array_to_string(o.published_sinks,',')
+	FROM outbox o
+	WHERE o.published_at IS NULL AND o.failed_at IS NULL AND o.next_attempt_at <= CURRENT_TIMESTAMP
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox b
+			WHERE b.aggregate_type=o.aggregate_type AND b.aggregate_id=o.aggregate_id AND b.id<o.id
+				AND b.published_at IS NULL AND b.failed_at IS NULL AND b.next_attempt_at > CURRENT_TIMESTAMP
+		)
+	ORDER BY o.id
+	LIMIT $1`
+	rows, err := pg.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(rows)
+}
+
+// GetAggregateEvents returns the already published events of one aggregate
+// with an id greater than afterId, oldest first.
+func (pg *PostgresOutboxStore) GetAggregateEvents(aggregateType string, aggregateId int, afterId int64, limit int) ([]OutboxEvent, error) {
+	query := `
+	SELECT id,aggregate_type,aggregate_id,event_type,COALESCE(user_id,0),payload,attempts,next_attempt_at,createdAT,
+		array_to_string(published_sinks,',')
+	FROM outbox
+	WHERE aggregate_type=$1 AND aggregate_id=$2 AND id>$3 AND published_at IS NOT NULL
+	ORDER BY id
+	LIMIT $4`
+	rows, err := pg.db.Query(query, aggregateType, aggregateId, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(rows)
+}
+
+// GetEventsAfter returns the already published events of several aggregates
+// at once, oldest first. cursors maps each aggregate id to the id of the last
+// event already seen of it.
+func (pg *PostgresOutboxStore) GetEventsAfter(aggregateType string, cursors map[int]int64, limit int) ([]OutboxEvent, error) {
+	if len(cursors) == 0 {
+		return []OutboxEvent{}, nil
+	}
+
+	aggregateIds := make([]string, 0, len(cursors))
+	afterIds := make([]string, 0, len(cursors))
+	for aggregateId, afterId := range cursors {
+		aggregateIds = append(aggregateIds, strconv.Itoa(aggregateId))
+		afterIds = append(afterIds, strconv.FormatInt(afterId, 10))
+	}
+
+	query := `
+	SELECT o.id,o.aggregate_type,o.aggregate_id,o.event_type,COALESCE(o.user_id,0),o.payload,o.attempts,o.next_attempt_at,o.createdAT,
+		array_to_string(o.published_sinks,',')
+	FROM unnest(string_to_array($2,',')::int[], string_to_array($3,',')::bigint[]) AS c(aggregate_id, after_id)
+	JOIN outbox o ON o.aggregate_type=$1 AND o.aggregate_id=c.aggregate_id AND o.id>c.after_id
+	WHERE o.published_at IS NOT NULL
+	ORDER BY o.id
+	LIMIT $4`
+	rows, err := pg.db.Query(query, aggregateType, strings.Join(aggregateIds, ","), strings.Join(afterIds, ","), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvents(rows)
+}
+
+// GetLatestAggregateEventId returns the id of the latest published event of
+// an aggregate, or 0 if it has none.
+func (pg *PostgresOutboxStore) GetLatestAggregateEventId(aggregateType string, aggregateId int) (int64, error) {
+	var id int64
+	query := `
+	SELECT COALESCE(MAX(id),0)
+	FROM outbox
+	WHERE aggregate_type=$1 AND aggregate_id=$2 AND published_at IS NOT NULL`
+	err := pg.db.QueryRow(query, aggregateType, aggregateId).Scan(&id)
+	return id, err
+}
+
+func scanOutboxEvents(rows *sql.Rows) ([]OutboxEvent, error) {
+	defer rows.Close()
+
+	events := []OutboxEvent{}
+	for rows.Next() {
+		var event OutboxEvent
+		var payload []byte
+		var sinks string
+		err := rows.Scan(&event.Id, &event.AggregateType, &event.AggregateId, &event.EventType, &event.UserId,
+			&payload, &event.Attempts, &event.NextAttemptAt, &event.CreatedAt, &sinks)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		if sinks != "" {
+			event.PublishedSinks = strings.Split(sinks, ",")
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (pg *PostgresOutboxStore) MarkPublished(id int64) error {
+	_, err := pg.db.Exec(`UPDATE outbox SET published_at=CURRENT_TIMESTAMP, last_error=NULL WHERE id=$1`, id)
+	return err
+}
+
+// MarkFailed schedules a retry of the event for the sinks that are not in
+// publishedSinks.
+func (pg *PostgresOutboxStore) MarkFailed(id int64, reason string, publishedSinks []string, nextAttemptAt time.Time) error {
+	query := `
+	UPDATE outbox SET attempts=attempts+1, last_error=$1, next_attempt_at=$2, published_sinks=string_to_array($3,',')
+	WHERE id=$4`
+	_, err := pg.db.Exec(query, reason, nextAttemptAt, strings.Join(publishedSinks, ","), id)
+	return err
+}
+
+// MarkDead gives up on an event. It is kept with its last error for
+// inspection and no longer holds back the later events of its aggregate.
+func (pg *PostgresOutboxStore) MarkDead(id int64, reason string, publishedSinks []string) error {
+	query := `
+	UPDATE outbox SET attempts=attempts+1, last_error=$1, failed_at=CURRENT_TIMESTAMP, published_sinks=string_to_array($2,',')
+	WHERE id=$3`
+	_, err := pg.db.Exec(query, reason, strings.Join(publishedSinks, ","), id)
+	return err
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordAlgorithm string
+
+const (
+	PasswordBcrypt   PasswordAlgorithm = "bcrypt"
+	PasswordArgon2id PasswordAlgorithm = "argon2id"
+)
+
+// argon2idPrefix starts Argon2id hashes encoded in the PHC string format
+// $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>. bcrypt hashes
+// carry their own $2a$/$2b$ prefix.
+const argon2idPrefix = "$argon2id$"
+
+var (
+	ErrPasswordNotSet      = errors.New("password hash is not set")
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+)
+
+// PasswordParams selects how new passwords are hashed. Hashes made with other
+// parameters keep verifying and are replaced on the next successful login.
+type PasswordParams struct {
+	Algorithm  PasswordAlgorithm
+	BcryptCost int
+	// Argon2id parameters, Memory is in KiB
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// DefaultPasswordParams uses bcrypt with the cost passwords were always hashed
+// with. The Argon2id values follow the OWASP recommendation for m=64MiB.
+var DefaultPasswordParams = PasswordParams{
+	Algorithm:  PasswordBcrypt,
+	BcryptCost: 12,
+	Memory:     64 * 1024,
+	Time:       3,
+	Threads:    2,
+	KeyLen:     32,
+	SaltLen:    16,
+}
+
+var (
+	passwordParamsMu sync.RWMutex
+	passwordParams   = DefaultPasswordParams
+)
+
+func ParsePasswordAlgorithm(value string) (PasswordAlgorithm, error) {
+	switch algorithm := PasswordAlgorithm(strings.ToLower(value)); algorithm {
+	case PasswordBcrypt, PasswordArgon2id:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("password algorithm must be %s or %s", PasswordBcrypt, PasswordArgon2id)
+}
+
+// SetPasswordParams changes the parameters used by password.Set.
+func SetPasswordParams(params PasswordParams) error {
+	if _, err := ParsePasswordAlgorithm(string(params.Algorithm)); err != nil {
+		return err
+	}
+	if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if params.Memory == 0 || params.Time == 0 || params.Threads == 0 || params.KeyLen < 16 || params.SaltLen < 16 {
+		return errors.New("invalid argon2id parameters")
+	}
+	passwordParamsMu.Lock()
+	defer passwordParamsMu.Unlock()
+	passwordParams = params
+	return nil
+}
+
+func currentPasswordParams() PasswordParams {
+	passwordParamsMu.RLock()
+	defer passwordParamsMu.RUnlock()
+	return passwordParams
+}
+
+// password only ever holds the encoded hash, the plaintext is never kept.
+type password struct {
+	hash []byte
+}
+
+func (p *password) Set(plainTextpassword string) error {
+	params := currentPasswordParams()
+	if params.Algorithm == PasswordArgon2id {
+		hash, err := argon2idHash(plainTextpassword, params)
+		if err != nil {
+			return err
+		}
+		p.hash = hash
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextpassword), params.BcryptCost)
+	if err != nil {
+		return err
+	}
+	p.hash = hash
+	return nil
+}
+
+func (p *password) Matches(password string) (bool, error) {
+	if len(p.hash) == 0 {
+		return false, ErrPasswordNotSet
+	}
+	if strings.HasPrefix(string(p.hash), argon2idPrefix) {
+		return argon2idMatches(p.hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(password))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		case errors.Is(err, bcrypt.ErrHashTooShort), errors.As(err, new(bcrypt.HashVersionTooNewError)),
+			errors.As(err, new(bcrypt.InvalidHashPrefixError)):
+			return false, ErrUnknownPasswordHash
+		default:
+			return false, err //internal server error
+		}
+	}
+	return true, nil
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// other parameters than new passwords are hashed with. Callers rehash the
+// password after it matched, while they still know the plaintext.
+func (p *password) NeedsRehash() bool {
+	params := currentPasswordParams()
+	if strings.HasPrefix(string(p.hash), argon2idPrefix) {
+		if params.Algorithm != PasswordArgon2id {
+			return true
+		}
+		hashParams, _, key, err := decodeArgon2id(p.hash)
+		return err != nil || hashParams.Memory != params.Memory || hashParams.Time != params.Time ||
+			hashParams.Threads != params.Threads || uint32(len(key)) != params.KeyLen
+	}
+
+	if params.Algorithm != PasswordBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost(p.hash)
+	return err != nil || cost != params.BcryptCost
+}
+
+func argon2idHash(plaintext string, params PasswordParams) ([]byte, error) {
+	salt := make([]byte, params.SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(plaintext), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+func argon2idMatches(hash []byte, plaintext string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(plaintext), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func decodeArgon2id(hash []byte) (PasswordParams, []byte, []byte, error) {
+	params := PasswordParams{Algorithm: PasswordArgon2id}
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil || params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func usePasswordParams(t *testing.T, params PasswordParams) {
+	t.Helper()
+	require.NoError(t, SetPasswordParams(params))
+	t.Cleanup(func() { SetPasswordParams(DefaultPasswordParams) })
+}
+
+func fastParams(algorithm PasswordAlgorithm) PasswordParams {
+	params := DefaultPasswordParams
+	params.Algorithm = algorithm
+	params.BcryptCost = bcrypt.MinCost
+	params.Memory = 1024
+	params.Time = 1
+	return params
+}
+
+func TestPasswordRoundTrip(t *testing.T) {
+	for _, algorithm := range []PasswordAlgorithm{PasswordBcrypt, PasswordArgon2id} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			usePasswordParams(t, fastParams(algorithm))
+
+			var p password
+			require.NoError(t, p.Set("correct horse"))
+			assert.NotContains(t, string(p.hash), "correct horse")
+			if algorithm == PasswordArgon2id {
+				assert.True(t, strings.HasPrefix(string(p.hash), "$argon2id$v=19$m=1024,t=1,p=2$"))
+			}
+
+			matches, err := p.Matches("correct horse")
+			require.NoError(t, err)
+			assert.True(t, matches)
+
+			matches, err = p.Matches("wrong horse")
+			require.NoError(t, err)
+			assert.False(t, matches)
+			assert.False(t, p.NeedsRehash())
+		})
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	usePasswordParams(t, fastParams(PasswordBcrypt))
+	var p password
+	require.NoError(t, p.Set("secret"))
+
+	// a higher bcrypt cost
+	params := fastParams(PasswordBcrypt)
+	params.BcryptCost = bcrypt.MinCost + 1
+	usePasswordParams(t, params)
+	assert.True(t, p.NeedsRehash())
+
+	// switching to argon2id keeps old bcrypt hashes verifying
+	usePasswordParams(t, fastParams(PasswordArgon2id))
+	assert.True(t, p.NeedsRehash())
+	matches, err := p.Matches("secret")
+	require.NoError(t, err)
+	assert.True(t, matches)
+
+	require.NoError(t, p.Set("secret"))
+	assert.False(t, p.NeedsRehash())
+
+	// stronger argon2id parameters
+	params = fastParams(PasswordArgon2id)
+	params.Time = 2
+	usePasswordParams(t, params)
+	assert.True(t, p.NeedsRehash())
+}
+
+func TestPasswordMatchesInvalidHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr error
+	}{
+		{name: "not set", hash: "", wantErr: ErrPasswordNotSet},
+		{name: "plaintext", hash: "hunter2", wantErr: ErrUnknownPasswordHash},
+		{name: "argon2id without key", hash: "$argon2id$v=19$m=1024,t=1,p=2$c2FsdHNhbHRzYWx0c2FsdA", wantErr: ErrUnknownPasswordHash},
+		{name: "argon2id other version", hash: "$argon2id$v=16$m=1024,t=1,p=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5", wantErr: ErrUnknownPasswordHash},
+		{name: "argon2id without memory", hash: "$argon2id$v=19$m=0,t=1,p=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5", wantErr: ErrUnknownPasswordHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := password{hash: []byte(tt.hash)}
+			matches, err := p.Matches("hunter2")
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.False(t, matches)
+		})
+	}
+}
+
+func TestSetPasswordParams(t *testing.T) {
+	params := DefaultPasswordParams
+	params.Algorithm = "md5"
+	assert.Error(t, SetPasswordParams(params))
+
+	params = DefaultPasswordParams
+	params.BcryptCost = 40
+	assert.Error(t, SetPasswordParams(params))
+
+	params = DefaultPasswordParams
+	params.SaltLen = 4
+	assert.Error(t, SetPasswordParams(params))
+}
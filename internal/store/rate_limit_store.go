@@ -0,0 +1,110 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/ratelimit"
+)
+
+// PostgresRateLimitStore shares rate limits and login failures between the
+// instances of the API.
+type PostgresRateLimitStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRateLimitStore(db *sql.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+// Take locks the bucket row so that concurrent requests of a key are counted
+// one after another.
+func (pg *PostgresRateLimitStore) Take(key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	query := `
+	INSERT INTO rate_limit_buckets (key,tokens,updated_at,expiry) VALUES ($1,0,'epoch',$2)
+	ON CONFLICT (key) DO NOTHING`
+	result, err := tx.Exec(query, key, now)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	var bucket ratelimit.Bucket
+	var expiry time.Time
+	query = `SELECT tokens,updated_at,expiry FROM rate_limit_buckets WHERE key=$1 FOR UPDATE`
+	err = tx.QueryRow(query, key).Scan(&bucket.Tokens, &bucket.Updated, &expiry)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	if !now.Before(expiry) {
+		// refilled since, start over with a full bucket
+		bucket = ratelimit.Bucket{}
+	}
+
+	bucket, taken := limit.Take(bucket, now)
+	query = `UPDATE rate_limit_buckets SET tokens=$1,updated_at=$2,expiry=$3 WHERE key=$4`
+	_, err = tx.Exec(query, bucket.Tokens, bucket.Updated, now.Add(taken.Reset), key)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	if created == 1 {
+		// buckets of clients that went away are dropped along the way
+		_, err = tx.Exec(`DELETE FROM rate_limit_buckets WHERE expiry < $1`, now)
+		if err != nil {
+			return ratelimit.Result{}, err
+		}
+	}
+	return taken, tx.Commit()
+}
+
+func (pg *PostgresRateLimitStore) AddFailure(key string, ttl time.Duration) (int, time.Time, error) {
+	var failures int
+	var last time.Time
+	now := time.Now()
+	query := `
+	INSERT INTO login_failures (key,failures,last_failure_at,expiry) VALUES ($1,1,$2,$3)
+	ON CONFLICT (key) DO UPDATE SET
+		failures=CASE WHEN login_failures.expiry > $2 THEN login_failures.failures+1 ELSE 1 END,
+		last_failure_at=EXCLUDED.last_failure_at,
+		expiry=EXCLUDED.expiry
+	RETURNING failures,last_failure_at`
+	err := pg.db.QueryRow(query, key, now, now.Add(ttl)).Scan(&failures, &last)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return failures, last, nil
+}
+
+func (pg *PostgresRateLimitStore) GetFailures(key string) (int, time.Time, error) {
+	var failures int
+	var last time.Time
+	query := `SELECT failures,last_failure_at FROM login_failures WHERE key=$1 AND expiry > $2`
+	err := pg.db.QueryRow(query, key, time.Now()).Scan(&failures, &last)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return failures, last, nil
+}
+
+func (pg *PostgresRateLimitStore) ResetFailures(key string) error {
+	_, err := pg.db.Exec(`DELETE FROM login_failures WHERE key=$1`, key)
+	if err != nil {
+		return err
+	}
+	// failures of other keys that expired are dropped along the way
+	_, err = pg.db.Exec(`DELETE FROM login_failures WHERE expiry < $1`, time.Now())
+	return err
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token is presented a
+// second time. The token may have been stolen, so every token of its family
+// is revoked and the user has to sign in again.
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
+type PostgresRefreshTokenStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRefreshTokenStore(db *sql.DB) *PostgresRefreshTokenStore {
+	return &PostgresRefreshTokenStore{db: db}
+}
+
+// RefreshTokenStore keeps refresh tokens hashed. Each sign in starts a family
+// of tokens; rotating a token marks it used and adds its successor to the
+// family.
+type RefreshTokenStore interface {
+	CreateRefreshToken(userId int, ttl time.Duration) (*tokens.Token, error)
+	RotateRefreshToken(plaintextToken string, ttl time.Duration) (*tokens.Token, error)
+	RevokeRefreshToken(plaintextToken string) error
+}
+
+func insertRefreshToken(tx *sql.Tx, token *tokens.Token, family []byte) error {
+	query := `INSERT INTO refresh_tokens (hash,family,user_id,expiry) VALUES ($1,$2,$3,$4)`
+	_, err := tx.Exec(query, token.Hash, family, token.UserId, token.Expiry)
+	return err
+}
+
+// CreateRefreshToken starts a new family, identified by the hash of its
+// first token.
+func (pg *PostgresRefreshTokenStore) CreateRefreshToken(userId int, ttl time.Duration) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userId, ttl, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = insertRefreshToken(tx, token, token.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return token, tx.Commit()
+}
+
+// RotateRefreshToken exchanges a valid refresh token for a new one of the
+// same family. Presenting a used token revokes the family and returns
+// ErrRefreshTokenReused; unknown, expired and revoked tokens ErrTokenInvalid.
+func (pg *PostgresRefreshTokenStore) RotateRefreshToken(plaintextToken string, ttl time.Duration) (*tokens.Token, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userId int
+	var family []byte
+	var expiry time.Time
+	var usedAt, revokedAt *time.Time
+	query := `SELECT user_id,family,expiry,used_at,revoked_at FROM refresh_tokens WHERE hash=$1 FOR UPDATE`
+	err = tx.QueryRow(query, tokens.Hash(plaintextToken)).Scan(&userId, &family, &expiry, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case revokedAt != nil:
+		return nil, ErrTokenInvalid
+	case usedAt != nil:
+		err = revokeFamily(tx, family, now)
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	case !expiry.After(now):
+		return nil, ErrTokenInvalid
+	}
+
+	_, err = tx.Exec(`UPDATE refresh_tokens SET used_at=$1 WHERE hash=$2`, now, tokens.Hash(plaintextToken))
+	if err != nil {
+		return nil, err
+	}
+	token, err := tokens.GenerateToken(userId, ttl, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	err = insertRefreshToken(tx, token, family)
+	if err != nil {
+		return nil, err
+	}
+	return token, tx.Commit()
+}
+
+// RevokeRefreshToken signs out the session of the token by revoking its
+// whole family.
+func (pg *PostgresRefreshTokenStore) RevokeRefreshToken(plaintextToken string) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var family []byte
+	err = tx.QueryRow(`SELECT family FROM refresh_tokens WHERE hash=$1`, tokens.Hash(plaintextToken)).Scan(&family)
+	if err == sql.ErrNoRows {
+		return ErrTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	err = revokeFamily(tx, family, time.Now())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func revokeFamily(tx *sql.Tx, family []byte, now time.Time) error {
+	query := `UPDATE refresh_tokens SET revoked_at=COALESCE(revoked_at,$1) WHERE family=$2`
+	_, err := tx.Exec(query, now, family)
+	return err
+}
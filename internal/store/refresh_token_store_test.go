@@ -0,0 +1,71 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	userStore := NewPostgresUserStore(db)
+	refreshStore := NewPostgresRefreshTokenStore(db)
+	user := createTestUser(t, userStore, fmt.Sprintf("refresh_%d", time.Now().UnixNano()))
+
+	first, err := refreshStore.CreateRefreshToken(user.Id, time.Hour)
+	require.NoError(t, err)
+
+	t.Run("rotation", func(t *testing.T) {
+		second, err := refreshStore.RotateRefreshToken(first.Plaintext, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, user.Id, second.UserId)
+		assert.NotEqual(t, first.Plaintext, second.Plaintext)
+
+		third, err := refreshStore.RotateRefreshToken(second.Plaintext, time.Hour)
+		require.NoError(t, err)
+
+		// presenting a used token revokes the whole family, including its
+		// latest token
+		_, err = refreshStore.RotateRefreshToken(first.Plaintext, time.Hour)
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+		_, err = refreshStore.RotateRefreshToken(third.Plaintext, time.Hour)
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		var live int
+		query := `SELECT COUNT(*) FROM refresh_tokens WHERE user_id=$1 AND revoked_at IS NULL`
+		require.NoError(t, db.QueryRow(query, user.Id).Scan(&live))
+		assert.Zero(t, live)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		token, err := refreshStore.CreateRefreshToken(user.Id, time.Hour)
+		require.NoError(t, err)
+		rotated, err := refreshStore.RotateRefreshToken(token.Plaintext, time.Hour)
+		require.NoError(t, err)
+
+		// other sessions of the user are left alone
+		other, err := refreshStore.CreateRefreshToken(user.Id, time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, refreshStore.RevokeRefreshToken(token.Plaintext))
+		_, err = refreshStore.RotateRefreshToken(rotated.Plaintext, time.Hour)
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		_, err = refreshStore.RotateRefreshToken(other.Plaintext, time.Hour)
+		assert.NoError(t, err)
+
+		assert.ErrorIs(t, refreshStore.RevokeRefreshToken("unknown"), ErrTokenInvalid)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, err := refreshStore.CreateRefreshToken(user.Id, -time.Minute)
+		require.NoError(t, err)
+		_, err = refreshStore.RotateRefreshToken(token.Plaintext, time.Hour)
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+	})
+}
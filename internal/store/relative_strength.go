@@ -0,0 +1,57 @@
+package store
+
+import (
+	"math"
+	"strings"
+)
+
+// bodyweightExercises maps bodyweight exercises to the approximate fraction of
+// bodyweight they move. Names are matched lowercased with separators removed,
+// so "Pull-Up", "pull up" and "pullups" are the same exercise.
+var bodyweightExercises = []struct {
+	name     string
+	fraction float64
+}{
+	{"muscleup", 1.0},
+	{"pullup", 1.0},
+	{"chinup", 1.0},
+	{"dip", 1.0},
+	{"pistolsquat", 1.0},
+	{"pushup", 0.64},
+	{"invertedrow", 0.5},
+}
+
+func bodyweightFraction(exerciseName string) (float64, bool) {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(exerciseName))
+	for _, e := range bodyweightExercises {
+		if strings.Contains(name, e.name) {
+			return e.fraction, true
+		}
+	}
+	return 0, false
+}
+
+// applyBodyweight derives the relative strength of bodyweight exercises: the
+// load moved, the bodyweight share plus any added weight, divided by the
+// athlete's bodyweight.
+func (e *WorkoutEntry) applyBodyweight(bodyweightKg *float64) {
+	e.RelativeStrength = nil
+	if bodyweightKg == nil || *bodyweightKg <= 0 || e.Reps == nil {
+		return
+	}
+	fraction, ok := bodyweightFraction(e.ExerciseName)
+	if !ok {
+		return
+	}
+	load := *bodyweightKg * fraction
+	if e.Weight != nil {
+		load += *e.Weight
+	}
+	relative := math.Round(load / *bodyweightKg * 100) / 100
+	e.RelativeStrength = &relative
+}
@@ -0,0 +1,317 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+var (
+	ErrSessionFinished    = errors.New("session already finished")
+	ErrSessionNotStarted  = errors.New("workout is not a live session")
+	ErrSessionInvalidTime = errors.New("finished_at must be after started_at")
+)
+
+type WorkoutSession struct {
+	WorkoutId   int              `json:"workout_id"`
+	UserId      int              `json:"user_id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	StartedAt   time.Time        `json:"started_at"`
+	FinishedAt  *time.Time       `json:"finished_at"`
+	WeightUnit  units.WeightUnit `json:"weight_unit"`
+	Sets        []SessionSet     `json:"sets"`
+}
+
+type SessionSet struct {
+	Id              int              `json:"id"`
+	WorkoutId       int              `json:"workout_id"`
+	ExerciseName    string           `json:"exercise_name"`
+	SetNumber       int              `json:"set_number"`
+	Reps            *int             `json:"reps"`
+	DurationSeconds *int             `json:"duration_seconds"`
+	Weight          *float64         `json:"weight"`
+	RPE             *float64         `json:"rpe"`
+	RestSeconds     *int             `json:"rest_seconds"`
+	Notes           string           `json:"notes"`
+	PerformedAt     time.Time        `json:"performed_at"`
+	WeightUnit      units.WeightUnit `json:"weight_unit"`
+}
+
+type PostgresSessionStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionStore(db *sql.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{db: db}
+}
+
+type SessionStore interface {
+	StartSession(*WorkoutSession) (*WorkoutSession, error)
+	GetSession(workoutId int64) (*WorkoutSession, error)
+	AddSet(*SessionSet) (*SessionSet, error)
+	FinishSession(workoutId int64, finishedAt time.Time, caloriesBurned int) (*Workout, error)
+}
+
+func (pg *PostgresSessionStore) StartSession(session *WorkoutSession) (*WorkoutSession, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO workouts (user_id,title,description,duration_minutes,started_at)
+	VALUES (NULLIF($1,0),$2,$3,0,$4)
+	RETURNING id`
+	err = tx.QueryRow(query, session.UserId, session.Title, session.Description, session.StartedAt).Scan(&session.WorkoutId)
+	if err != nil {
+		return nil, err
+	}
+	session.Sets = []SessionSet{}
+	session.WeightUnit = units.Canonical
+
+	err = insertOutboxEvent(tx, sessionEvent(EventWorkoutSessionStarted, session.WorkoutId, session.UserId, session))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (pg *PostgresSessionStore) GetSession(workoutId int64) (*WorkoutSession, error) {
+	session := &WorkoutSession{WeightUnit: units.Canonical}
+	var startedAt *time.Time
+	query := `SELECT id,COALESCE(user_id,0),title,COALESCE(description,''),started_at,finished_at FROM workouts WHERE id=$1 AND deleted_at IS NULL`
+	err := pg.db.QueryRow(query, workoutId).Scan(&session.WorkoutId, &session.UserId, &session.Title, &session.Description, &startedAt, &session.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if startedAt == nil {
+		return nil, ErrSessionNotStarted
+	}
+	session.StartedAt = *startedAt
+
+	session.Sets, err = getSessionSets(pg.db, workoutId)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func getSessionSets(q querier, workoutId int64) ([]SessionSet, error) {
+	query := `
+	SELECT id,workout_id,exercise_name,set_number,reps,duration_seconds,weight,rpe,rest_seconds,COALESCE(notes,''),performed_at
+	FROM workout_session_sets WHERE workout_id=$1 ORDER BY id`
+	rows, err := q.Query(query, workoutId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := []SessionSet{}
+	for rows.Next() {
+		set := SessionSet{WeightUnit: units.Canonical}
+		err := rows.Scan(&set.Id, &set.WorkoutId, &set.ExerciseName, &set.SetNumber, &set.Reps, &set.DurationSeconds,
+			&set.Weight, &set.RPE, &set.RestSeconds, &set.Notes, &set.PerformedAt)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+// lockSession locks the workout row of a live session for the rest of tx so
+// concurrent set logging and finishing are serialized.
+func lockSession(tx *sql.Tx, workoutId int64) (userId int, startedAt time.Time, err error) {
+	var started, finished *time.Time
+	query := `SELECT COALESCE(user_id,0),started_at,finished_at FROM workouts WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRow(query, workoutId).Scan(&userId, &started, &finished)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if started == nil {
+		return 0, time.Time{}, ErrSessionNotStarted
+	}
+	if finished != nil {
+		return 0, time.Time{}, ErrSessionFinished
+	}
+	return userId, *started, nil
+}
+
+func (pg *PostgresSessionStore) AddSet(set *SessionSet) (*SessionSet, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userId, _, err := lockSession(tx, int64(set.WorkoutId))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO workout_session_sets (workout_id,exercise_name,set_number,reps,duration_seconds,weight,rpe,rest_seconds,notes,performed_at)
+	VALUES ($1,$2,
+		(SELECT COALESCE(MAX(set_number),0)+1 FROM workout_session_sets WHERE workout_id=$1 AND exercise_name=$2),
+		$3,$4,$5,$6,$7,$8,$9)
+	RETURNING id,set_number`
+	err = tx.QueryRow(query, set.WorkoutId, set.ExerciseName, set.Reps, set.DurationSeconds, set.Weight, set.RPE,
+		set.RestSeconds, set.Notes, set.PerformedAt).Scan(&set.Id, &set.SetNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertOutboxEvent(tx, sessionEvent(EventWorkoutSetLogged, set.WorkoutId, userId, set))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	set.WeightUnit = units.Canonical
+	return set, nil
+}
+
+// FinishSession closes a live session: the duration is derived from the start
+// and finish timestamps and the logged sets are collapsed into workout entries
+// that keep every set as a set detail.
+func (pg *PostgresSessionStore) FinishSession(workoutId int64, finishedAt time.Time, caloriesBurned int) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userId, startedAt, err := lockSession(tx, workoutId)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Before(startedAt) {
+		return nil, ErrSessionInvalidTime
+	}
+
+	sets, err := getSessionSets(tx, workoutId)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := CollapseSets(sets)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := int(math.Ceil(finishedAt.Sub(startedAt).Minutes()))
+	if caloriesBurned == 0 {
+		bodyweight, err := estimationBodyweight(tx, userId)
+		if err != nil {
+			return nil, err
+		}
+		caloriesBurned = EstimateCalories(&Workout{DurationMinutes: duration, Entries: entries}, bodyweight)
+	}
+	query := `
+	UPDATE workouts SET duration_minutes=$1,calories_burned=$2,finished_at=$3,updatedAt=CURRENT_TIMESTAMP
+	WHERE id=$4`
+	_, err = tx.Exec(query, duration, caloriesBurned, finishedAt, workoutId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		err = insertEntry(tx, int(workoutId), &entries[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	workout, err := getWorkout(tx, workoutId)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range workout.Entries {
+		err = insertOutboxEvent(tx, entryEvent(EventWorkoutEntryCreated, workout.UserId, entry))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = insertOutboxEvent(tx, workoutEvent(EventWorkoutSessionFinished, workout))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+// CollapseSets turns logged sets into one entry per exercise, in the order the
+// exercises were first performed. Rep based and timed sets of the same
+// exercise become separate entries. Every set is kept as a set detail and the
+// entry aggregates describe the top set.
+func CollapseSets(sets []SessionSet) ([]WorkoutEntry, error) {
+	var order []string
+	groups := map[string]*WorkoutEntry{}
+	notes := map[string][]string{}
+
+	for _, set := range sets {
+		key := set.ExerciseName + "|reps"
+		if set.Reps == nil {
+			key = set.ExerciseName + "|time"
+		}
+		entry, ok := groups[key]
+		if !ok {
+			entry = &WorkoutEntry{ExerciseName: set.ExerciseName, OrderIndex: len(order) + 1}
+			groups[key] = entry
+			order = append(order, key)
+		}
+
+		entry.SetDetails = append(entry.SetDetails, WorkoutSet{
+			SetNumber:       len(entry.SetDetails) + 1,
+			SetType:         SetTypeWorking,
+			Reps:            set.Reps,
+			DurationSeconds: set.DurationSeconds,
+			Weight:          set.Weight,
+			RPE:             set.RPE,
+			RestSeconds:     set.RestSeconds,
+		})
+		if set.Notes != "" {
+			notes[key] = append(notes[key], set.Notes)
+		}
+	}
+
+	entries := make([]WorkoutEntry, 0, len(order))
+	for _, key := range order {
+		entry := groups[key]
+		entry.Notes = strings.Join(notes[key], "; ")
+		if err := entry.normalizeSets(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func sessionEvent(eventType string, workoutId int, userId int, data interface{}) Event {
+	return Event{
+		Type:          eventType,
+		AggregateType: AggregateWorkout,
+		AggregateId:   workoutId,
+		UserId:        userId,
+		Data:          data,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
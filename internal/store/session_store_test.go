@@ -0,0 +1,107 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapseSets(t *testing.T) {
+	sets := []SessionSet{
+		{ExerciseName: "Bench press", Reps: IntPtr(8), Weight: FloatPtr(60), Notes: "easy"},
+		{ExerciseName: "Plank", DurationSeconds: IntPtr(45)},
+		{ExerciseName: "Bench press", Reps: IntPtr(6), Weight: FloatPtr(70), RPE: FloatPtr(9)},
+		{ExerciseName: "Bench press", Reps: IntPtr(10), Weight: FloatPtr(50)},
+		{ExerciseName: "Plank", DurationSeconds: IntPtr(60), RestSeconds: IntPtr(30)},
+	}
+
+	entries, err := CollapseSets(sets)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	bench := entries[0]
+	assert.Equal(t, "Bench press", bench.ExerciseName)
+	assert.Equal(t, 1, bench.OrderIndex)
+	assert.Equal(t, 3, bench.Sets)
+	assert.Equal(t, 6, *bench.Reps)
+	assert.Equal(t, float64(70), *bench.Weight)
+	assert.Nil(t, bench.DurationSeconds)
+	assert.Equal(t, "easy", bench.Notes)
+	require.Len(t, bench.SetDetails, 3)
+	assert.Equal(t, 2, bench.SetDetails[1].SetNumber)
+	assert.Equal(t, float64(9), *bench.SetDetails[1].RPE)
+
+	plank := entries[1]
+	assert.Equal(t, 2, plank.OrderIndex)
+	assert.Equal(t, 2, plank.Sets)
+	assert.Nil(t, plank.Reps)
+	assert.Equal(t, 60, *plank.DurationSeconds)
+	assert.Equal(t, 30, *plank.SetDetails[1].RestSeconds)
+}
+
+func TestNormalizeSets(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      WorkoutEntry
+		wantErr    bool
+		wantSets   int
+		wantReps   *int
+		wantWeight *float64
+	}{
+		{
+			name: "pyramid with warm-up",
+			entry: WorkoutEntry{
+				ExerciseName: "Squat",
+				SetDetails: []WorkoutSet{
+					{SetType: SetTypeWarmup, Reps: IntPtr(10), Weight: FloatPtr(40)},
+					{Reps: IntPtr(8), Weight: FloatPtr(80)},
+					{Reps: IntPtr(5), Weight: FloatPtr(100)},
+					{SetType: SetTypeDrop, Reps: IntPtr(12), Weight: FloatPtr(60)},
+				},
+			},
+			wantSets:   3,
+			wantReps:   IntPtr(5),
+			wantWeight: FloatPtr(100),
+		},
+		{
+			name: "reps and duration",
+			entry: WorkoutEntry{
+				ExerciseName: "Plank",
+				SetDetails:   []WorkoutSet{{Reps: IntPtr(1), DurationSeconds: IntPtr(30)}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown set type",
+			entry: WorkoutEntry{
+				ExerciseName: "Row",
+				SetDetails:   []WorkoutSet{{SetType: "cluster", Reps: IntPtr(3)}},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "aggregates only",
+			entry:    WorkoutEntry{ExerciseName: "Curl", Sets: 3, Reps: IntPtr(12)},
+			wantSets: 3,
+			wantReps: IntPtr(12),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.normalizeSets()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSets, tt.entry.Sets)
+			assert.Equal(t, tt.wantReps, tt.entry.Reps)
+			assert.Equal(t, tt.wantWeight, tt.entry.Weight)
+			for i, set := range tt.entry.SetDetails {
+				assert.Equal(t, i+1, set.SetNumber)
+				assert.True(t, *set.Completed)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
+)
+
+var (
+	ErrSelfFollow    = errors.New("you cannot follow yourself")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Profile is the public view of a user: it never includes the email.
+type Profile struct {
+	Id                int        `json:"id"`
+	Username          string     `json:"username"`
+	Bio               string     `json:"bio"`
+	ProfileVisibility Visibility `json:"profile_visibility"`
+	Followers         int        `json:"followers"`
+	Following         int        `json:"following"`
+	// Restricted is set when the viewer may not see the profile details
+	Restricted bool      `json:"restricted"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// approvedFollow limits follows f to approved ones. A follow of a non-public
+// profile is a request until the followee approves it and grants nothing
+// before.
+const approvedFollow = `f.approved_at IS NOT NULL`
+
+type Follow struct {
+	UserId     int       `json:"user_id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// FeedItem summarizes a workout of a followed user.
+type FeedItem struct {
+	WorkoutId       int              `json:"workout_id"`
+	UserId          int              `json:"user_id"`
+	Username        string           `json:"username"`
+	Title           string           `json:"title"`
+	Description     string           `json:"description"`
+	Visibility      Visibility       `json:"visibility"`
+	DurationMinutes int              `json:"duration_minutes"`
+	CaloriesBurned  int              `json:"calories_burned"`
+	StartedAt       *time.Time       `json:"started_at"`
+	FinishedAt      *time.Time       `json:"finished_at"`
+	Exercises       int              `json:"exercises"`
+	Volume          float64          `json:"volume"`
+	DistanceMeters  float64          `json:"distance_meters"`
+	WeightUnit      units.WeightUnit `json:"weight_unit"`
+	CreatedAt       time.Time        `json:"created_at"`
+}
+
+func (f *FeedItem) ConvertWeights(from, to units.WeightUnit) {
+	f.Volume = units.Convert(f.Volume, from, to)
+	f.WeightUnit = to
+}
+
+// FeedCursor is the position after the last item of a feed page. Pages are
+// keyed on (createdAT, id) so new workouts never shift later pages.
+type FeedCursor struct {
+	CreatedAt time.Time
+	WorkoutId int
+}
+
+func (c FeedCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.WorkoutId)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeFeedCursor(value string) (*FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	c := &FeedCursor{}
+	c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c.WorkoutId, err = strconv.Atoi(id)
+	if err != nil || c.WorkoutId <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// workoutSummaryColumns selects a FeedItem from workouts w joined with the
+// owner u.
+const workoutSummaryColumns = `w.id,w.user_id,u.username,w.title,COALESCE(w.description,''),w.visibility,w.duration_minutes,
+	COALESCE(w.calories_burned,0),w.started_at,w.finished_at,w.createdAT,
+	(SELECT COUNT(*) FROM workout_entries e WHERE e.workout_id=w.id),
+	COALESCE((SELECT SUM(` + entryVolume + `) FROM workout_entries e WHERE e.workout_id=w.id),0),
+	COALESCE((SELECT SUM(e.distance_meters) FROM workout_entries e WHERE e.workout_id=w.id),0)`
+
+func scanFeedItem(row interface{ Scan(...interface{}) error }) (*FeedItem, error) {
+	item := &FeedItem{WeightUnit: units.Canonical}
+	err := row.Scan(&item.WorkoutId, &item.UserId, &item.Username, &item.Title, &item.Description, &item.Visibility,
+		&item.DurationMinutes, &item.CaloriesBurned, &item.StartedAt, &item.FinishedAt, &item.CreatedAt,
+		&item.Exercises, &item.Volume, &item.DistanceMeters)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+type PostgresSocialStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSocialStore(db *sql.DB) *PostgresSocialStore {
+	return &PostgresSocialStore{db: db}
+}
+
+type SocialStore interface {
+	Follow(followerId, followeeId int) (bool, error)
+	Unfollow(followerId, followeeId int) error
+	IsFollowing(followerId, followeeId int) (bool, error)
+	GetProfile(username string, viewerId int) (*Profile, error)
+	GetFollowers(userId int) ([]Follow, error)
+	GetFollowing(userId int) ([]Follow, error)
+	GetFollowRequests(userId int) ([]Follow, error)
+	ApproveFollow(followerId, followeeId int) error
+	RejectFollow(followerId, followeeId int) error
+	GetFeed(userId int, cursor *FeedCursor, limit int) ([]FeedItem, *FeedCursor, error)
+}
+
+type followData struct {
+	FollowerId       int    `json:"follower_id"`
+	FollowerUsername string `json:"follower_username"`
+	FolloweeId       int    `json:"followee_id"`
+}
+
+// Follow makes followerId follow followeeId and reports whether the follow
+// is approved. Public profiles approve every follow right away, others only
+// receive a request. Following twice is a no-op and only the approval
+// notifies the followee.
+func (pg *PostgresSocialStore) Follow(followerId, followeeId int) (bool, error) {
+	if followerId == followeeId {
+		return false, ErrSelfFollow
+	}
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var approved bool
+	query := `
+	INSERT INTO follows (follower_id,followee_id,approved_at)
+	SELECT $1,u.id,CASE WHEN u.profile_visibility='public' THEN CURRENT_TIMESTAMP END
+	FROM users u WHERE u.id=$2
+	ON CONFLICT DO NOTHING
+	RETURNING approved_at IS NOT NULL`
+	err = tx.QueryRow(query, followerId, followeeId).Scan(&approved)
+	if err == sql.ErrNoRows {
+		query = `SELECT approved_at IS NOT NULL FROM follows WHERE follower_id=$1 AND followee_id=$2`
+		err = tx.QueryRow(query, followerId, followeeId).Scan(&approved)
+		if err != nil {
+			return false, err
+		}
+		return approved, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+	if !approved {
+		return false, tx.Commit()
+	}
+
+	err = notifyFollow(tx, followerId, followeeId)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// notifyFollow records that followerId now follows followeeId.
+func notifyFollow(tx *sql.Tx, followerId, followeeId int) error {
+	data := followData{FollowerId: followerId, FolloweeId: followeeId}
+	err := tx.QueryRow(`SELECT username FROM users WHERE id=$1`, followerId).Scan(&data.FollowerUsername)
+	if err != nil {
+		return err
+	}
+	return insertOutboxEvent(tx, Event{
+		Type:          EventUserFollowed,
+		AggregateType: AggregateUser,
+		AggregateId:   followeeId,
+		UserId:        followeeId,
+		Data:          data,
+		OccurredAt:    time.Now().UTC(),
+	})
+}
+
+// ApproveFollow accepts the pending follow request of followerId.
+func (pg *PostgresSocialStore) ApproveFollow(followerId, followeeId int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE follows SET approved_at=CURRENT_TIMESTAMP WHERE follower_id=$1 AND followee_id=$2 AND approved_at IS NULL`
+	result, err := tx.Exec(query, followerId, followeeId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = notifyFollow(tx, followerId, followeeId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RejectFollow declines the pending follow request of followerId.
+func (pg *PostgresSocialStore) RejectFollow(followerId, followeeId int) error {
+	query := `DELETE FROM follows WHERE follower_id=$1 AND followee_id=$2 AND approved_at IS NULL`
+	result, err := pg.db.Exec(query, followerId, followeeId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresSocialStore) Unfollow(followerId, followeeId int) error {
+	query := `DELETE FROM follows WHERE follower_id=$1 AND followee_id=$2`
+	result, err := pg.db.Exec(query, followerId, followeeId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (pg *PostgresSocialStore) IsFollowing(followerId, followeeId int) (bool, error) {
+	var following bool
+	query := `SELECT EXISTS (SELECT 1 FROM follows f WHERE f.follower_id=$1 AND f.followee_id=$2 AND ` + approvedFollow + `)`
+	err := pg.db.QueryRow(query, followerId, followeeId).Scan(&following)
+	return following, err
+}
+
+// GetProfile returns the profile of username as seen by viewerId. Profiles
+// the viewer may not see only expose the username and visibility.
+func (pg *PostgresSocialStore) GetProfile(username string, viewerId int) (*Profile, error) {
+	p := &Profile{}
+	var following bool
+	query := `
+	SELECT u.id,u.username,u.bio,u.profile_visibility,u.createdAT,
+		(SELECT COUNT(*) FROM follows f WHERE f.followee_id=u.id AND ` + approvedFollow + `),
+		(SELECT COUNT(*) FROM follows f WHERE f.follower_id=u.id AND ` + approvedFollow + `),
+		EXISTS (SELECT 1 FROM follows f WHERE f.follower_id=$2 AND f.followee_id=u.id AND ` + approvedFollow + `)
+	FROM users u WHERE u.username=$1 AND ` + activeUser
+	err := pg.db.QueryRow(query, username, viewerId).Scan(&p.Id, &p.Username, &p.Bio, &p.ProfileVisibility, &p.CreatedAt,
+		&p.Followers, &p.Following, &following)
+	if err != nil {
+		return nil, err
+	}
+	if !p.ProfileVisibility.VisibleTo(p.Id, viewerId, following) {
+		p.Bio, p.Followers, p.Following, p.Restricted = "", 0, 0, true
+	}
+	return p, nil
+}
+
+func (pg *PostgresSocialStore) GetFollowers(userId int) ([]Follow, error) {
+	return pg.getFollows(`
+	SELECT u.id,u.username,f.createdAT FROM follows f
+	JOIN users u ON u.id=f.follower_id
+	WHERE f.followee_id=$1 AND `+approvedFollow+` AND `+activeUser+` ORDER BY f.createdAT DESC`, userId)
+}
+
+func (pg *PostgresSocialStore) GetFollowing(userId int) ([]Follow, error) {
+	return pg.getFollows(`
+	SELECT u.id,u.username,f.createdAT FROM follows f
+	JOIN users u ON u.id=f.followee_id
+	WHERE f.follower_id=$1 AND `+approvedFollow+` AND `+activeUser+` ORDER BY f.createdAT DESC`, userId)
+}
+
+// GetFollowRequests lists the pending follow requests of userId, newest
+// first.
+func (pg *PostgresSocialStore) GetFollowRequests(userId int) ([]Follow, error) {
+	return pg.getFollows(`
+	SELECT u.id,u.username,f.createdAT FROM follows f
+	JOIN users u ON u.id=f.follower_id
+	WHERE f.followee_id=$1 AND f.approved_at IS NULL AND `+activeUser+` ORDER BY f.createdAT DESC`, userId)
+}
+
+func (pg *PostgresSocialStore) getFollows(query string, userId int) ([]Follow, error) {
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []Follow{}
+	for rows.Next() {
+		var f Follow
+		err := rows.Scan(&f.UserId, &f.Username, &f.FollowedAt)
+		if err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+	return follows, rows.Err()
+}
+
+// GetFeed returns the completed workouts of the users userId follows with an
+// approved follow, newest
+// first, starting after cursor. The feed is built on read: the follows
+// primary key yields the followees and workouts_feed_idx walks each of their
+// workouts in order. The returned cursor is nil on the last page.
+func (pg *PostgresSocialStore) GetFeed(userId int, cursor *FeedCursor, limit int) ([]FeedItem, *FeedCursor, error) {
+	var after *time.Time
+	afterId := 0
+	if cursor != nil {
+		after, afterId = &cursor.CreatedAt, cursor.WorkoutId
+	}
+
+	// followers see public and followers-only workouts, never private ones
+	query := `
+	SELECT ` + workoutSummaryColumns + `
+	FROM follows f
+	JOIN users u ON u.id=f.followee_id
+	JOIN workouts w ON w.user_id=f.followee_id
+	WHERE f.follower_id=$1 AND ` + approvedFollow + ` AND ` + activeUser + ` AND u.profile_visibility<>'private' AND w.visibility<>'private'
+		AND ` + completedWorkout + `
+		AND ($2::timestamptz IS NULL OR (w.createdAT,w.id) < ($2::timestamptz,$3))
+	ORDER BY w.createdAT DESC,w.id DESC
+	LIMIT $4`
+	rows, err := pg.db.Query(query, userId, after, afterId, limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	items := []FeedItem{}
+	for rows.Next() {
+		item, err := scanFeedItem(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(items) <= limit {
+		return items, nil, nil
+	}
+	items = items[:limit]
+	last := items[limit-1]
+	return items, &FeedCursor{CreatedAt: last.CreatedAt, WorkoutId: last.WorkoutId}, nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisibleTo(t *testing.T) {
+	tests := []struct {
+		name       string
+		visibility Visibility
+		viewerId   int
+		following  bool
+		want       bool
+	}{
+		{name: "public to anonymous", visibility: VisibilityPublic, viewerId: 0, want: true},
+		{name: "followers to anonymous", visibility: VisibilityFollowers, viewerId: 0, want: false},
+		{name: "followers to stranger", visibility: VisibilityFollowers, viewerId: 2, want: false},
+		{name: "followers to follower", visibility: VisibilityFollowers, viewerId: 2, following: true, want: true},
+		{name: "private to follower", visibility: VisibilityPrivate, viewerId: 2, following: true, want: false},
+		{name: "private to owner", visibility: VisibilityPrivate, viewerId: 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.visibility.VisibleTo(1, tt.viewerId, tt.following))
+		})
+	}
+}
+
+func TestVisibilityRestrict(t *testing.T) {
+	assert.Equal(t, VisibilityFollowers, VisibilityPublic.Restrict(VisibilityFollowers))
+	assert.Equal(t, VisibilityPrivate, VisibilityPrivate.Restrict(VisibilityPublic))
+	assert.Equal(t, VisibilityPublic, VisibilityPublic.Restrict(VisibilityPublic))
+
+	_, err := ParseVisibility("friends")
+	assert.Error(t, err)
+	v, err := ParseVisibility("")
+	require.NoError(t, err)
+	assert.Equal(t, Visibility(""), v)
+}
+
+func TestFeedCursor(t *testing.T) {
+	cursor := FeedCursor{CreatedAt: time.Date(2024, 3, 4, 5, 6, 7, 891011000, time.UTC), WorkoutId: 42}
+
+	decoded, err := DecodeFeedCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, 42, decoded.WorkoutId)
+
+	for _, value := range []string{"not base64!", "bm8tc2VwYXJhdG9y", "MjAyNC0wMy0wNHw0Mg"} {
+		_, err := DecodeFeedCursor(value)
+		assert.ErrorIs(t, err, ErrInvalidCursor, value)
+	}
+}
+
+func TestFollowRequiresApproval(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	suffix := time.Now().UnixNano()
+	userStore := NewPostgresUserStore(db)
+	workoutStore := NewPostgresWorkoutStore(db)
+	socialStore := NewPostgresSocialStore(db)
+
+	owner := &User{
+		Username:          fmt.Sprintf("guarded_%d", suffix),
+		Email:             fmt.Sprintf("guarded_%d@example.com", suffix),
+		ProfileVisibility: VisibilityFollowers,
+	}
+	require.NoError(t, owner.PasswordHash.Set("correct horse battery"))
+	owner, err := userStore.CreateUser(owner)
+	require.NoError(t, err)
+	follower := createTestUser(t, userStore, fmt.Sprintf("requester_%d", suffix))
+
+	workout, err := workoutStore.CreateWorkout(&Workout{
+		UserId:          owner.Id,
+		Title:           "Deadlifts",
+		DurationMinutes: 45,
+		Visibility:      VisibilityFollowers,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Deadlift", Sets: 5, Reps: IntPtr(3), Weight: FloatPtr(140), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	approved, err := socialStore.Follow(follower.Id, owner.Id)
+	require.NoError(t, err)
+	assert.False(t, approved)
+
+	// a pending request grants nothing
+	visible, err := workoutStore.CanViewWorkout(int64(workout.Id), follower.Id)
+	require.NoError(t, err)
+	assert.False(t, visible)
+	feed, _, err := socialStore.GetFeed(follower.Id, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, feed)
+	profile, err := socialStore.GetProfile(owner.Username, follower.Id)
+	require.NoError(t, err)
+	assert.True(t, profile.Restricted)
+
+	requests, err := socialStore.GetFollowRequests(owner.Id)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, follower.Id, requests[0].UserId)
+
+	require.NoError(t, socialStore.ApproveFollow(follower.Id, owner.Id))
+	assert.ErrorIs(t, socialStore.ApproveFollow(follower.Id, owner.Id), sql.ErrNoRows)
+
+	visible, err = workoutStore.CanViewWorkout(int64(workout.Id), follower.Id)
+	require.NoError(t, err)
+	assert.True(t, visible)
+	feed, _, err = socialStore.GetFeed(follower.Id, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, feed, 1)
+	assert.Equal(t, workout.Id, feed[0].WorkoutId)
+	profile, err = socialStore.GetProfile(owner.Username, follower.Id)
+	require.NoError(t, err)
+	assert.False(t, profile.Restricted)
+	assert.Equal(t, 1, profile.Followers)
+
+	// following again keeps the approval, a rejected request is removed
+	approved, err = socialStore.Follow(follower.Id, owner.Id)
+	require.NoError(t, err)
+	assert.True(t, approved)
+	other := createTestUser(t, userStore, fmt.Sprintf("rejected_%d", suffix))
+	_, err = socialStore.Follow(other.Id, owner.Id)
+	require.NoError(t, err)
+	require.NoError(t, socialStore.RejectFollow(other.Id, owner.Id))
+	requests, err = socialStore.GetFollowRequests(owner.Id)
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+}
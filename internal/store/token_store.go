@@ -0,0 +1,43 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+)
+
+type PostgresTokenStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+	return &PostgresTokenStore{db: db}
+}
+
+type TokenStore interface {
+	Insert(token *tokens.Token) error
+	CreateNewToken(userId int, ttl time.Duration, scope string) (*tokens.Token, error)
+	DeleteAllTokensForUser(userId int, scope string) error
+}
+
+func (pg *PostgresTokenStore) CreateNewToken(userId int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userId, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.Insert(token)
+	return token, err
+}
+
+func (pg *PostgresTokenStore) Insert(token *tokens.Token) error {
+	query := `INSERT INTO tokens (hash,user_id,expiry,scope) VALUES ($1,$2,$3,$4)`
+	_, err := pg.db.Exec(query, token.Hash, token.UserId, token.Expiry, token.Scope)
+	return err
+}
+
+func (pg *PostgresTokenStore) DeleteAllTokensForUser(userId int, scope string) error {
+	query := `DELETE FROM tokens WHERE scope=$1 AND user_id=$2`
+	_, err := pg.db.Exec(query, scope, userId)
+	return err
+}
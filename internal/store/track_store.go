@@ -0,0 +1,102 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// trackPointBatch bounds the rows per INSERT so an imported track stays well
+// below the bind parameter limit of a single statement.
+const trackPointBatch = 1000
+
+type TrackPoint struct {
+	Seq            int       `json:"seq"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	Latitude       *float64  `json:"latitude"`
+	Longitude      *float64  `json:"longitude"`
+	Elevation      *float64  `json:"elevation_meters"`
+	HeartRate      *int      `json:"heart_rate"`
+	DistanceMeters *float64  `json:"distance_meters"`
+}
+
+// CreateWorkoutWithTrack creates an imported workout and stores the raw
+// points of its recorded track in the same transaction.
+func (pg *PostgresWorkoutStore) CreateWorkoutWithTrack(workout *Workout, points []TrackPoint) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = createWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	if workout.StartedAt != nil && workout.FinishedAt != nil {
+		_, err = tx.Exec(`UPDATE workouts SET started_at=$1,finished_at=$2 WHERE id=$3`, workout.StartedAt, workout.FinishedAt, workout.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = insertTrackPoints(tx, workout.Id, points)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+func insertTrackPoints(tx *sql.Tx, workoutId int, points []TrackPoint) error {
+	for start := 0; start < len(points); start += trackPointBatch {
+		end := min(start+trackPointBatch, len(points))
+
+		var values []string
+		args := []interface{}{workoutId}
+		for i := start; i < end; i++ {
+			p := &points[i]
+			p.Seq = i + 1
+			n := len(args)
+			values = append(values, fmt.Sprintf("($1,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+			args = append(args, p.Seq, p.RecordedAt, p.Latitude, p.Longitude, p.Elevation, p.HeartRate, p.DistanceMeters)
+		}
+
+		query := `
+		INSERT INTO workout_track_points (workout_id,seq,recorded_at,latitude,longitude,elevation_meters,heart_rate,distance_meters)
+		VALUES ` + strings.Join(values, ",")
+		_, err := tx.Exec(query, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pg *PostgresWorkoutStore) GetWorkoutTrack(id int64) ([]TrackPoint, error) {
+	query := `
+	SELECT seq,recorded_at,latitude,longitude,elevation_meters,heart_rate,distance_meters
+	FROM workout_track_points WHERE workout_id=$1 ORDER BY seq`
+	rows, err := pg.db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []TrackPoint{}
+	for rows.Next() {
+		var p TrackPoint
+		err := rows.Scan(&p.Seq, &p.RecordedAt, &p.Latitude, &p.Longitude, &p.Elevation, &p.HeartRate, &p.DistanceMeters)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
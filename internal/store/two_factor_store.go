@@ -0,0 +1,226 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/tokens"
+)
+
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// TwoFactor is the TOTP enrollment of a user. It protects logins once it is
+// confirmed with a first code.
+type TwoFactor struct {
+	UserId      int
+	Secret      string
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
+
+func (tf *TwoFactor) Enabled() bool {
+	return tf.ConfirmedAt != nil
+}
+
+type PostgresTwoFactorStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{db: db}
+}
+
+type TwoFactorStore interface {
+	BeginEnrollment(userId int, secret string) error
+	GetTwoFactor(userId int) (*TwoFactor, error)
+	IsEnabled(userId int) (bool, error)
+	ConfirmEnrollment(userId int, step int64, recoveryCodes []string) error
+	UseStep(userId int, step int64) (bool, error)
+	UseRecoveryCode(userId int, code string) (bool, error)
+	ReplaceRecoveryCodes(userId int, recoveryCodes []string) error
+	Disable(userId int) error
+	CreatePendingLogin(userId int, scope string, ttl time.Duration) (*tokens.Token, error)
+	ConsumePendingLogin(plaintextToken string) (int, string, error)
+}
+
+// BeginEnrollment stores a new unconfirmed secret, replacing one of an
+// enrollment that was never confirmed.
+func (pg *PostgresTwoFactorStore) BeginEnrollment(userId int, secret string) error {
+	query := `
+	INSERT INTO user_two_factor (user_id,secret) VALUES ($1,$2)
+	ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret,last_step=0,createdAT=CURRENT_TIMESTAMP
+	WHERE user_two_factor.confirmed_at IS NULL`
+	result, err := pg.db.Exec(query, userId, secret)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (pg *PostgresTwoFactorStore) GetTwoFactor(userId int) (*TwoFactor, error) {
+	tf := &TwoFactor{UserId: userId}
+	query := `SELECT secret,confirmed_at,last_step FROM user_two_factor WHERE user_id=$1`
+	err := pg.db.QueryRow(query, userId).Scan(&tf.Secret, &tf.ConfirmedAt, &tf.LastStep)
+	if err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+func (pg *PostgresTwoFactorStore) IsEnabled(userId int) (bool, error) {
+	var enabled bool
+	query := `SELECT EXISTS (SELECT 1 FROM user_two_factor WHERE user_id=$1 AND confirmed_at IS NOT NULL)`
+	err := pg.db.QueryRow(query, userId).Scan(&enabled)
+	return enabled, err
+}
+
+func insertRecoveryCodes(tx *sql.Tx, userId int, recoveryCodes []string) error {
+	_, err := tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`INSERT INTO two_factor_recovery_codes (user_id,code_hash) VALUES ($1,$2)`, userId, tokens.Hash(code))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfirmEnrollment enables two-factor authentication with the step of the
+// first code and stores the hashes of the recovery codes.
+func (pg *PostgresTwoFactorStore) ConfirmEnrollment(userId int, step int64, recoveryCodes []string) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE user_two_factor SET confirmed_at=CURRENT_TIMESTAMP,last_step=$1
+	WHERE user_id=$2 AND confirmed_at IS NULL`
+	result, err := tx.Exec(query, step, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTwoFactorEnabled
+	}
+	err = insertRecoveryCodes(tx, userId, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseStep records that the code of step was used. It returns false when a
+// code of this or a later step was used before, so codes cannot be replayed.
+func (pg *PostgresTwoFactorStore) UseStep(userId int, step int64) (bool, error) {
+	query := `UPDATE user_two_factor SET last_step=$1 WHERE user_id=$2 AND last_step < $1`
+	result, err := pg.db.Exec(query, step, userId)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// UseRecoveryCode spends one of the user's recovery codes.
+func (pg *PostgresTwoFactorStore) UseRecoveryCode(userId int, code string) (bool, error) {
+	query := `
+	UPDATE two_factor_recovery_codes SET used_at=CURRENT_TIMESTAMP
+	WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`
+	result, err := pg.db.Exec(query, userId, tokens.Hash(code))
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (pg *PostgresTwoFactorStore) ReplaceRecoveryCodes(userId int, recoveryCodes []string) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertRecoveryCodes(tx, userId, recoveryCodes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresTwoFactorStore) Disable(userId int) error {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM user_two_factor WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreatePendingLogin returns the token a login that passed the password
+// check is completed with. scope is ScopeTwoFactor or ScopeTwoFactorJWT.
+func (pg *PostgresTwoFactorStore) CreatePendingLogin(userId int, scope string, ttl time.Duration) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userId, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	query := `INSERT INTO tokens (hash,user_id,expiry,scope) VALUES ($1,$2,$3,$4)`
+	_, err = pg.db.Exec(query, token.Hash, token.UserId, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ConsumePendingLogin deletes a pending login token and returns its user and
+// scope. Tokens work for a single attempt: a wrong code means starting over
+// with the password, which stops guessing codes.
+func (pg *PostgresTwoFactorStore) ConsumePendingLogin(plaintextToken string) (int, string, error) {
+	var userId int
+	var scope string
+	query := `
+	DELETE FROM tokens WHERE hash=$1 AND scope IN ($2,$3) AND expiry > $4
+	RETURNING user_id,scope`
+	err := pg.db.QueryRow(query, tokens.Hash(plaintextToken), tokens.ScopeTwoFactor, tokens.ScopeTwoFactorJWT,
+		time.Now()).Scan(&userId, &scope)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return userId, scope, nil
+}
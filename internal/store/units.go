@@ -0,0 +1,31 @@
+package store
+
+import "github.com/Naveenravi07/go-api/internal/units"
+
+// ConvertWeights rewrites every weight of the workout from one unit to
+// another and records the unit the weights are now expressed in.
+func (w *Workout) ConvertWeights(from, to units.WeightUnit) {
+	for i := range w.Entries {
+		w.Entries[i].ConvertWeights(from, to)
+	}
+	w.WeightUnit = to
+}
+
+func (e *WorkoutEntry) ConvertWeights(from, to units.WeightUnit) {
+	e.Weight = units.ConvertPtr(e.Weight, from, to)
+	for i := range e.SetDetails {
+		e.SetDetails[i].Weight = units.ConvertPtr(e.SetDetails[i].Weight, from, to)
+	}
+}
+
+func (s *WorkoutSession) ConvertWeights(from, to units.WeightUnit) {
+	for i := range s.Sets {
+		s.Sets[i].ConvertWeights(from, to)
+	}
+	s.WeightUnit = to
+}
+
+func (s *SessionSet) ConvertWeights(from, to units.WeightUnit) {
+	s.Weight = units.ConvertPtr(s.Weight, from, to)
+	s.WeightUnit = to
+}
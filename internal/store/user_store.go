@@ -3,47 +3,51 @@ package store
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/Naveenravi07/go-api/internal/tokens"
+	"github.com/Naveenravi07/go-api/internal/units"
 )
 
-type password struct {
-	plaintext *string
-	hash      []byte
+type User struct {
+	Id            int              `json:"id"`
+	Username      string           `json:"username"`
+	Email         string           `json:"email"`
+	PasswordHash  password         `json:"-"`
+	Bio           string           `json:"bio"`
+	PreferredUnit units.WeightUnit `json:"preferred_unit"`
+	// ProfileVisibility also caps the visibility of the user's workouts
+	ProfileVisibility Visibility `json:"profile_visibility"`
+	// EmailVerifiedAt is reset whenever the email changes
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
-func (p *password) Set(plainTextpassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plainTextpassword), 12)
-	if err != nil {
-		return err
-	}
-	p.hash = hash
-	p.plaintext = &plainTextpassword
-	return nil
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
-func (p *password) Matches(password string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(password))
-	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err //internal server error
-		}
-	}
-	return true, nil
+// ErrTokenInvalid is returned when a verification or password reset token
+// is unknown, expired or was already used.
+var ErrTokenInvalid = errors.New("invalid or expired token")
+
+var AnonymousUser = &User{}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
 }
 
-type User struct {
-	Id           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash password  `json:"-"`
-	Bio          string    `json:"bio"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+func userEvent(eventType string, user *User) Event {
+	return Event{
+		Type:          eventType,
+		AggregateType: AggregateUser,
+		AggregateId:   user.Id,
+		UserId:        user.Id,
+		Data:          user,
+		OccurredAt:    time.Now().UTC(),
+	}
 }
 
 type PostgresUserStore struct {
@@ -58,11 +62,61 @@ type UserStore interface {
 	CreateUser(*User) (*User, error)
 	GetUserByUsername(username string) (*User, error)
 	UpdateUser(*User) error
+	GetUserToken(scope, plaintextToken string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserById(id int) (*User, error)
+	VerifyEmail(plaintextToken string) (*User, error)
+	ResetPassword(plaintextToken, newPassword string) (*User, error)
+	UpdatePasswordHash(*User) error
+	DeleteUser(userId int) (time.Time, error)
+	GetDeletedUser(username string) (*User, error)
+	RestoreUser(userId int) error
+	PurgeDeletedUsers(deletedBefore time.Time, limit int) (int, error)
+}
+
+// activeUser leaves out accounts that are scheduled for deletion.
+const activeUser = `u.deleted_at IS NULL`
+
+const userColumns = `u.id,u.username,u.email,u.password_hash,u.bio,u.preferred_unit,u.profile_visibility,u.email_verified_at,u.createdAT,u.updatedAt`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	user := &User{}
+	err := row.Scan(&user.Id, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.PreferredUnit,
+		&user.ProfileVisibility, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (pg *PostgresUserStore) CreateUser(user *User) (*User, error) {
-	query := `INSERT INTO users (username,email,password_hash,bio) VALUES ($1,$2,$3,$4) RETURNING id`
-	err := pg.db.QueryRow(query, user.Username, user.Email, user.PasswordHash.plaintext, user.Bio).Scan(&user.Id)
+	if len(user.PasswordHash.hash) == 0 {
+		return nil, ErrPasswordNotSet
+	}
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if user.PreferredUnit == "" {
+		user.PreferredUnit = units.Kilograms
+	}
+	if user.ProfileVisibility == "" {
+		user.ProfileVisibility = VisibilityPublic
+	}
+	query := `INSERT INTO users (username,email,password_hash,bio,preferred_unit,profile_visibility) VALUES ($1,$2,$3,$4,$5,$6) RETURNING id,createdAT,updatedAt`
+	err = tx.QueryRow(query, user.Username, user.Email, user.PasswordHash.hash, user.Bio, user.PreferredUnit, user.ProfileVisibility).Scan(&user.Id, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertOutboxEvent(tx, userEvent(EventUserCreated, user))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
@@ -70,11 +124,8 @@ func (pg *PostgresUserStore) CreateUser(user *User) (*User, error) {
 }
 
 func (pg *PostgresUserStore) GetUserByUsername(usermame string) (*User, error) {
-	user := &User{}
-	query := `SELECT id,username,email,password_hash,bio,createdAT,updatedAt from users where username=$1`
-	err := pg.db.QueryRow(query, usermame).Scan(
-		&user.Id, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.username=$1 AND ` + activeUser
+	user, err := scanUser(pg.db.QueryRow(query, usermame))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -86,8 +137,186 @@ func (pg *PostgresUserStore) GetUserByUsername(usermame string) (*User, error) {
 }
 
 func (pg *PostgresUserStore) UpdateUser(user *User) error {
-	query := `UPDATE users SET username=$1,email=$2,bio=$3,updatedAt=CURRENT_TIMESTAMP WHERE id=$4 RETURNING updatedAt`
-	result, err := pg.db.Exec(query, user.Username, user.Email, user.Bio, user.Id)
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousEmail string
+	err = tx.QueryRow(`SELECT email FROM users WHERE id=$1 FOR UPDATE`, user.Id).Scan(&previousEmail)
+	if err == sql.ErrNoRows {
+		return errors.New("No user found and updated")
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE users SET username=$1,email=$2,bio=$3,preferred_unit=COALESCE(NULLIF($4,''),preferred_unit),
+		profile_visibility=COALESCE(NULLIF($5,''),profile_visibility),
+		email_verified_at=CASE WHEN email=$2 THEN email_verified_at END,updatedAt=CURRENT_TIMESTAMP
+	WHERE id=$6
+	RETURNING preferred_unit,profile_visibility,email_verified_at,createdAT,updatedAt`
+	err = tx.QueryRow(query, user.Username, user.Email, user.Bio, user.PreferredUnit, user.ProfileVisibility, user.Id).Scan(
+		&user.PreferredUnit, &user.ProfileVisibility, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	// tokens mailed to the previous address must not work for the new one
+	if user.Email != previousEmail {
+		query = `DELETE FROM tokens WHERE user_id=$1 AND scope IN ($2,$3)`
+		_, err = tx.Exec(query, user.Id, tokens.ScopeEmailVerification, tokens.ScopePasswordReset)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertOutboxEvent(tx, userEvent(EventUserUpdated, user))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (pg *PostgresUserStore) GetUserToken(scope, plaintextToken string) (*User, error) {
+	tokenHash := tokens.Hash(plaintextToken)
+	query := `
+	SELECT ` + userColumns + `
+	FROM users u
+	INNER JOIN tokens t ON t.user_id = u.id
+	WHERE t.hash=$1 AND t.scope=$2 AND t.expiry > $3 AND ` + activeUser
+
+	user, err := scanUser(pg.db.QueryRow(query, tokenHash, scope, time.Now()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByEmail returns nil when no account uses email. Emails are compared
+// case insensitively.
+func (pg *PostgresUserStore) GetUserByEmail(email string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users u WHERE LOWER(u.email)=LOWER($1) AND ` + activeUser
+	user, err := scanUser(pg.db.QueryRow(query, email))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserById returns nil when the user does not exist.
+func (pg *PostgresUserStore) GetUserById(id int) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.id=$1 AND ` + activeUser
+	user, err := scanUser(pg.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// consumeToken deletes a valid token of scope and returns its user, so that
+// every token can only be redeemed once.
+func consumeToken(tx *sql.Tx, scope, plaintextToken string) (int, error) {
+	var userId int
+	query := `DELETE FROM tokens WHERE hash=$1 AND scope=$2 AND expiry > $3 RETURNING user_id`
+	err := tx.QueryRow(query, tokens.Hash(plaintextToken), scope, time.Now()).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, ErrTokenInvalid
+	}
+	return userId, err
+}
+
+func (pg *PostgresUserStore) VerifyEmail(plaintextToken string) (*User, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userId, err := consumeToken(tx, tokens.ScopeEmailVerification, plaintextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE users u SET email_verified_at=COALESCE(email_verified_at,CURRENT_TIMESTAMP),updatedAt=CURRENT_TIMESTAMP
+	WHERE u.id=$1
+	RETURNING ` + userColumns
+	user, err := scanUser(tx.QueryRow(query, userId))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertOutboxEvent(tx, userEvent(EventUserUpdated, user))
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+// ResetPassword sets a new password for the user of a password reset token.
+// All other reset tokens and every authentication and refresh token of the
+// user are revoked, signing out sessions that may have used the old password.
+// Issued access JWTs stay valid until they expire.
+func (pg *PostgresUserStore) ResetPassword(plaintextToken, newPassword string) (*User, error) {
+	var hash password
+	err := hash.Set(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userId, err := consumeToken(tx, tokens.ScopePasswordReset, plaintextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE users u SET password_hash=$1,updatedAt=CURRENT_TIMESTAMP
+	WHERE u.id=$2
+	RETURNING ` + userColumns
+	user, err := scanUser(tx.QueryRow(query, hash.hash, userId))
+	if err != nil {
+		return nil, err
+	}
+
+	query = `DELETE FROM tokens WHERE user_id=$1 AND scope IN ($2,$3)`
+	_, err = tx.Exec(query, userId, tokens.ScopePasswordReset, tokens.ScopeAuth)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`DELETE FROM refresh_tokens WHERE user_id=$1`, userId)
+	if err != nil {
+		return nil, err
+	}
+	return user, tx.Commit()
+}
+
+// UpdatePasswordHash stores the current hash of user's password, e.g. after
+// it was rehashed with new parameters. Unlike a password change it keeps the
+// user's tokens.
+func (pg *PostgresUserStore) UpdatePasswordHash(user *User) error {
+	if len(user.PasswordHash.hash) == 0 {
+		return ErrPasswordNotSet
+	}
+	query := `UPDATE users SET password_hash=$1 WHERE id=$2`
+	result, err := pg.db.Exec(query, user.PasswordHash.hash, user.Id)
 	if err != nil {
 		return err
 	}
@@ -96,7 +325,168 @@ func (pg *PostgresUserStore) UpdateUser(user *User) error {
 		return err
 	}
 	if rows == 0 {
-		return errors.New("No user found and updated")
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUser schedules the account for deletion and signs it out everywhere.
+// The account is hidden right away and can be restored until it is purged.
+// It returns when the deletion was scheduled.
+func (pg *PostgresUserStore) DeleteUser(userId int) (time.Time, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	query := `UPDATE users SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL RETURNING deleted_at`
+	err = tx.QueryRow(query, userId).Scan(&deletedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, err = tx.Exec(`DELETE FROM tokens WHERE user_id=$1`, userId)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, err = tx.Exec(`DELETE FROM refresh_tokens WHERE user_id=$1`, userId)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return deletedAt, tx.Commit()
+}
+
+// GetDeletedUser returns the account of username if it is scheduled for
+// deletion, nil otherwise.
+func (pg *PostgresUserStore) GetDeletedUser(username string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.username=$1 AND u.deleted_at IS NOT NULL`
+	user, err := scanUser(pg.db.QueryRow(query, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (pg *PostgresUserStore) RestoreUser(userId int) error {
+	result, err := pg.db.Exec(`UPDATE users SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL`, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeDeletedUsers removes up to limit accounts deleted before
+// deletedBefore for good and returns how many it removed. Rows keyed by the
+// user cascade; purgeUser removes the personal data stored elsewhere.
+// Accounts another instance is purging are skipped.
+func (pg *PostgresUserStore) PurgeDeletedUsers(deletedBefore time.Time, limit int) (int, error) {
+	purged := 0
+	for purged < limit {
+		tx, err := pg.db.Begin()
+		if err != nil {
+			return purged, err
+		}
+		var userId int
+		var username, email string
+		query := `
+		SELECT id,username,email FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		ORDER BY deleted_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+		err = tx.QueryRow(query, deletedBefore).Scan(&userId, &username, &email)
+		if err == sql.ErrNoRows {
+			tx.Rollback()
+			return purged, nil
+		}
+		if err == nil {
+			err = purgeUser(tx, userId, username, email)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// userEventsQuery deletes the events about the user that were queued for or
+// delivered to other users: its follows, comments and reactions. The event
+// data is found at path of the payload.
+func userEventsQuery(table, path string) string {
+	data := `payload` + path
+	return `
+	DELETE FROM ` + table + `
+	WHERE (event_type=$2 AND (` + data + `->>'follower_id')::bigint=$1)
+		OR (event_type IN ($3,$4) AND (` + data + `->>'user_id')::bigint=$1)`
+}
+
+func purgeUser(tx *sql.Tx, userId int, username, email string) error {
+	var orgIds []int64
+	rows, err := tx.Query(`SELECT organization_id FROM organization_members WHERE user_id=$1`, userId)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		orgIds = append(orgIds, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	queries := []struct {
+		query string
+		args  []interface{}
+	}{
+		// the user's own events and those about its account
+		{`DELETE FROM outbox WHERE user_id=$1 OR (aggregate_type=$2 AND aggregate_id=$1)`,
+			[]interface{}{userId, AggregateUser}},
+		{userEventsQuery("outbox", ""),
+			[]interface{}{userId, EventUserFollowed, EventCommentCreated, EventReactionAdded}},
+		{userEventsQuery("webhook_deliveries", "->'data'"),
+			[]interface{}{userId, EventUserFollowed, EventCommentCreated, EventReactionAdded}},
+		{userEventsQuery("webhook_jobs", "->'data'"),
+			[]interface{}{userId, EventUserFollowed, EventCommentCreated, EventReactionAdded}},
+		{`DELETE FROM organization_invitations WHERE LOWER(email)=LOWER($1)`, []interface{}{email}},
+		{`DELETE FROM login_failures WHERE key=$1`, []interface{}{"login:" + strings.ToLower(username)}},
+		// workouts, entries, comments and everything else keyed by the user
+		// cascade
+		{`DELETE FROM users WHERE id=$1`, []interface{}{userId}},
+	}
+	for _, q := range queries {
+		_, err = tx.Exec(q.query, q.args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// organizations the user was the last member of
+	for _, orgId := range orgIds {
+		query := `DELETE FROM organizations o WHERE o.id=$1 AND NOT EXISTS (SELECT 1 FROM organization_members m WHERE m.organization_id=o.id)`
+		_, err = tx.Exec(query, orgId)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,54 @@
+package store
+
+import "errors"
+
+// Visibility controls who besides the owner may see a profile or a workout.
+type Visibility string
+
+const (
+	VisibilityPublic    Visibility = "public"
+	VisibilityFollowers Visibility = "followers"
+	VisibilityPrivate   Visibility = "private"
+)
+
+// visibilityRank orders the settings from the least to the most restrictive.
+var visibilityRank = map[Visibility]int{
+	VisibilityPublic:    0,
+	VisibilityFollowers: 1,
+	VisibilityPrivate:   2,
+}
+
+// ParseVisibility validates a visibility setting. An empty value is kept so
+// updates can leave the current setting unchanged.
+func ParseVisibility(value string) (Visibility, error) {
+	v := Visibility(value)
+	if _, ok := visibilityRank[v]; !ok && v != "" {
+		return "", errors.New("visibility must be one of public, followers or private")
+	}
+	return v, nil
+}
+
+// Restrict returns the more restrictive of both settings. A workout is never
+// visible to more people than the profile of its owner.
+func (v Visibility) Restrict(other Visibility) Visibility {
+	if visibilityRank[other] > visibilityRank[v] {
+		return other
+	}
+	return v
+}
+
+// VisibleTo reports whether content with this visibility, owned by ownerId,
+// may be shown to viewerId. Anonymous viewers have the id 0. following must
+// only be set for an approved follow, never for a pending request.
+func (v Visibility) VisibleTo(ownerId, viewerId int, following bool) bool {
+	if viewerId != 0 && viewerId == ownerId {
+		return true
+	}
+	switch v {
+	case VisibilityPublic:
+		return true
+	case VisibilityFollowers:
+		return viewerId != 0 && following
+	}
+	return false
+}
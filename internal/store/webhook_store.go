@@ -0,0 +1,258 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+type WebhookEndpoint struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the endpoint wants events of the given type.
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	for _, ev := range e.Events {
+		if ev == "*" || ev == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	Id         int             `json:"id"`
+	EndpointId int             `json:"endpoint_id"`
+	EventId    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempt    int             `json:"attempt"`
+	StatusCode *int            `json:"status_code"`
+	Error      *string         `json:"error"`
+	Succeeded  bool            `json:"succeeded"`
+	DurationMs int             `json:"duration_ms"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// WebhookJob is a pending delivery of one event to one endpoint.
+type WebhookJob struct {
+	Id        int64
+	Endpoint  WebhookEndpoint
+	EventId   string
+	EventType string
+	Payload   json.RawMessage
+	// Attempts counts the attempt being made since the job was claimed
+	Attempts int
+}
+
+type PostgresWebhookStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookStore(db *sql.DB) *PostgresWebhookStore {
+	return &PostgresWebhookStore{db: db}
+}
+
+type WebhookStore interface {
+	CreateEndpoint(*WebhookEndpoint) (*WebhookEndpoint, error)
+	GetEndpointsForUser(userId int) ([]WebhookEndpoint, error)
+	GetEndpointById(id int64) (*WebhookEndpoint, error)
+	DeleteEndpoint(id int64, userId int) error
+	RecordDelivery(*WebhookDelivery) error
+	GetDeliveries(endpointId int64, limit int) ([]WebhookDelivery, error)
+	EnqueueJobs(userId int, eventId, eventType string, payload []byte) (int, error)
+	ClaimJobs(limit int, lease time.Duration) ([]WebhookJob, error)
+	CompleteJob(id int64) error
+	RetryJob(id int64, reason string, nextAttemptAt time.Time) error
+	FailJob(id int64, reason string) error
+}
+
+func (pg *PostgresWebhookStore) CreateEndpoint(endpoint *WebhookEndpoint) (*WebhookEndpoint, error) {
+	query := `
+	INSERT INTO webhook_endpoints (user_id,url,secret,events,active)
+	VALUES ($1,$2,$3,string_to_array($4,','),$5)
+	RETURNING id,createdAT`
+	err := pg.db.QueryRow(query, endpoint.UserId, endpoint.URL, endpoint.Secret, strings.Join(endpoint.Events, ","), endpoint.Active).
+		Scan(&endpoint.Id, &endpoint.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (pg *PostgresWebhookStore) GetEndpointsForUser(userId int) ([]WebhookEndpoint, error) {
+	query := `
+	SELECT id,user_id,url,secret,array_to_string(events,','),active,createdAT
+	FROM webhook_endpoints WHERE user_id=$1 ORDER BY id`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []WebhookEndpoint{}
+	for rows.Next() {
+		var endpoint WebhookEndpoint
+		var events string
+		err := rows.Scan(&endpoint.Id, &endpoint.UserId, &endpoint.URL, &endpoint.Secret, &events, &endpoint.Active, &endpoint.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		endpoint.Events = strings.Split(events, ",")
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, rows.Err()
+}
+
+func (pg *PostgresWebhookStore) GetEndpointById(id int64) (*WebhookEndpoint, error) {
+	query := `
+	SELECT id,user_id,url,secret,array_to_string(events,','),active,createdAT
+	FROM webhook_endpoints WHERE id=$1`
+	endpoint := &WebhookEndpoint{}
+	var events string
+	err := pg.db.QueryRow(query, id).Scan(&endpoint.Id, &endpoint.UserId, &endpoint.URL, &endpoint.Secret, &events, &endpoint.Active, &endpoint.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Events = strings.Split(events, ",")
+	return endpoint, nil
+}
+
+func (pg *PostgresWebhookStore) DeleteEndpoint(id int64, userId int) error {
+	result, err := pg.db.Exec(`DELETE FROM webhook_endpoints WHERE id=$1 AND user_id=$2`, id, userId)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("No webhook endpoint found for id ")
+	}
+	return nil
+}
+
+func (pg *PostgresWebhookStore) RecordDelivery(delivery *WebhookDelivery) error {
+	query := `
+	INSERT INTO webhook_deliveries (endpoint_id,event_id,event_type,payload,attempt,status_code,error,succeeded,duration_ms)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	RETURNING id,createdAT`
+	return pg.db.QueryRow(query, delivery.EndpointId, delivery.EventId, delivery.EventType, string(delivery.Payload),
+		delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.Succeeded, delivery.DurationMs).
+		Scan(&delivery.Id, &delivery.CreatedAt)
+}
+
+func (pg *PostgresWebhookStore) GetDeliveries(endpointId int64, limit int) ([]WebhookDelivery, error) {
+	query := `
+	SELECT id,endpoint_id,event_id,event_type,payload,attempt,status_code,error,succeeded,duration_ms,createdAT
+	FROM webhook_deliveries WHERE endpoint_id=$1
+	ORDER BY createdAT DESC, id DESC
+	LIMIT $2`
+	rows, err := pg.db.Query(query, endpointId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+		err := rows.Scan(&delivery.Id, &delivery.EndpointId, &delivery.EventId, &delivery.EventType, &payload, &delivery.Attempt,
+			&delivery.StatusCode, &delivery.Error, &delivery.Succeeded, &delivery.DurationMs, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// EnqueueJobs queues the event for every active endpoint of userId that
+// subscribes to it and returns how many jobs it queued. Queueing an event
+// twice is a no-op.
+func (pg *PostgresWebhookStore) EnqueueJobs(userId int, eventId, eventType string, payload []byte) (int, error) {
+	query := `
+	INSERT INTO webhook_jobs (endpoint_id,event_id,event_type,payload)
+	SELECT id,$2,$3,$4 FROM webhook_endpoints
+	WHERE user_id=$1 AND active AND ($3=ANY(events) OR '*'=ANY(events))
+	ON CONFLICT (endpoint_id,event_id) DO NOTHING`
+	result, err := pg.db.Exec(query, userId, eventId, eventType, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rows), nil
+}
+
+// ClaimJobs takes up to limit due jobs and hides them from other workers for
+// lease, after which a job whose worker went away is attempted again. Only
+// the oldest job of an endpoint is ever claimed, so each endpoint receives
+// its events in order and a failing endpoint holds back no other.
+func (pg *PostgresWebhookStore) ClaimJobs(limit int, lease time.Duration) ([]WebhookJob, error) {
+	query := `
+	UPDATE webhook_jobs j SET attempts=j.attempts+1, next_attempt_at=$2
+	FROM webhook_endpoints e
+	WHERE e.id=j.endpoint_id AND j.id IN (
+		SELECT q.id FROM webhook_jobs q
+		WHERE q.failed_at IS NULL AND q.next_attempt_at <= CURRENT_TIMESTAMP
+			AND NOT EXISTS (
+				SELECT 1 FROM webhook_jobs p WHERE p.endpoint_id=q.endpoint_id AND p.id<q.id AND p.failed_at IS NULL
+			)
+		ORDER BY q.id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING j.id,j.event_id,j.event_type,j.payload,j.attempts,e.id,e.user_id,e.url,e.secret`
+	rows, err := pg.db.Query(query, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []WebhookJob{}
+	for rows.Next() {
+		var job WebhookJob
+		var payload []byte
+		err := rows.Scan(&job.Id, &job.EventId, &job.EventType, &payload, &job.Attempts,
+			&job.Endpoint.Id, &job.Endpoint.UserId, &job.Endpoint.URL, &job.Endpoint.Secret)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = payload
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// CompleteJob removes a delivered job, webhook_deliveries keeps the record
+// of its attempts.
+func (pg *PostgresWebhookStore) CompleteJob(id int64) error {
+	_, err := pg.db.Exec(`DELETE FROM webhook_jobs WHERE id=$1`, id)
+	return err
+}
+
+func (pg *PostgresWebhookStore) RetryJob(id int64, reason string, nextAttemptAt time.Time) error {
+	_, err := pg.db.Exec(`UPDATE webhook_jobs SET last_error=$1, next_attempt_at=$2 WHERE id=$3`, reason, nextAttemptAt, id)
+	return err
+}
+
+// FailJob gives up on a job. It is kept for inspection and no longer holds
+// back the later jobs of its endpoint.
+func (pg *PostgresWebhookStore) FailJob(id int64, reason string) error {
+	_, err := pg.db.Exec(`UPDATE webhook_jobs SET last_error=$1, failed_at=CURRENT_TIMESTAMP WHERE id=$2`, reason, id)
+	return err
+}
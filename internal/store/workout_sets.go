@@ -0,0 +1,187 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	SetTypeWarmup  = "warmup"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+// WorkoutSet is a single performed set of a workout entry. Entries that carry
+// set details keep their aggregate sets/reps/duration/weight fields in sync
+// with them so clients that only read the aggregates keep working.
+type WorkoutSet struct {
+	Id              int      `json:"id"`
+	EntryId         int      `json:"entry_id"`
+	SetNumber       int      `json:"set_number"`
+	SetType         string   `json:"set_type"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"`
+	RPE             *float64 `json:"rpe"`
+	RIR             *int     `json:"rir"`
+	RestSeconds     *int     `json:"rest_seconds"`
+	Completed       *bool    `json:"completed"`
+}
+
+var validSetTypes = map[string]bool{
+	SetTypeWarmup:  true,
+	SetTypeWorking: true,
+	SetTypeDrop:    true,
+	SetTypeFailure: true,
+}
+
+func (s *WorkoutSet) validate() error {
+	if (s.Reps == nil) == (s.DurationSeconds == nil) {
+		return errors.New("exactly one of reps or duration_seconds is required")
+	}
+	if !validSetTypes[s.SetType] {
+		return fmt.Errorf("invalid set_type %q", s.SetType)
+	}
+	if s.RPE != nil && (*s.RPE < 1 || *s.RPE > 10) {
+		return errors.New("rpe must be between 1 and 10")
+	}
+	if s.RIR != nil && (*s.RIR < 0 || *s.RIR > 10) {
+		return errors.New("rir must be between 0 and 10")
+	}
+	return nil
+}
+
+// normalizeSets fills defaults for the set details of an entry, validates them
+// and recomputes the entry's aggregate fields from them. Entries without set
+// details are left untouched.
+func (e *WorkoutEntry) normalizeSets() error {
+	if len(e.SetDetails) == 0 {
+		return nil
+	}
+
+	for i := range e.SetDetails {
+		set := &e.SetDetails[i]
+		if set.SetNumber == 0 {
+			set.SetNumber = i + 1
+		}
+		if set.SetType == "" {
+			set.SetType = SetTypeWorking
+		}
+		if set.Completed == nil {
+			completed := true
+			set.Completed = &completed
+		}
+		if err := set.validate(); err != nil {
+			return fmt.Errorf("entry %q set %d: %w", e.ExerciseName, set.SetNumber, err)
+		}
+	}
+
+	var top *WorkoutSet
+	counted := 0
+	for i := range e.SetDetails {
+		set := &e.SetDetails[i]
+		if set.SetType == SetTypeWarmup {
+			continue
+		}
+		counted++
+		if top == nil || heavierSet(set, top) {
+			top = set
+		}
+	}
+	if top == nil {
+		// only warm-up sets were logged, describe those instead
+		top = &e.SetDetails[0]
+		counted = len(e.SetDetails)
+		for i := range e.SetDetails {
+			if heavierSet(&e.SetDetails[i], top) {
+				top = &e.SetDetails[i]
+			}
+		}
+	}
+
+	e.Sets = counted
+	e.Reps = top.Reps
+	e.DurationSeconds = top.DurationSeconds
+	e.Weight = top.Weight
+	return nil
+}
+
+// heavierSet reports whether a beats b: more weight first, then more reps or
+// a longer duration.
+func heavierSet(a, b *WorkoutSet) bool {
+	aw, bw := float64(0), float64(0)
+	if a.Weight != nil {
+		aw = *a.Weight
+	}
+	if b.Weight != nil {
+		bw = *b.Weight
+	}
+	if aw != bw {
+		return aw > bw
+	}
+	if a.Reps != nil && b.Reps != nil {
+		return *a.Reps > *b.Reps
+	}
+	if a.DurationSeconds != nil && b.DurationSeconds != nil {
+		return *a.DurationSeconds > *b.DurationSeconds
+	}
+	return false
+}
+
+func (s *WorkoutSet) equal(other *WorkoutSet) bool {
+	return s.SetNumber == other.SetNumber &&
+		s.SetType == other.SetType &&
+		equalPtr(s.Reps, other.Reps) &&
+		equalPtr(s.DurationSeconds, other.DurationSeconds) &&
+		equalPtr(s.Weight, other.Weight) &&
+		equalPtr(s.RPE, other.RPE) &&
+		equalPtr(s.RIR, other.RIR) &&
+		equalPtr(s.RestSeconds, other.RestSeconds) &&
+		equalPtr(s.Completed, other.Completed)
+}
+
+func insertEntrySets(tx *sql.Tx, entry *WorkoutEntry) error {
+	for i := range entry.SetDetails {
+		set := &entry.SetDetails[i]
+		query := `
+		INSERT INTO workout_sets (entry_id,set_number,set_type,reps,duration_seconds,weight,rpe,rir,rest_seconds,completed)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		RETURNING id`
+		err := tx.QueryRow(query, entry.Id, set.SetNumber, set.SetType, set.Reps, set.DurationSeconds, set.Weight,
+			set.RPE, set.RIR, set.RestSeconds, set.Completed).Scan(&set.Id)
+		if err != nil {
+			return err
+		}
+		set.EntryId = entry.Id
+	}
+	return nil
+}
+
+// getWorkoutSets loads the set details of every entry of a workout keyed by entry id.
+func getWorkoutSets(q querier, workoutId int64) (map[int][]WorkoutSet, error) {
+	query := `
+	SELECT s.id,s.entry_id,s.set_number,s.set_type,s.reps,s.duration_seconds,s.weight,s.rpe,s.rir,s.rest_seconds,s.completed
+	FROM workout_sets s
+	INNER JOIN workout_entries e ON e.id = s.entry_id
+	WHERE e.workout_id=$1
+	ORDER BY s.entry_id, s.set_number`
+	rows, err := q.Query(query, workoutId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := map[int][]WorkoutSet{}
+	for rows.Next() {
+		var set WorkoutSet
+		err := rows.Scan(&set.Id, &set.EntryId, &set.SetNumber, &set.SetType, &set.Reps, &set.DurationSeconds, &set.Weight,
+			&set.RPE, &set.RIR, &set.RestSeconds, &set.Completed)
+		if err != nil {
+			return nil, err
+		}
+		sets[set.EntryId] = append(sets[set.EntryId], set)
+	}
+	return sets, rows.Err()
+}
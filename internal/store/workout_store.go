@@ -3,28 +3,100 @@ package store
 import (
 	"database/sql"
 	"errors"
-	"fmt"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/units"
 )
 
+// ErrUnknownEntry is returned when an update names an entry that is not part
+// of the workout.
+var ErrUnknownEntry = errors.New("entry id must be an entry of the same workout")
+
+// querier is satisfied by both *sql.DB and *sql.Tx so reads can take part in
+// a surrounding transaction.
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
 type Workout struct {
-	Id              int            `json:"id"`
-	Title           string         `json:"title"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	Id              int              `json:"id"`
+	UserId          int              `json:"user_id"`
+	Title           string           `json:"title"`
+	Description     string           `json:"description"`
+	DurationMinutes int              `json:"duration_minutes"`
+	CaloriesBurned  int              `json:"calories_burned"`
+	StartedAt       *time.Time       `json:"started_at"`
+	FinishedAt      *time.Time       `json:"finished_at"`
+	Visibility      Visibility       `json:"visibility"`
+	WeightUnit      units.WeightUnit `json:"weight_unit"`
+	Entries         []WorkoutEntry   `json:"entries"`
+	// only set for workouts in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// only filled when a single workout is read
+	CommentCount int                  `json:"comment_count"`
+	Reactions    map[ReactionKind]int `json:"reactions"`
 }
 
 type WorkoutEntry struct {
-	Id              int      `json:"id"`
-	WorkoutId       int      `json:"workout_id"`
-	ExerciseName    string   `json:"exercise_name"`
-	Sets            int      `json:"sets"`
-	Reps            *int     `json:"reps"`
-	DurationSeconds *int     `json:"duration_seconds"`
-	Weight          *float32 `json:"weight"`
-	Notes           string   `json:"notes"`
-	OrderIndex      int      `json:"order_index"`
+	Id              int          `json:"id"`
+	WorkoutId       int          `json:"workout_id"`
+	ExerciseName    string       `json:"exercise_name"`
+	Sets            int          `json:"sets"`
+	Reps            *int         `json:"reps"`
+	DurationSeconds *int         `json:"duration_seconds"`
+	Weight          *float64     `json:"weight"`
+	Notes           string       `json:"notes"`
+	OrderIndex      int          `json:"order_index"`
+	SetDetails      []WorkoutSet `json:"set_details"`
+
+	DistanceMeters      *float64 `json:"distance_meters"`
+	AvgHeartRate        *int     `json:"avg_heart_rate"`
+	MaxHeartRate        *int     `json:"max_heart_rate"`
+	ElevationGainMeters *float64 `json:"elevation_gain_meters"`
+	// derived from distance and duration, never stored
+	PaceSecondsPerKm *float64 `json:"pace_seconds_per_km"`
+	SpeedKmh         *float64 `json:"speed_kmh"`
+	// derived from the latest bodyweight for bodyweight exercises
+	RelativeStrength *float64 `json:"relative_strength"`
+	// only set on entries sent on their own, like in events
+	WeightUnit units.WeightUnit `json:"weight_unit,omitempty"`
+}
+
+// Equal reports whether both entries hold the same values.
+func (e *WorkoutEntry) Equal(other *WorkoutEntry) bool {
+	return e.Id == other.Id &&
+		e.ExerciseName == other.ExerciseName &&
+		e.Sets == other.Sets &&
+		equalPtr(e.Reps, other.Reps) &&
+		equalPtr(e.DurationSeconds, other.DurationSeconds) &&
+		equalPtr(e.Weight, other.Weight) &&
+		e.Notes == other.Notes &&
+		e.OrderIndex == other.OrderIndex &&
+		equalPtr(e.DistanceMeters, other.DistanceMeters) &&
+		equalPtr(e.AvgHeartRate, other.AvgHeartRate) &&
+		equalPtr(e.MaxHeartRate, other.MaxHeartRate) &&
+		equalPtr(e.ElevationGainMeters, other.ElevationGainMeters) &&
+		equalSets(e.SetDetails, other.SetDetails)
+}
+
+func equalSets(a, b []WorkoutSet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(&b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 type PostgresWorkoutStore struct {
@@ -38,8 +110,40 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 type WorkoutStore interface {
 	CreateWorkout(*Workout) (*Workout, error)
 	GetWorkoutById(id int64) (*Workout, error)
+	GetWorkoutOwner(id int64) (int, error)
+	CanViewWorkout(id int64, viewerId int) (bool, error)
 	UpdateWorkout(*Workout) error
 	DeleteWorkout(id int64) error
+	GetDeletedWorkouts(userId int) ([]*Workout, error)
+	RestoreWorkout(id int64, userId int) (*Workout, error)
+	PurgeDeletedWorkouts(deletedBefore time.Time, limit int) (int, error)
+	CreateWorkoutWithTrack(*Workout, []TrackPoint) (*Workout, error)
+	GetWorkoutTrack(id int64) ([]TrackPoint, error)
+}
+
+func workoutEvent(eventType string, workout *Workout) Event {
+	return Event{
+		Type:          eventType,
+		AggregateType: AggregateWorkout,
+		AggregateId:   workout.Id,
+		UserId:        workout.UserId,
+		Data:          workout,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+// entryEvent records a change of an entry. Like every event payload its
+// weights are in the canonical unit.
+func entryEvent(eventType string, userId int, entry WorkoutEntry) Event {
+	entry.WeightUnit = units.Canonical
+	return Event{
+		Type:          eventType,
+		AggregateType: AggregateWorkout,
+		AggregateId:   entry.WorkoutId,
+		UserId:        userId,
+		Data:          entry,
+		OccurredAt:    time.Now().UTC(),
+	}
 }
 
 func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
@@ -50,43 +154,93 @@ func (pg *PostgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 
 	defer tx.Rollback()
 
+	err = createWorkout(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	workout.WeightUnit = units.Canonical
+	return workout, nil
+}
+
+// createWorkout inserts the workout with its entries and records the
+// workout.created event in tx.
+func createWorkout(tx *sql.Tx, workout *Workout) error {
+	for i := range workout.Entries {
+		err := workout.Entries[i].prepare()
+		if err != nil {
+			return err
+		}
+	}
+	if workout.CaloriesBurned == 0 {
+		bodyweight, err := estimationBodyweight(tx, workout.UserId)
+		if err != nil {
+			return err
+		}
+		workout.CaloriesBurned = EstimateCalories(workout, bodyweight)
+	}
+	if workout.Visibility == "" {
+		workout.Visibility = VisibilityPublic
+	}
+
 	query :=
-		`INSERT INTO workouts (title,description,duration_minutes,calories_burned)
-	VALUES ($1,$2,$3,$4)
+		`INSERT INTO workouts (user_id,title,description,duration_minutes,calories_burned,visibility)
+	VALUES (NULLIF($1,0),$2,$3,$4,$5,$6)
 	RETURNING id;`
 
-	err = tx.QueryRow(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.Id)
+	err := tx.QueryRow(query, workout.UserId, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.Visibility).Scan(&workout.Id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for i := range workout.Entries {
-		entry := &workout.Entries[i]
-		query := `
-		INSERT INTO workout_entries (workout_id,exercise_name,sets,reps,duration_seconds,weight,notes,order_index)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		RETURNING id;
-		`
-		err = tx.QueryRow(query, workout.Id, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.Id)
+		err = insertEntry(tx, workout.Id, &workout.Entries[i])
 		if err != nil {
-			return nil, err
+			return err
 		}
-		entry.WorkoutId = workout.Id
 	}
 
-	err = tx.Commit()
+	return insertOutboxEvent(tx, workoutEvent(EventWorkoutCreated, workout))
+}
+
+// insertEntry inserts an entry of the workout together with its set details.
+func insertEntry(tx *sql.Tx, workoutId int, entry *WorkoutEntry) error {
+	query := `
+	INSERT INTO workout_entries (workout_id,exercise_name,sets,reps,duration_seconds,weight,notes,order_index,
+		distance_meters,avg_heart_rate,max_heart_rate,elevation_gain_meters)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+	RETURNING id`
+	err := tx.QueryRow(query, workoutId, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex,
+		entry.DistanceMeters, entry.AvgHeartRate, entry.MaxHeartRate, entry.ElevationGainMeters).Scan(&entry.Id)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	entry.WorkoutId = workoutId
+	return insertEntrySets(tx, entry)
+}
 
+func (pg *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
+	workout, err := getWorkout(pg.db, id)
+	if err != nil {
+		return nil, err
+	}
+	err = getInteractions(pg.db, workout)
+	if err != nil {
+		return nil, err
+	}
 	return workout, nil
 }
 
-func (pg *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
-	workout := &Workout{}
-	query := `SELECT id,title,duration_minutes,calories_burned from workouts where id=$1`
+func getWorkout(q querier, id int64) (*Workout, error) {
+	workout := &Workout{WeightUnit: units.Canonical}
+	query := `SELECT id,COALESCE(user_id,0),title,COALESCE(description,''),duration_minutes,COALESCE(calories_burned,0),started_at,finished_at,visibility from workouts where id=$1 AND deleted_at IS NULL`
 
-	err := pg.db.QueryRow(query, id).Scan(&workout.Id, &workout.Title, &workout.DurationMinutes, &workout.CaloriesBurned)
+	err := q.QueryRow(query, id).Scan(&workout.Id, &workout.UserId, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.StartedAt, &workout.FinishedAt, &workout.Visibility)
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
@@ -94,8 +248,11 @@ func (pg *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
 		return nil, err
 	}
 
-	query = `SELECT id,workout_id,exercise_name,sets,reps,duration_seconds,weight,notes,order_index from workout_entries where workout_id=$1 ORDER BY order_index`
-	results, err := pg.db.Query(query, workout.Id)
+	query = `
+	SELECT id,workout_id,exercise_name,sets,reps,duration_seconds,weight,notes,order_index,
+		distance_meters,avg_heart_rate,max_heart_rate,elevation_gain_meters
+	FROM workout_entries WHERE workout_id=$1 ORDER BY order_index`
+	results, err := q.Query(query, workout.Id)
 	if err != nil {
 		return nil, err
 	}
@@ -103,23 +260,96 @@ func (pg *PostgresWorkoutStore) GetWorkoutById(id int64) (*Workout, error) {
 	defer results.Close()
 	for results.Next() {
 		var entry WorkoutEntry
-		err = results.Scan(&entry.Id, &entry.WorkoutId, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+		err = results.Scan(&entry.Id, &entry.WorkoutId, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex,
+			&entry.DistanceMeters, &entry.AvgHeartRate, &entry.MaxHeartRate, &entry.ElevationGainMeters)
 		if err != nil {
 			return nil, err
 		}
+		entry.deriveCardioMetrics()
 		workout.Entries = append(workout.Entries, entry)
 	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+	results.Close()
 
+	sets, err := getWorkoutSets(q, id)
+	if err != nil {
+		return nil, err
+	}
+	bodyweight, err := latestBodyweight(q, workout.UserId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range workout.Entries {
+		workout.Entries[i].SetDetails = sets[workout.Entries[i].Id]
+		workout.Entries[i].applyBodyweight(bodyweight)
+	}
 	return workout, nil
 }
 
+func (pg *PostgresWorkoutStore) GetWorkoutOwner(id int64) (int, error) {
+	var userId int
+	query := `SELECT COALESCE(user_id,0) FROM workouts WHERE id=$1 AND deleted_at IS NULL`
+	err := pg.db.QueryRow(query, id).Scan(&userId)
+	if err != nil {
+		return 0, err
+	}
+	return userId, nil
+}
+
+// CanViewWorkout reports whether viewerId may see the workout, taking both
+// the workout and the owner's profile visibility into account. Workouts of
+// accounts scheduled for deletion are private.
+func (pg *PostgresWorkoutStore) CanViewWorkout(id int64, viewerId int) (bool, error) {
+	var ownerId int
+	var visibility, profileVisibility Visibility
+	var following bool
+	query := `
+	SELECT COALESCE(w.user_id,0),w.visibility,
+		CASE WHEN u.deleted_at IS NOT NULL THEN 'private' ELSE COALESCE(u.profile_visibility,'public') END,
+		EXISTS (SELECT 1 FROM follows f WHERE f.follower_id=$2 AND f.followee_id=w.user_id AND ` + approvedFollow + `)
+	FROM workouts w
+	LEFT JOIN users u ON u.id=w.user_id
+	WHERE w.id=$1 AND w.deleted_at IS NULL`
+	err := pg.db.QueryRow(query, id, viewerId).Scan(&ownerId, &visibility, &profileVisibility, &following)
+	if err != nil {
+		return false, err
+	}
+	return visibility.Restrict(profileVisibility).VisibleTo(ownerId, viewerId, following), nil
+}
+
 func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 	tx, err := pg.db.Begin()
 	if err != nil {
 		return err
 	}
-	query := `UPDATE workouts set title=$1,description=$2,duration_minutes=$3,calories_burned=$4 where id=$5`
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.Id)
+	defer tx.Rollback()
+
+	for i := range workout.Entries {
+		err = workout.Entries[i].prepare()
+		if err != nil {
+			return err
+		}
+	}
+	if workout.CaloriesBurned == 0 {
+		var ownerId int
+		err = tx.QueryRow(`SELECT COALESCE(user_id,0) FROM workouts WHERE id=$1 AND deleted_at IS NULL`, workout.Id).Scan(&ownerId)
+		if err != nil {
+			return err
+		}
+		bodyweight, err := estimationBodyweight(tx, ownerId)
+		if err != nil {
+			return err
+		}
+		workout.CaloriesBurned = EstimateCalories(workout, bodyweight)
+	}
+
+	query := `
+	UPDATE workouts set title=$1,description=$2,duration_minutes=$3,calories_burned=$4,visibility=COALESCE(NULLIF($5,''),visibility),
+		updatedAt=CURRENT_TIMESTAMP
+	where id=$6 AND deleted_at IS NULL`
+	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.Visibility, workout.Id)
 	if err != nil {
 		return err
 	}
@@ -132,67 +362,114 @@ func (pg *PostgresWorkoutStore) UpdateWorkout(workout *Workout) error {
 		return sql.ErrNoRows
 	}
 
-	rows, err := tx.Query(`SELECT id,workout_id,exercise_name,sets,reps,duration_seconds,weight,notes,order_index FROM workout_entries where workout_id=$1`, workout.Id)
+	before, err := getWorkout(tx, int64(workout.Id))
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	currentIds := map[int]bool{}
-	for rows.Next() {
-		var id int
-		err := rows.Scan(&id)
-		if err != nil {
-			return err
-		}
-		currentIds[id] = true
+	current := map[int]WorkoutEntry{}
+	for _, entry := range before.Entries {
+		current[entry.Id] = entry
 	}
 
-	newIds := map[int]bool{}
-	for _, entry := range workout.Entries {
+	var entryEvents []Event
+	keptIds := map[int]bool{}
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		entry.WorkoutId = workout.Id
 		if entry.Id == 0 {
-			insertQ := `
-				INSERT INTO workout_entries 
-				(workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-				VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-			`
-			_, err := tx.Exec(insertQ, workout.Id, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex)
+			err := insertEntry(tx, workout.Id, entry)
 			if err != nil {
 				return err
 			}
+			entryEvents = append(entryEvents, entryEvent(EventWorkoutEntryCreated, before.UserId, *entry))
 		} else {
+			// ids of entries of other workouts must not reach workout_sets
+			if _, ok := current[entry.Id]; !ok {
+				return ErrUnknownEntry
+			}
 			updateQ := `
 				UPDATE workout_entries
-				SET exercise_name=$1, sets=$2, reps=$3, duration_seconds=$4, weight=$5, notes=$6, order_index=$7
-				WHERE id=$8 AND workout_id=$9
+				SET exercise_name=$1, sets=$2, reps=$3, duration_seconds=$4, weight=$5, notes=$6, order_index=$7,
+					distance_meters=$8, avg_heart_rate=$9, max_heart_rate=$10, elevation_gain_meters=$11
+				WHERE id=$12 AND workout_id=$13
 			`
-			_, err := tx.Exec(updateQ, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.Id, workout.Id)
+			_, err := tx.Exec(updateQ, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex,
+				entry.DistanceMeters, entry.AvgHeartRate, entry.MaxHeartRate, entry.ElevationGainMeters, entry.Id, workout.Id)
 			if err != nil {
 				return err
 			}
-			newIds[entry.Id] = true
+			// set details are only replaced when the client sent them, so
+			// clients unaware of per-set data keep existing sets intact
+			if entry.SetDetails != nil {
+				_, err = tx.Exec(`DELETE FROM workout_sets WHERE entry_id=$1`, entry.Id)
+				if err != nil {
+					return err
+				}
+				err = insertEntrySets(tx, entry)
+				if err != nil {
+					return err
+				}
+			} else {
+				entry.SetDetails = current[entry.Id].SetDetails
+			}
+			if old := current[entry.Id]; !old.Equal(entry) {
+				entryEvents = append(entryEvents, entryEvent(EventWorkoutEntryUpdated, before.UserId, *entry))
+			}
 		}
+		keptIds[entry.Id] = true
 	}
 
-	for id := range newIds {
-		if !currentIds[id] {
+	for id, entry := range current {
+		if !keptIds[id] {
 			_, err := tx.Exec(`DELETE FROM workout_entries WHERE id=$1`, id)
 			if err != nil {
 				return err
 			}
+			entryEvents = append(entryEvents, entryEvent(EventWorkoutEntryDeleted, before.UserId, entry))
+		}
+	}
+
+	for _, event := range entryEvents {
+		err = insertOutboxEvent(tx, event)
+		if err != nil {
+			return err
 		}
 	}
 
+	updated, err := getWorkout(tx, int64(workout.Id))
+	if err != nil {
+		return err
+	}
+	err = insertOutboxEvent(tx, workoutEvent(EventWorkoutUpdated, updated))
+	if err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// DeleteWorkout moves the workout to the trash. It is hidden everywhere until
+// it is restored, and purged for good after the retention period.
 func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
-	query := `DELETE FROM workouts where id=$1`
-	result, err := pg.db.Exec(query, id)
-	fmt.Printf("\n\n %+v \n\n", result)
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	workout, err := getWorkout(tx, id)
+	if err == sql.ErrNoRows {
+		return errors.New("No workout found for id ")
+	}
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE workouts SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 AND deleted_at IS NULL`
+	result, err := tx.Exec(query, id)
 	if err != nil {
 		return err
 	}
@@ -203,5 +480,89 @@ func (pg *PostgresWorkoutStore) DeleteWorkout(id int64) error {
 	if rows == 0 {
 		return errors.New("No workout found for id ")
 	}
-	return nil
+
+	err = insertOutboxEvent(tx, workoutEvent(EventWorkoutDeleted, workout))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDeletedWorkouts returns the workouts of userId in the trash, most
+// recently deleted first. Their entries are not included.
+func (pg *PostgresWorkoutStore) GetDeletedWorkouts(userId int) ([]*Workout, error) {
+	query := `
+	SELECT id,COALESCE(user_id,0),title,COALESCE(description,''),duration_minutes,COALESCE(calories_burned,0),started_at,finished_at,visibility,deleted_at
+	FROM workouts WHERE user_id=$1 AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC,id DESC`
+	rows, err := pg.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []*Workout{}
+	for rows.Next() {
+		workout := &Workout{WeightUnit: units.Canonical}
+		err = rows.Scan(&workout.Id, &workout.UserId, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned,
+			&workout.StartedAt, &workout.FinishedAt, &workout.Visibility, &workout.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+	return workouts, rows.Err()
+}
+
+// RestoreWorkout takes a workout of userId out of the trash and returns it.
+// It returns sql.ErrNoRows unless the workout is in the trash.
+func (pg *PostgresWorkoutStore) RestoreWorkout(id int64, userId int) (*Workout, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE workouts SET deleted_at=NULL WHERE id=$1 AND user_id=$2 AND deleted_at IS NOT NULL`
+	result, err := tx.Exec(query, id, userId)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	workout, err := getWorkout(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = insertOutboxEvent(tx, workoutEvent(EventWorkoutRestored, workout))
+	if err != nil {
+		return nil, err
+	}
+	return workout, tx.Commit()
+}
+
+// PurgeDeletedWorkouts removes up to limit workouts deleted before
+// deletedBefore for good, together with everything that cascades from them,
+// and returns how many it removed.
+func (pg *PostgresWorkoutStore) PurgeDeletedWorkouts(deletedBefore time.Time, limit int) (int, error) {
+	query := `
+	DELETE FROM workouts WHERE id IN (
+		SELECT id FROM workouts WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED
+	)`
+	result, err := pg.db.Exec(query, deletedBefore, limit)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(rows), nil
 }
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/stretchr/testify/assert"
@@ -85,6 +86,29 @@ func TestWorkout(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid workout with set details",
+			workout: &Workout{
+				Title:           "Leg day",
+				Description:     "Pyramid squats",
+				DurationMinutes: 45,
+				CaloriesBurned:  400,
+				Entries: []WorkoutEntry{
+					{
+						ExerciseName: "Squat",
+						Notes:        "pyramid",
+						OrderIndex:   1,
+						SetDetails: []WorkoutSet{
+							{SetType: SetTypeWarmup, Reps: IntPtr(10), Weight: FloatPtr(40)},
+							{Reps: IntPtr(8), Weight: FloatPtr(80)},
+							{Reps: IntPtr(5), Weight: FloatPtr(100), RPE: FloatPtr(9)},
+							{SetType: SetTypeDrop, Reps: IntPtr(12), Weight: FloatPtr(60)},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Invalid workout",
 			workout: &Workout{
@@ -134,6 +158,11 @@ func TestWorkout(t *testing.T) {
 				assert.Equal(t, retrieved.Entries[i].ExerciseName, tt.workout.Entries[i].ExerciseName)
 				assert.Equal(t, retrieved.Entries[i].Id, createdWorkout.Entries[i].Id)
 				assert.Equal(t, retrieved.Entries[i].Sets, tt.workout.Entries[i].Sets)
+				assert.Equal(t, len(retrieved.Entries[i].SetDetails), len(tt.workout.Entries[i].SetDetails))
+				for j, set := range retrieved.Entries[i].SetDetails {
+					assert.Equal(t, set.SetType, createdWorkout.Entries[i].SetDetails[j].SetType)
+					assert.Equal(t, set.Reps, createdWorkout.Entries[i].SetDetails[j].Reps)
+				}
 			}
 			lastInsertedId = createdWorkout.Id
 		})
@@ -176,5 +205,129 @@ func TestWorkout(t *testing.T) {
 	}
 }
 
-func FloatPtr(v float32) *float32 { return &v }
+func TestWorkoutTrash(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	suffix := time.Now().UnixNano()
+	userStore := NewPostgresUserStore(db)
+	store := NewPostgresWorkoutStore(db)
+	owner := createTestUser(t, userStore, fmt.Sprintf("trash_owner_%d", suffix))
+	other := createTestUser(t, userStore, fmt.Sprintf("trash_other_%d", suffix))
+
+	workout, err := store.CreateWorkout(&Workout{
+		UserId:          owner.Id,
+		Title:           "Pull day",
+		DurationMinutes: 40,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Pull up", Sets: 3, Reps: IntPtr(8), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+	id := int64(workout.Id)
+
+	require.NoError(t, store.DeleteWorkout(id))
+	_, err = store.GetWorkoutById(id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.GetWorkoutOwner(id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	// deleting twice is an error
+	assert.Error(t, store.DeleteWorkout(id))
+
+	trash, err := store.GetDeletedWorkouts(owner.Id)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, workout.Id, trash[0].Id)
+	require.NotNil(t, trash[0].DeletedAt)
+
+	// only the owner can restore it
+	_, err = store.RestoreWorkout(id, other.Id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	restored, err := store.RestoreWorkout(id, owner.Id)
+	require.NoError(t, err)
+	require.Len(t, restored.Entries, 1)
+	assert.Equal(t, "Pull up", restored.Entries[0].ExerciseName)
+	_, err = store.RestoreWorkout(id, owner.Id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, store.DeleteWorkout(id))
+	trash, err = store.GetDeletedWorkouts(owner.Id)
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+
+	// still within the retention period
+	purged, err := store.PurgeDeletedWorkouts(*trash[0].DeletedAt, 100)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	purged, err = store.PurgeDeletedWorkouts(trash[0].DeletedAt.Add(time.Second), 100)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, 1)
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM workout_entries WHERE workout_id=$1`, id).Scan(&count))
+	assert.Zero(t, count)
+	trash, err = store.GetDeletedWorkouts(owner.Id)
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
+func TestUpdateWorkoutRejectsForeignEntries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	suffix := time.Now().UnixNano()
+	userStore := NewPostgresUserStore(db)
+	store := NewPostgresWorkoutStore(db)
+	victim := createTestUser(t, userStore, fmt.Sprintf("entry_victim_%d", suffix))
+	attacker := createTestUser(t, userStore, fmt.Sprintf("entry_attacker_%d", suffix))
+
+	victimWorkout, err := store.CreateWorkout(&Workout{
+		UserId:          victim.Id,
+		Title:           "Squats",
+		DurationMinutes: 30,
+		Entries: []WorkoutEntry{
+			{
+				ExerciseName: "Squat",
+				OrderIndex:   1,
+				SetDetails: []WorkoutSet{
+					{Reps: IntPtr(5), Weight: FloatPtr(100)},
+					{Reps: IntPtr(5), Weight: FloatPtr(100)},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	foreignEntry := victimWorkout.Entries[0]
+
+	attackerWorkout, err := store.CreateWorkout(&Workout{
+		UserId:          attacker.Id,
+		Title:           "Bench",
+		DurationMinutes: 30,
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Bench press", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(60), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	attackerWorkout.Entries = append(attackerWorkout.Entries, WorkoutEntry{
+		Id:           foreignEntry.Id,
+		ExerciseName: "Squat",
+		OrderIndex:   2,
+		SetDetails:   []WorkoutSet{{Reps: IntPtr(1), Weight: FloatPtr(1)}},
+	})
+	err = store.UpdateWorkout(attackerWorkout)
+	assert.ErrorIs(t, err, ErrUnknownEntry)
+
+	// the victim's sets are untouched and the attacker's workout unchanged
+	fetched, err := store.GetWorkoutById(int64(victimWorkout.Id))
+	require.NoError(t, err)
+	require.Len(t, fetched.Entries, 1)
+	require.Len(t, fetched.Entries[0].SetDetails, 2)
+	assert.Equal(t, float64(100), *fetched.Entries[0].SetDetails[0].Weight)
+	fetched, err = store.GetWorkoutById(int64(attackerWorkout.Id))
+	require.NoError(t, err)
+	assert.Len(t, fetched.Entries, 1)
+}
+
+func FloatPtr(v float64) *float64 { return &v }
 func IntPtr(v int) *int           { return &v }
@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"time"
+)
+
+const (
+	ScopeAuth              = "authentication"
+	ScopeInvitation        = "invitation"
+	ScopeEmailVerification = "email_verification"
+	ScopePasswordReset     = "password_reset"
+	ScopeRefresh           = "refresh"
+	// pending logins waiting for the second factor, by the kind of token
+	// they complete into
+	ScopeTwoFactor    = "two_factor"
+	ScopeTwoFactorJWT = "two_factor_jwt"
+)
+
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserId    int       `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+func GenerateToken(userId int, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserId: userId,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Hash = Hash(token.Plaintext)
+	return token, nil
+}
+
+func Hash(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
@@ -0,0 +1,54 @@
+package units
+
+import (
+	"fmt"
+	"math"
+)
+
+type WeightUnit string
+
+const (
+	Kilograms WeightUnit = "kg"
+	Pounds    WeightUnit = "lb"
+)
+
+// Canonical is the unit every weight is stored in.
+const Canonical = Kilograms
+
+const kilogramsPerPound = 0.45359237
+
+func ParseWeightUnit(s string) (WeightUnit, error) {
+	switch s {
+	case "kg", "kgs":
+		return Kilograms, nil
+	case "lb", "lbs":
+		return Pounds, nil
+	}
+	return "", fmt.Errorf("unknown weight unit %q, expected kg or lb", s)
+}
+
+// Convert converts a weight between units, rounded to the three decimals the
+// database stores.
+func Convert(value float64, from, to WeightUnit) float64 {
+	if from == to {
+		return value
+	}
+	kg := value
+	if from == Pounds {
+		kg = value * kilogramsPerPound
+	}
+	result := kg
+	if to == Pounds {
+		result = kg / kilogramsPerPound
+	}
+	return math.Round(result*1000) / 1000
+}
+
+// ConvertPtr is Convert for optional weights, nil stays nil.
+func ConvertPtr(value *float64, from, to WeightUnit) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := Convert(*value, from, to)
+	return &converted
+}
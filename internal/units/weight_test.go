@@ -0,0 +1,37 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		from  WeightUnit
+		to    WeightUnit
+		want  float64
+	}{
+		{name: "lb to kg", value: 225, from: Pounds, to: Kilograms, want: 102.058},
+		{name: "kg to lb", value: 100, from: Kilograms, to: Pounds, want: 220.462},
+		{name: "heavy leg press", value: 1200, from: Pounds, to: Kilograms, want: 544.311},
+		{name: "same unit", value: 62.5, from: Kilograms, to: Kilograms, want: 62.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Convert(tt.value, tt.from, tt.to))
+		})
+	}
+	assert.Nil(t, ConvertPtr(nil, Pounds, Kilograms))
+}
+
+func TestParseWeightUnit(t *testing.T) {
+	unit, err := ParseWeightUnit("lbs")
+	assert.NoError(t, err)
+	assert.Equal(t, Pounds, unit)
+
+	_, err = ParseWeightUnit("stone")
+	assert.Error(t, err)
+}
@@ -24,14 +24,18 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 }
 
 func ReadIdParam(r *http.Request) (int64, error) {
-	idParam := chi.URLParam(r, "id")
-	if idParam == "" {
-		return 0, errors.New("Failed to read id param")
+	return ReadInt64Param(r, "id")
+}
+
+func ReadInt64Param(r *http.Request, name string) (int64, error) {
+	param := chi.URLParam(r, name)
+	if param == "" {
+		return 0, errors.New("Failed to read " + name + " param")
 	}
 
-	Id, err := strconv.ParseInt(idParam, 10, 64)
+	Id, err := strconv.ParseInt(param, 10, 64)
 	if err != nil {
-		return 0, errors.New("Failed to convert id to int")
+		return 0, errors.New("Failed to convert " + name + " to int")
 	}
 
 	return Id, nil
@@ -0,0 +1,281 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	IdHeader        = "X-Webhook-Id"
+)
+
+type Dispatcher struct {
+	store       store.WebhookStore
+	client      *http.Client
+	logger      *log.Logger
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// AllowPrivateNetworks lets deliveries reach loopback and private
+	// addresses, for local development only
+	AllowPrivateNetworks bool
+}
+
+func NewDispatcher(webhookStore store.WebhookStore, logger *log.Logger) *Dispatcher {
+	d := &Dispatcher{
+		store:       webhookStore,
+		logger:      logger,
+		Interval:    time.Second,
+		BatchSize:   50,
+		MaxAttempts: 12,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  time.Hour,
+	}
+
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if d.AllowPrivateNetworks {
+				return nil
+			}
+			return controlDial(network, address, c)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would dial the endpoint on our behalf, past the address check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	d.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		// a redirect could point anywhere, the response is recorded as is
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return d
+}
+
+func (d *Dispatcher) Name() string {
+	return "webhooks"
+}
+
+// Publish queues the event for every active endpoint of the event's owner
+// that subscribes to it. Run makes the deliveries, so slow endpoints hold
+// back neither the outbox relay nor each other; receivers deduplicate on the
+// X-Webhook-Id header.
+func (d *Dispatcher) Publish(ctx context.Context, event store.Event) error {
+	if event.UserId == 0 {
+		return nil
+	}
+	if event.Id == "" {
+		event.Id = NewEventId()
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = d.store.EnqueueJobs(event.UserId, event.Id, event.Type, body)
+	return err
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		_, err := d.ProcessOnce(ctx)
+		if err != nil {
+			d.logger.Printf("ERROR: webhook dispatcher: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessOnce makes one attempt at each of a batch of due jobs, all at once,
+// and returns how many were delivered. Several instances may run it.
+func (d *Dispatcher) ProcessOnce(ctx context.Context) (int, error) {
+	// a job whose worker went away is attempted again after the lease
+	jobs, err := d.store.ClaimJobs(d.BatchSize, 2*d.client.Timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	delivered := make([]bool, len(jobs))
+	errs := make([]error, len(jobs))
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			delivered[i], errs[i] = d.deliver(ctx, &jobs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for _, ok := range delivered {
+		if ok {
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// deliver makes one attempt at a job and records it in the delivery log. A
+// failed job is retried with exponential backoff until MaxAttempts.
+func (d *Dispatcher) deliver(ctx context.Context, job *store.WebhookJob) (bool, error) {
+	delivery := d.attempt(ctx, job)
+	if err := d.store.RecordDelivery(delivery); err != nil {
+		d.logger.Printf("ERROR: recording webhook delivery: %v", err)
+	}
+	if delivery.Succeeded {
+		return true, d.store.CompleteJob(job.Id)
+	}
+
+	reason := "unexpected status"
+	if delivery.Error != nil {
+		reason = *delivery.Error
+	} else if delivery.StatusCode != nil {
+		reason = fmt.Sprintf("status %d", *delivery.StatusCode)
+	}
+	if job.Attempts >= d.MaxAttempts {
+		d.logger.Printf("ERROR: webhook %d gave up on event %s after %d attempts: %s", job.Endpoint.Id, job.EventId, job.Attempts, reason)
+		return false, d.store.FailJob(job.Id, reason)
+	}
+	return false, d.store.RetryJob(job.Id, reason, time.Now().Add(d.backoff(job.Attempts)))
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	if attempts > 20 {
+		return d.MaxBackoff
+	}
+	backoff := d.Backoff << (attempts - 1)
+	if backoff > d.MaxBackoff {
+		return d.MaxBackoff
+	}
+	return backoff
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, job *store.WebhookJob) *store.WebhookDelivery {
+	delivery := &store.WebhookDelivery{
+		EndpointId: job.Endpoint.Id,
+		EventId:    job.EventId,
+		EventType:  job.EventType,
+		Payload:    job.Payload,
+		Attempt:    job.Attempts,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.Endpoint.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		msg := err.Error()
+		delivery.Error = &msg
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, job.EventType)
+	req.Header.Set(IdHeader, job.EventId)
+	req.Header.Set(SignatureHeader, Sign(job.Endpoint.Secret, time.Now().Unix(), job.Payload))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	delivery.DurationMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		msg := err.Error()
+		delivery.Error = &msg
+		return delivery
+	}
+	resp.Body.Close()
+
+	delivery.StatusCode = &resp.StatusCode
+	delivery.Succeeded = resp.StatusCode >= 200 && resp.StatusCode < 300
+	return delivery
+}
+
+// Sign returns the signature header value for a payload: the unix timestamp and
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the endpoint secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, computeMAC(secret, timestamp, body))
+}
+
+// Verify checks a signature header produced by Sign. A zero tolerance disables
+// the timestamp freshness check.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return errors.New("webhooks: invalid signature timestamp")
+			}
+			timestamp = ts
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return errors.New("webhooks: malformed signature header")
+	}
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)) > tolerance {
+		return errors.New("webhooks: signature timestamp outside tolerance")
+	}
+
+	expected := computeMAC(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("webhooks: signature mismatch")
+	}
+	return nil
+}
+
+func computeMAC(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func NewEventId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
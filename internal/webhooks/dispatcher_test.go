@@ -0,0 +1,363 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Naveenravi07/go-api/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryWebhookStore struct {
+	mu         sync.Mutex
+	endpoints  []store.WebhookEndpoint
+	deliveries []store.WebhookDelivery
+	jobs       []*memoryJob
+}
+
+type memoryJob struct {
+	store.WebhookJob
+	next   time.Time
+	failed bool
+}
+
+func (m *memoryWebhookStore) CreateEndpoint(e *store.WebhookEndpoint) (*store.WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.Id = len(m.endpoints) + 1
+	m.endpoints = append(m.endpoints, *e)
+	return e, nil
+}
+
+func (m *memoryWebhookStore) GetEndpointsForUser(userId int) ([]store.WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []store.WebhookEndpoint
+	for _, e := range m.endpoints {
+		if e.UserId == userId {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryWebhookStore) GetEndpointById(id int64) (*store.WebhookEndpoint, error) {
+	return &m.endpoints[id-1], nil
+}
+
+func (m *memoryWebhookStore) DeleteEndpoint(id int64, userId int) error { return nil }
+
+func (m *memoryWebhookStore) RecordDelivery(d *store.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = append(m.deliveries, *d)
+	return nil
+}
+
+func (m *memoryWebhookStore) GetDeliveries(endpointId int64, limit int) ([]store.WebhookDelivery, error) {
+	return m.deliveries, nil
+}
+
+func (m *memoryWebhookStore) EnqueueJobs(userId int, eventId, eventType string, payload []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queued := 0
+	for _, e := range m.endpoints {
+		if e.UserId != userId || !e.Active || !e.Subscribes(eventType) {
+			continue
+		}
+		m.jobs = append(m.jobs, &memoryJob{WebhookJob: store.WebhookJob{
+			Id: int64(len(m.jobs) + 1), Endpoint: e, EventId: eventId, EventType: eventType, Payload: payload,
+		}})
+		queued++
+	}
+	return queued, nil
+}
+
+// ClaimJobs claims like the Postgres store: the oldest unfailed job of each
+// endpoint, if it is due.
+func (m *memoryWebhookStore) ClaimJobs(limit int, lease time.Duration) ([]store.WebhookJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	seen := map[int]bool{}
+	var claimed []store.WebhookJob
+	for _, job := range m.jobs {
+		if job.failed || seen[job.Endpoint.Id] {
+			continue
+		}
+		seen[job.Endpoint.Id] = true
+		if job.next.After(now) || len(claimed) == limit {
+			continue
+		}
+		job.Attempts++
+		job.next = now.Add(lease)
+		claimed = append(claimed, job.WebhookJob)
+	}
+	return claimed, nil
+}
+
+func (m *memoryWebhookStore) job(id int64) *memoryJob {
+	for _, job := range m.jobs {
+		if job.Id == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebhookStore) CompleteJob(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, job := range m.jobs {
+		if job.Id == id {
+			m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebhookStore) RetryJob(id int64, reason string, nextAttemptAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.job(id).next = nextAttemptAt
+	return nil
+}
+
+func (m *memoryWebhookStore) FailJob(id int64, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.job(id).failed = true
+	return nil
+}
+
+func TestDispatcherDelivery(t *testing.T) {
+	const secret = "whsec_test"
+	var calls int32
+	received := make(chan string, 1)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// fail the first attempt to exercise the retry path
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		err := Verify(secret, r.Header.Get(SignatureHeader), body, time.Minute)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received <- r.Header.Get(EventHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	ms := &memoryWebhookStore{}
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: receiver.URL, Secret: secret, Events: []string{store.EventWorkoutCreated}, Active: true})
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: receiver.URL, Secret: secret, Events: []string{store.EventWorkoutDeleted}, Active: true})
+
+	d := NewDispatcher(ms, log.New(io.Discard, "", 0))
+	d.AllowPrivateNetworks = true
+	d.Backoff = time.Nanosecond
+
+	err := d.Publish(context.Background(), store.Event{
+		Type:   store.EventWorkoutCreated,
+		UserId: 7,
+		Data:   &store.Workout{Id: 1, UserId: 7, Title: "Push day"},
+	})
+	require.NoError(t, err)
+	// only the endpoint subscribing to the event gets a job
+	require.Len(t, ms.jobs, 1)
+
+	delivered, err := d.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	delivered, err = d.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, store.EventWorkoutCreated, <-received)
+	assert.Empty(t, ms.jobs)
+	require.Len(t, ms.deliveries, 2)
+	assert.False(t, ms.deliveries[0].Succeeded)
+	assert.True(t, ms.deliveries[1].Succeeded)
+	assert.Equal(t, 2, ms.deliveries[1].Attempt)
+	assert.Equal(t, ms.deliveries[0].EventId, ms.deliveries[1].EventId)
+}
+
+func TestDispatcherIsolatesEndpoints(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer healthy.Close()
+
+	ms := &memoryWebhookStore{}
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: failing.URL, Secret: "s", Events: []string{"*"}, Active: true})
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: healthy.URL, Secret: "s", Events: []string{"*"}, Active: true})
+	d := NewDispatcher(ms, log.New(io.Discard, "", 0))
+	d.AllowPrivateNetworks = true
+
+	for _, id := range []string{"1", "2"} {
+		err := d.Publish(context.Background(), store.Event{Id: id, Type: store.EventWorkoutSetLogged, UserId: 7})
+		require.NoError(t, err)
+	}
+
+	delivered, err := d.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	delivered, err = d.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	// the failing endpoint waits for its retry, its second event stays queued
+	require.Len(t, ms.jobs, 2)
+	assert.Equal(t, "1", ms.jobs[0].EventId)
+	assert.Equal(t, 1, ms.jobs[0].Attempts)
+	assert.Equal(t, "2", ms.jobs[1].EventId)
+	assert.Zero(t, ms.jobs[1].Attempts)
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	ms := &memoryWebhookStore{}
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: receiver.URL, Secret: "s", Events: []string{"*"}, Active: true})
+	d := NewDispatcher(ms, log.New(io.Discard, "", 0))
+	d.AllowPrivateNetworks = true
+	d.Backoff = time.Nanosecond
+	d.MaxAttempts = 3
+
+	err := d.Publish(context.Background(), store.Event{Id: "evt_1", Type: store.EventWorkoutUpdated, UserId: 7})
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err := d.ProcessOnce(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Len(t, ms.deliveries, 3)
+	require.Len(t, ms.jobs, 1)
+	assert.True(t, ms.jobs[0].failed)
+}
+
+func TestDispatcherRefusesPrivateNetworks(t *testing.T) {
+	var calls int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	ms := &memoryWebhookStore{}
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: receiver.URL, Secret: "s", Events: []string{"*"}, Active: true})
+	d := NewDispatcher(ms, log.New(io.Discard, "", 0))
+
+	err := d.Publish(context.Background(), store.Event{Id: "evt_1", Type: store.EventWorkoutUpdated, UserId: 7})
+	require.NoError(t, err)
+	delivered, err := d.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Zero(t, atomic.LoadInt32(&calls))
+	require.Len(t, ms.deliveries, 1)
+	require.NotNil(t, ms.deliveries[0].Error)
+	assert.Contains(t, *ms.deliveries[0].Error, ErrForbiddenAddress.Error())
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	var calls int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	ms := &memoryWebhookStore{}
+	ms.CreateEndpoint(&store.WebhookEndpoint{UserId: 7, URL: receiver.URL, Secret: "s", Events: []string{"*"}, Active: true})
+	d := NewDispatcher(ms, log.New(io.Discard, "", 0))
+	d.AllowPrivateNetworks = true
+
+	err := d.Publish(context.Background(), store.Event{Id: "evt_1", Type: store.EventWorkoutUpdated, UserId: 7})
+	require.NoError(t, err)
+	delivered, err := d.ProcessOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+	assert.Zero(t, atomic.LoadInt32(&calls))
+	require.Len(t, ms.deliveries, 1)
+	require.NotNil(t, ms.deliveries[0].StatusCode)
+	assert.Equal(t, http.StatusTemporaryRedirect, *ms.deliveries[0].StatusCode)
+}
+
+func TestForbiddenHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "hooks.example.com", want: false},
+		{host: "93.184.216.34", want: false},
+		{host: "2606:2800:220:1::1", want: false},
+		{host: "localhost", want: true},
+		{host: "api.localhost.", want: true},
+		{host: "127.0.0.1", want: true},
+		{host: "10.1.2.3", want: true},
+		{host: "172.16.0.1", want: true},
+		{host: "192.168.1.1", want: true},
+		{host: "169.254.169.254", want: true},
+		{host: "100.64.0.1", want: true},
+		{host: "0.0.0.0", want: true},
+		{host: "::1", want: true},
+		{host: "fd00::1", want: true},
+		{host: "fe80::1", want: true},
+		{host: "::ffff:127.0.0.1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.want, ForbiddenHost(tt.host))
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"workout.created"}`)
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		wantErr bool
+	}{
+		{name: "valid", secret: "s", header: Sign("s", now, body), wantErr: false},
+		{name: "wrong secret", secret: "other", header: Sign("s", now, body), wantErr: true},
+		{name: "stale", secret: "s", header: Sign("s", now-3600, body), wantErr: true},
+		{name: "malformed", secret: "s", header: "garbage", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, body, 5*time.Minute)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenAddress is returned when an endpoint resolves to an address on
+// a private network. Webhook URLs are chosen by users, so deliveries must
+// not reach the API's own host or the network around it.
+var ErrForbiddenAddress = errors.New("webhooks: endpoint address is not allowed")
+
+// reservedPrefixes are non-public ranges the netip predicates do not cover.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// publicAddress reports whether ip may receive webhooks: loopback, private,
+// link-local, multicast, unspecified and reserved addresses may not.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ForbiddenHost reports whether the host of an endpoint URL is known not to
+// be public without resolving it: a non-public IP literal or a localhost
+// name. It only gives early feedback when an endpoint is registered; names
+// are checked again by address on every delivery.
+func ForbiddenHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	return err == nil && !publicAddress(ip)
+}
+
+// controlDial refuses connections to non-public addresses. It runs after
+// name resolution for every address dialed, so a name that resolves to a
+// public address when registered and a private one later is caught too.
+func controlDial(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddress(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
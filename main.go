@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -22,6 +23,14 @@ func main() {
 	}
 	defer app.DB.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.OutboxRelay.Run(ctx)
+	go app.WebhookDispatcher.Run(ctx)
+	go app.RealtimeTailer.Run(ctx)
+	go app.AccountPurger.Run(ctx)
+	go app.WorkoutPurger.Run(ctx)
+
 	r := routes.SetupRoutes(app)
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS tokens(
+    hash BYTEA PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL,
+    scope TEXT NOT NULL
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE tokens;
+-- +goose statementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE workouts
+ADD COLUMN user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_workouts_user_id ON workouts(user_id);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+ALTER TABLE workouts DROP COLUMN user_id;
+-- +goose statementEnd
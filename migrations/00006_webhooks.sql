@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS webhook_endpoints(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{*}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    id BIGSERIAL PRIMARY KEY,
+    endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    succeeded BOOLEAN NOT NULL DEFAULT FALSE,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, createdAT DESC);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE webhook_deliveries;
+-- +goose statementEnd
+
+-- +goose statementBegin
+DROP TABLE webhook_endpoints;
+-- +goose statementEnd
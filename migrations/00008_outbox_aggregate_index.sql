@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate ON outbox(aggregate_type, aggregate_id, id);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP INDEX IF EXISTS idx_outbox_aggregate;
+-- +goose statementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE workouts
+ADD COLUMN started_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN finished_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS workout_session_sets(
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name varchar(255) NOT NULL,
+    set_number INTEGER NOT NULL,
+    reps INTEGER,
+    duration_seconds INTEGER,
+    weight DECIMAL(5,2),
+    rpe DECIMAL(3,1),
+    rest_seconds INTEGER,
+    notes TEXT,
+    performed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_session_set CHECK(
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND 
+        (reps IS NULL OR duration_seconds IS NULL)
+    ),
+    CONSTRAINT valid_session_set_rpe CHECK(rpe IS NULL OR (rpe >= 1 AND rpe <= 10))
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_workout_session_sets_workout ON workout_session_sets(workout_id, id);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE workout_session_sets;
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workouts DROP COLUMN started_at, DROP COLUMN finished_at;
+-- +goose statementEnd
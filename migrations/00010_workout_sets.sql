@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS workout_sets(
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+    set_number INTEGER NOT NULL,
+    set_type VARCHAR(20) NOT NULL DEFAULT 'working',
+    reps INTEGER,
+    duration_seconds INTEGER,
+    weight DECIMAL(5,2),
+    rpe DECIMAL(3,1),
+    rir INTEGER,
+    rest_seconds INTEGER,
+    completed BOOLEAN NOT NULL DEFAULT TRUE,
+    CONSTRAINT valid_workout_set CHECK(
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND 
+        (reps IS NULL OR duration_seconds IS NULL)
+    ),
+    CONSTRAINT valid_workout_set_type CHECK(set_type IN ('warmup','working','drop','failure')),
+    CONSTRAINT valid_workout_set_rpe CHECK(rpe IS NULL OR (rpe >= 1 AND rpe <= 10)),
+    CONSTRAINT valid_workout_set_rir CHECK(rir IS NULL OR (rir >= 0 AND rir <= 10)),
+    UNIQUE(entry_id, set_number)
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE workout_sets;
+-- +goose statementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- Weights are stored canonically in kilograms. Rows written before this
+-- migration are assumed to already be in kilograms.
+-- +goose statementBegin
+ALTER TABLE workout_entries ALTER COLUMN weight TYPE DECIMAL(9,3);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_sets ALTER COLUMN weight TYPE DECIMAL(9,3);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_session_sets ALTER COLUMN weight TYPE DECIMAL(9,3);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE users
+ADD COLUMN preferred_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+ADD CONSTRAINT valid_preferred_unit CHECK(preferred_unit IN ('kg','lb'));
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+ALTER TABLE users DROP CONSTRAINT valid_preferred_unit, DROP COLUMN preferred_unit;
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_session_sets ALTER COLUMN weight TYPE DECIMAL(5,2);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_sets ALTER COLUMN weight TYPE DECIMAL(5,2);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries ALTER COLUMN weight TYPE DECIMAL(5,2);
+-- +goose statementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE workout_entries
+ADD COLUMN distance_meters DECIMAL(10,2),
+ADD COLUMN avg_heart_rate INTEGER,
+ADD COLUMN max_heart_rate INTEGER,
+ADD COLUMN elevation_gain_meters DECIMAL(8,2);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries DROP CONSTRAINT valid_workout_entry;
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry CHECK(
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL OR distance_meters IS NOT NULL) AND 
+    (reps IS NULL OR duration_seconds IS NULL)
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry_cardio CHECK(
+    (distance_meters IS NULL OR distance_meters > 0) AND
+    (elevation_gain_meters IS NULL OR elevation_gain_meters >= 0) AND
+    (avg_heart_rate IS NULL OR avg_heart_rate BETWEEN 20 AND 250) AND
+    (max_heart_rate IS NULL OR max_heart_rate BETWEEN 20 AND 250)
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+ALTER TABLE workout_entries DROP CONSTRAINT valid_workout_entry_cardio;
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries DROP CONSTRAINT valid_workout_entry;
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry CHECK(
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND 
+    (reps IS NULL OR duration_seconds IS NULL)
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+ALTER TABLE workout_entries
+DROP COLUMN distance_meters,
+DROP COLUMN avg_heart_rate,
+DROP COLUMN max_heart_rate,
+DROP COLUMN elevation_gain_meters;
+-- +goose statementEnd
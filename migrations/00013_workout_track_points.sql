@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS workout_track_points(
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    latitude DOUBLE PRECISION,
+    longitude DOUBLE PRECISION,
+    elevation_meters DOUBLE PRECISION,
+    heart_rate INTEGER,
+    distance_meters DOUBLE PRECISION,
+    PRIMARY KEY(workout_id, seq),
+    CONSTRAINT valid_track_point CHECK(
+        (latitude IS NULL) = (longitude IS NULL) AND
+        (latitude IS NULL OR latitude BETWEEN -90 AND 90) AND
+        (longitude IS NULL OR longitude BETWEEN -180 AND 180)
+    )
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE workout_track_points;
+-- +goose statementEnd
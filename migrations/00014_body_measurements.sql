@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS body_measurements(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    measured_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    bodyweight DECIMAL(9,3),
+    body_fat_percent DECIMAL(4,1),
+    neck_cm DECIMAL(5,1),
+    chest_cm DECIMAL(5,1),
+    waist_cm DECIMAL(5,1),
+    hips_cm DECIMAL(5,1),
+    arm_cm DECIMAL(5,1),
+    thigh_cm DECIMAL(5,1),
+    calf_cm DECIMAL(5,1),
+    notes TEXT,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_body_measurement CHECK(
+        COALESCE(bodyweight, body_fat_percent, neck_cm, chest_cm, waist_cm, hips_cm, arm_cm, thigh_cm, calf_cm) IS NOT NULL
+    ),
+    CONSTRAINT valid_body_fat_percent CHECK(body_fat_percent IS NULL OR (body_fat_percent > 0 AND body_fat_percent < 100))
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_body_measurements_user ON body_measurements(user_id, measured_at);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE body_measurements;
+-- +goose statementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS goals(
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    goal_type VARCHAR(20) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    exercise_name VARCHAR(255),
+    target_value DECIMAL(12,3) NOT NULL,
+    start_value DECIMAL(12,3),
+    period VARCHAR(10),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deadline TIMESTAMP WITH TIME ZONE,
+    achieved_at TIMESTAMP WITH TIME ZONE,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_goal_type CHECK(goal_type IN ('lift','frequency','volume','bodyweight')),
+    CONSTRAINT valid_goal_target CHECK(target_value > 0),
+    CONSTRAINT valid_goal_period CHECK(period IS NULL OR period IN ('week','month')),
+    CONSTRAINT valid_goal_deadline CHECK(deadline IS NULL OR deadline > starts_at)
+);
+-- +goose statementEnd
+
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_goals_user ON goals(user_id);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE goals;
+-- +goose statementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS user_achievements(
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(50) NOT NULL,
+    awarded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(user_id, code)
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE user_achievements;
+-- +goose statementEnd
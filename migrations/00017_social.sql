@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS follows(
+    follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS follows_followee_idx ON follows(followee_id);
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE users ADD COLUMN profile_visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+    CHECK (profile_visibility IN ('public','followers','private'));
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE workouts ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public','followers','private'));
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS workouts_feed_idx ON workouts(user_id, createdAT DESC, id DESC);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP INDEX IF EXISTS workouts_feed_idx;
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE workouts DROP COLUMN visibility;
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE users DROP COLUMN profile_visibility;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE follows;
+-- +goose statementEnd
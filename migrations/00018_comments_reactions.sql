@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS workout_comments(
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id BIGINT REFERENCES workout_comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'visible' CHECK (status IN ('visible','held')),
+    moderation_reason TEXT,
+    edited_at TIMESTAMP WITH TIME ZONE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS workout_comments_workout_idx ON workout_comments(workout_id, id);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS workout_reactions(
+    workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('like','fire','strong')),
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(workout_id, user_id, kind)
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE workout_reactions;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE workout_comments;
+-- +goose statementEnd
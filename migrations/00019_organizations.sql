@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS organizations(
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS organization_members(
+    organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner','coach','athlete')),
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(organization_id, user_id)
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS organization_members_user_idx ON organization_members(user_id);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS organization_invitations(
+    id BIGSERIAL PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner','coach','athlete')),
+    token_hash BYTEA NOT NULL UNIQUE,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE organization_invitations;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE organization_members;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE organizations;
+-- +goose statementEnd
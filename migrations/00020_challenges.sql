@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS challenges(
+    id BIGSERIAL PRIMARY KEY,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    organization_id BIGINT REFERENCES organizations(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    metric VARCHAR(20) NOT NULL CHECK (metric IN ('volume','workouts','duration','exercise_reps')),
+    exercise_name VARCHAR(255),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updatedAt TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at)
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS challenge_participants(
+    challenge_id BIGINT NOT NULL REFERENCES challenges(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    score DECIMAL(14,3) NOT NULL DEFAULT 0,
+    reached_at TIMESTAMP WITH TIME ZONE,
+    refreshed_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY(challenge_id, user_id)
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS challenge_participants_user_idx ON challenge_participants(user_id);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS challenge_participants_standings_idx ON challenge_participants(challenge_id, score DESC, reached_at);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE challenge_participants;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE challenges;
+-- +goose statementEnd
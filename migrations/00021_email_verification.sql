@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS tokens_user_scope_idx ON tokens(user_id, scope);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP INDEX IF EXISTS tokens_user_scope_idx;
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE users DROP COLUMN email_verified_at;
+-- +goose statementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Rows written before passwords were hashed reliably may hold the plaintext.
+-- Every password_hash that is not already a bcrypt ($2a$, $2b$, $2y$) or an
+-- Argon2id hash is hashed in place with bcrypt at cost 12 using pgcrypto's
+-- crypt(). The application verifies the result like any other bcrypt hash,
+-- and running the statement again changes nothing.
+-- CREATE EXTENSION needs a role that may create extensions in the database
+-- (a superuser, or on PostgreSQL 13+ a database owner as pgcrypto is a
+-- trusted extension). Otherwise have such a role create pgcrypto before
+-- migrating.
+-- +goose statementBegin
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+-- +goose statementEnd
+-- +goose statementBegin
+UPDATE users SET password_hash=crypt(password_hash, gen_salt('bf', 12))
+WHERE password_hash !~ '^\$2[aby]\$[0-9]{2}\$' AND password_hash NOT LIKE '$argon2id$%';
+-- +goose statementEnd
+-- +goose Down
+
+-- hashing cannot be undone, the hashes stay in place
+-- +goose statementBegin
+SELECT 1;
+-- +goose statementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+    hash BYTEA PRIMARY KEY,
+    family BYTEA NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens(family);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens(user_id);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE refresh_tokens;
+-- +goose statementEnd
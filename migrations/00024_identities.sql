@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS user_identities(
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255),
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS oidc_login_states(
+    state_hash BYTEA PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    expiry TIMESTAMP WITH TIME ZONE NOT NULL
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE oidc_login_states;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE user_identities;
+-- +goose statementEnd
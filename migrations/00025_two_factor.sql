@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS user_two_factor(
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP WITH TIME ZONE,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    createdAT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes(
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (user_id, code_hash)
+);
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE two_factor_recovery_codes;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP TABLE user_two_factor;
+-- +goose statementEnd
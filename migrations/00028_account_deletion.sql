@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS users_deleted_idx ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+ALTER TABLE users DROP COLUMN deleted_at;
+-- +goose statementEnd
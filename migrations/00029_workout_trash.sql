@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE workouts ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS workouts_deleted_idx ON workouts(deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+ALTER TABLE workouts DROP COLUMN deleted_at;
+-- +goose statementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE outbox ADD COLUMN failed_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementEnd
+-- +goose statementBegin
+DROP INDEX IF EXISTS idx_outbox_pending;
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE published_at IS NULL AND failed_at IS NULL;
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP INDEX IF EXISTS idx_outbox_pending;
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE outbox DROP COLUMN failed_at;
+-- +goose statementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE outbox ADD COLUMN published_sinks TEXT[] NOT NULL DEFAULT '{}';
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE TABLE IF NOT EXISTS webhook_jobs(
+    id BIGSERIAL PRIMARY KEY,
+    endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    failed_at TIMESTAMP WITH TIME ZONE,
+    createdAT TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (endpoint_id, event_id)
+);
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS idx_webhook_jobs_pending ON webhook_jobs(endpoint_id, id) WHERE failed_at IS NULL;
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP TABLE webhook_jobs;
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE outbox DROP COLUMN published_sinks;
+-- +goose statementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose statementBegin
+ALTER TABLE follows ADD COLUMN approved_at TIMESTAMP WITH TIME ZONE;
+-- +goose statementEnd
+-- +goose statementBegin
+UPDATE follows SET approved_at=createdAT;
+-- +goose statementEnd
+-- +goose statementBegin
+CREATE INDEX IF NOT EXISTS follows_requests_idx ON follows(followee_id, createdAT DESC) WHERE approved_at IS NULL;
+-- +goose statementEnd
+-- +goose Down
+
+-- +goose statementBegin
+DROP INDEX IF EXISTS follows_requests_idx;
+-- +goose statementEnd
+-- +goose statementBegin
+ALTER TABLE follows DROP COLUMN approved_at;
+-- +goose statementEnd